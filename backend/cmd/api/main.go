@@ -1,49 +1,27 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
-	"strings"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 
+	"github.com/jonkermoo/rag-textbook/backend/internal/config"
 	"github.com/jonkermoo/rag-textbook/backend/internal/database"
 	"github.com/jonkermoo/rag-textbook/backend/internal/handlers"
 	"github.com/jonkermoo/rag-textbook/backend/internal/middleware"
+	"github.com/jonkermoo/rag-textbook/backend/internal/router"
 	"github.com/jonkermoo/rag-textbook/backend/internal/services"
 )
 
-// helper: central place to decide which origins are allowed
-func isOriginAllowed(origin string) bool {
-	if origin == "" {
-		return false
-	}
-
-	// 1) Local dev: any localhost port
-	if strings.HasPrefix(origin, "http://localhost") {
-		return true
-	}
-
-	// 2) Main production domains
-	if origin == "https://lexra.online" || origin == "https://www.lexra.online" {
-		return true
-	}
-
-	// 3) Any Vercel deployment/preview
-	if strings.HasSuffix(origin, ".vercel.app") {
-		return true
-	}
-
-	// 4) Any lexra.online subdomain (e.g. https://api.lexra.online)
-	if strings.HasSuffix(origin, ".lexra.online") {
-		return true
-	}
-
-	return false
-}
-
 func main() {
 	// Load environment variables
 	err := godotenv.Load("../../.env")
@@ -54,105 +32,196 @@ func main() {
 		}
 	}
 
+	// Load and check all settings before connecting to anything
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
 	// Initialize database connection
-	db, err := database.NewDB()
+	db, err := database.NewDB(cfg.Database)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 	defer db.Close()
-	log.Println("Connected to database")
+	// Start degraded rather than exit; /api/health/ready reports what's missing
+	if err := checkDatabase(db); err != nil {
+		log.Printf("Warning: %v; starting degraded", err)
+	} else {
+		log.Println("Connected to database")
+	}
+
+	// Document storage, shared by uploads, ingestion and health checks
+	s3Client := services.NewS3Client(cfg.Storage)
 
 	// Initialize services
-	embeddingService := services.NewEmbeddingService()
+	embeddingService := services.NewEmbeddingService(db, cfg.Embedding)
 	log.Println("Embedding service initialized")
 
-	ragService := services.NewRAGService(db, embeddingService)
-	log.Println("RAG service initialized")
-
-	authService := services.NewAuthService(db)
-	log.Println("Auth service initialized")
-
-	// Initialize middleware
-	authMiddleware := middleware.AuthMiddleware(authService)
-
-	// CORS middleware wrapper
-	corsMiddleware := func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			origin := r.Header.Get("Origin")
+	reranker := services.NewReranker(cfg.Reranker)
+	if reranker != nil {
+		log.Printf("Reranker initialized (%s)", reranker.Name())
+	}
 
-			if isOriginAllowed(origin) {
-				w.Header().Set("Access-Control-Allow-Origin", origin)
-				w.Header().Set("Access-Control-Allow-Credentials", "true")
-			}
+	ragService := services.NewRAGService(db, embeddingService, reranker, cfg)
+	log.Println("RAG service initialized")
 
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	searchService := services.NewSearchService(db, embeddingService, cfg.Timeouts)
 
-			// Preflight
-			if r.Method == http.MethodOptions {
-				w.WriteHeader(http.StatusOK)
-				return
-			}
+	// Pick up re-embeds and ingestion runs interrupted by a restart
+	reembedService := services.NewReembedService(db, embeddingService)
+	if err := reembedService.ResumePending(context.Background()); err != nil {
+		log.Printf("Warning: could not resume re-embeds: %v", err)
+	}
 
-			next.ServeHTTP(w, r)
-		})
+	ingestionService := services.NewIngestionService(db, s3Client, cfg)
+	if err := ingestionService.ResumePending(context.Background()); err != nil {
+		log.Printf("Warning: could not resume ingestion: %v", err)
 	}
 
+	authService := services.NewAuthService(db, cfg.Auth)
+	log.Println("Auth service initialized")
+
 	// Initialize handlers
 	textbookHandler := handlers.NewTextbookHandler(db)
 	queryHandler := handlers.NewQueryHandler(ragService)
 	authHandler := handlers.NewAuthHandler(authService)
-	uploadHandler := handlers.NewUploadHandler(db)
-
-	// Textbook management routes (protected)
-	http.Handle("/api/textbooks", corsMiddleware(authMiddleware(http.HandlerFunc(textbookHandler.HandleListTextbooks))))
-	http.HandleFunc("/api/textbooks/", func(w http.ResponseWriter, r *http.Request) {
-		corsMiddleware(authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if strings.HasSuffix(r.URL.Path, "/status") {
-				textbookHandler.HandleGetTextbookStatus(w, r)
-			} else if r.Method == http.MethodDelete {
-				textbookHandler.HandleDeleteTextbook(w, r)
-			} else if r.Method == http.MethodGet {
-				textbookHandler.HandleGetTextbook(w, r)
-			} else {
-				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			}
-		}))).ServeHTTP(w, r)
-	})
+	uploadHandler := handlers.NewUploadHandler(db, ingestionService, s3Client, cfg)
+	settingsHandler := handlers.NewSettingsHandler(db, ragService)
+	searchHandler := handlers.NewSearchHandler(searchService)
+	embeddingHandler := handlers.NewEmbeddingHandler(db, embeddingService, reembedService)
+	healthHandler := handlers.NewHealthHandler(services.NewHealthService(db, s3Client, cfg))
 
-	// Protected routes
-	http.Handle("/api/query", corsMiddleware(authMiddleware(http.HandlerFunc(queryHandler.HandleQuery))))
-	http.Handle("/api/upload", corsMiddleware(authMiddleware(http.HandlerFunc(uploadHandler.HandleUpload))))
+	r := router.New()
 
 	// Public routes
-	http.Handle("/api/auth/register", corsMiddleware(http.HandlerFunc(authHandler.HandleRegister)))
-	http.Handle("/api/auth/login", corsMiddleware(http.HandlerFunc(authHandler.HandleLogin)))
-	http.Handle("/api/auth/verify", corsMiddleware(http.HandlerFunc(authHandler.HandleVerify)))
-	http.Handle("/api/health", corsMiddleware(http.HandlerFunc(handlers.HandleHealth)))
+	r.HandleFunc("POST /api/auth/register", authHandler.HandleRegister)
+	r.HandleFunc("POST /api/auth/login", authHandler.HandleLogin)
+	r.HandleFunc("POST /api/auth/verify", authHandler.HandleVerify)
+	r.HandleFunc("GET /api/health", healthHandler.HandleLive)
+	r.HandleFunc("GET /api/health/live", healthHandler.HandleLive)
+	r.HandleFunc("GET /api/health/ready", healthHandler.HandleReady)
 
-	// Fallback for unknown routes – no special CORS needed here
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		http.NotFound(w, r)
-	})
+	// Protected routes
+	api := r.With(middleware.AuthMiddleware(authService))
+	api.HandleFunc("GET /api/textbooks", textbookHandler.HandleListTextbooks)
+	api.HandleFunc("GET /api/textbooks/{id}", textbookHandler.HandleGetTextbook)
+	api.HandleFunc("PATCH /api/textbooks/{id}", textbookHandler.HandleUpdateTextbook)
+	api.HandleFunc("DELETE /api/textbooks/{id}", textbookHandler.HandleDeleteTextbook)
+	api.HandleFunc("GET /api/textbooks/{id}/status", textbookHandler.HandleGetTextbookStatus)
+	api.HandleFunc("GET /api/textbooks/{id}/outline", textbookHandler.HandleGetTextbookOutline)
+	api.HandleFunc("GET /api/textbooks/{id}/search", searchHandler.HandleSearchTextbook)
+	api.HandleFunc("GET /api/textbooks/{id}/embeddings", embeddingHandler.HandleListEmbeddings)
+	api.HandleFunc("POST /api/textbooks/{id}/reembed", embeddingHandler.HandleReembed)
+	api.HandleFunc("POST /api/query", queryHandler.HandleQuery)
+	api.HandleFunc("GET /api/search", searchHandler.HandleSearch)
+	api.HandleFunc("POST /api/upload", uploadHandler.HandleUpload)
+	api.HandleFunc("GET /api/settings", settingsHandler.HandleGetSettings)
+	api.HandleFunc("PUT /api/settings", settingsHandler.HandleUpdateSettings)
+
+	// Applied to every request, including unmatched ones. Every request gets
+	// an ID that error responses report.
+	handler := middleware.Chain(
+		middleware.RequestID,
+		middleware.CORS(cfg.Server.AllowedOrigins),
+	)(r)
 
 	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
+	port := strconv.Itoa(cfg.Server.Port)
 
 	log.Printf("\nServer starting on http://localhost:%s", port)
 	log.Println("\nAvailable endpoints:")
 	log.Println("  POST   /api/upload                 - Upload a textbook PDF")
 	log.Println("  GET    /api/textbooks              - List user's textbooks")
 	log.Println("  GET    /api/textbooks/:id          - Get textbook details")
+	log.Println("  PATCH  /api/textbooks/:id          - Update textbook settings")
 	log.Println("  DELETE /api/textbooks/:id          - Delete a textbook")
 	log.Println("  GET    /api/textbooks/:id/status   - Get processing status")
+	log.Println("  GET    /api/textbooks/:id/outline  - Get table of contents")
+	log.Println("  GET    /api/textbooks/:id/search   - Search a textbook (?q=)")
+	log.Println("  GET    /api/textbooks/:id/embeddings - List embedding generations")
+	log.Println("  POST   /api/textbooks/:id/reembed  - Re-embed with another model")
 	log.Println("  POST   /api/query                  - Submit a question")
-	log.Println("  GET    /api/health                 - Health check")
+	log.Println("  GET    /api/search                 - Search all textbooks (?q=)")
+	log.Println("  GET    /api/settings               - Get query settings")
+	log.Println("  PUT    /api/settings               - Update query settings")
+	log.Println("  GET    /api/health/live            - Liveness check")
+	log.Println("  GET    /api/health/ready           - Readiness check (dependencies)")
 	log.Println("\nPress Ctrl+C to stop")
 
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	// Stop on SIGTERM (deploys) or Ctrl+C
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+
+	select {
+	case err := <-serverErr:
 		log.Fatal("Server failed to start:", err)
+	case sig := <-stop:
+		log.Printf("Received %s, shutting down (waiting up to %s)", sig, cfg.Server.ShutdownTimeout)
+	}
+	signal.Stop(stop)
+
+	shutdown(server, cfg.Server.ShutdownTimeout, ingestionService, reembedService)
+}
+
+// Stop accepting requests, then let active requests and background work
+// finish before the timeout. Ingestion runs still going then are marked
+// interrupted, and re-embeds stay building; both resume on the next start.
+func shutdown(server *http.Server, timeout time.Duration, ingestionService *services.IngestionService, reembedService *services.ReembedService) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Requests and background work drain at the same time, against the same
+	// deadline. A request finishing during the drain may still start an
+	// ingestion run.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if err := reembedService.Shutdown(ctx); err != nil {
+			log.Printf("Re-embeds interrupted: %v", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Requests still active at the deadline were cut off: %v", err)
+			server.Close()
+		}
+		if err := ingestionService.Shutdown(ctx); err != nil {
+			log.Printf("Ingestion interrupted: %v", err)
+		}
+	}()
+	wg.Wait()
+
+	log.Println("Server stopped")
+}
+
+// Check that the database is reachable and has pgvector
+func checkDatabase(db *database.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := db.Ping(ctx); err != nil {
+		return err
 	}
+	_, err := db.CheckVectorExtension(ctx)
+	return err
 }
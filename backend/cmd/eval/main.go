@@ -0,0 +1,420 @@
+// Command eval runs a golden question set through the RAG pipeline and
+// reports retrieval and answer quality, so changes to chunking, thresholds or
+// prompts can be compared run against run:
+//
+//	go run ./cmd/eval -dataset cmd/eval/testdata/golden.json -out before.json
+//	go run ./cmd/eval -dataset cmd/eval/testdata/golden.json -out after.json
+//	diff before.json after.json
+//
+// The dataset's textbook fixture must already be ingested (upload it, or run
+// the ingestion worker on it). It is looked up by ID, or by title.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/config"
+	"github.com/jonkermoo/rag-textbook/backend/internal/database"
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+	"github.com/jonkermoo/rag-textbook/backend/internal/services"
+)
+
+// Dataset is a golden question set for one textbook
+type Dataset struct {
+	Name      string           `json:"name"`
+	Textbook  DatasetTextbook  `json:"textbook"`
+	Questions []GoldenQuestion `json:"questions"`
+}
+
+type DatasetTextbook struct {
+	ID      int    `json:"id,omitempty"`
+	Title   string `json:"title"`
+	Fixture string `json:"fixture,omitempty"` // Source document, relative to the dataset file
+}
+
+type GoldenQuestion struct {
+	ID             string `json:"id"`
+	Question       string `json:"question"`
+	ExpectedPages  []int  `json:"expected_pages"` // Pages (or section ordinals) that answer the question
+	ExpectedAnswer string `json:"expected_answer,omitempty"`
+}
+
+// Report is the JSON output of a run. It has no timestamps or timings so
+// two runs can be diffed directly.
+type Report struct {
+	Dataset   string           `json:"dataset"`
+	Config    RunConfig        `json:"config"`
+	Summary   Summary          `json:"summary"`
+	Questions []QuestionResult `json:"questions"`
+}
+
+type RunConfig struct {
+	TextbookID  int     `json:"textbook_id"`
+	TopK        int     `json:"top_k"`
+	Strategy    string  `json:"strategy,omitempty"`
+	Rerank      bool    `json:"rerank"`
+	Model       string  `json:"model"`
+	BaseURL     string  `json:"base_url,omitempty"`
+	Temperature float64 `json:"temperature"`
+}
+
+type Summary struct {
+	Questions        int      `json:"questions"`
+	Errors           int      `json:"errors"`
+	NotCovered       int      `json:"not_covered"`
+	RecallAtK        float64  `json:"recall_at_k"` // Of the top K retrieved, before the relevance threshold
+	MRR              float64  `json:"mrr"`
+	ThresholdMisses  int      `json:"threshold_misses"`            // Retrieved chunks on an expected page the threshold rejected
+	MissedNotCovered int      `json:"missed_not_covered"`          // not_covered answers although such a chunk was retrieved
+	CitationAccuracy *float64 `json:"citation_accuracy,omitempty"` // Cited chunks on an expected page / all citations
+	AnswerSimilarity *float64 `json:"answer_similarity,omitempty"` // Mean embedding similarity to the expected answers
+}
+
+type QuestionResult struct {
+	ID               string      `json:"id"`
+	Question         string      `json:"question"`
+	ExpectedPages    []int       `json:"expected_pages"`
+	RetrievedPages   []PageRange `json:"retrieved_pages"`
+	RecallAtK        float64     `json:"recall_at_k"`
+	ReciprocalRank   float64     `json:"reciprocal_rank"`
+	RelevantChunks   int         `json:"relevant_chunks"`  // Retrieved chunks within the relevance threshold
+	ThresholdMisses  int         `json:"threshold_misses"` // Retrieved chunks on an expected page outside the threshold
+	Citations        int         `json:"citations"`
+	CorrectCitations int         `json:"correct_citations"`
+	InvalidCitations int         `json:"invalid_citations"`
+	AnswerSimilarity *float64    `json:"answer_similarity,omitempty"`
+	AnswerMode       string      `json:"answer_mode,omitempty"`
+	Answer           string      `json:"answer,omitempty"`
+	Error            string      `json:"error,omitempty"`
+}
+
+type PageRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+func main() {
+	datasetPath := flag.String("dataset", "cmd/eval/testdata/golden.json", "golden dataset file")
+	outPath := flag.String("out", "", "write the JSON report here instead of stdout")
+	textbookID := flag.Int("textbook", 0, "textbook ID to evaluate (overrides the dataset)")
+	topK := flag.Int("top-k", services.DefaultTopK, "chunks to retrieve per question")
+	strategy := flag.String("strategy", "", "retrieval strategy: rewrite, multi_query or hyde")
+	rerank := flag.Bool("rerank", false, "rerank candidates (needs RERANKER)")
+	model := flag.String("model", "", "chat model (default CHAT_MODEL)")
+	baseURL := flag.String("base-url", "", "OpenAI-compatible chat provider URL (default CHAT_BASE_URL)")
+	temperature := flag.Float64("temperature", 0, "chat temperature")
+	flag.Parse()
+
+	// Load environment variables
+	if err := godotenv.Load("../.env"); err != nil {
+		if err := godotenv.Load(".env"); err != nil {
+			log.Println("Warning: Could not load .env file, using environment variables")
+		}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	// Provider flags override the configured chat provider
+	if *model != "" {
+		cfg.Chat.Model = *model
+	}
+	if *baseURL != "" {
+		cfg.Chat.BaseURL = *baseURL
+	}
+	cfg.Chat.Temperature = *temperature
+
+	if err := errors.Join(cfg.Database.Validate(), cfg.Embedding.Validate(), cfg.Chat.Validate(),
+		cfg.Retrieval.Validate(), cfg.Reranker.Validate(), cfg.Timeouts.Validate()); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	if !services.IsValidStrategy(*strategy) {
+		log.Fatalf("Unknown strategy %q", *strategy)
+	}
+	if *topK < 1 || *topK > services.MaxTopK {
+		log.Fatalf("-top-k must be between 1 and %d", services.MaxTopK)
+	}
+
+	dataset, err := loadDataset(*datasetPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := database.NewDB(cfg.Database)
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer db.Close()
+	if err := db.Ping(context.Background()); err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	textbook, err := findTextbook(db, dataset, *textbookID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Evaluating %d questions against textbook %d (%s)", len(dataset.Questions), textbook.ID, textbook.Title)
+
+	embeddingService := services.NewEmbeddingService(db, cfg.Embedding)
+	ragService := services.NewRAGService(db, embeddingService, services.NewReranker(cfg.Reranker), cfg)
+
+	report := Report{
+		Dataset: dataset.Name,
+		Config: RunConfig{
+			TextbookID:  textbook.ID,
+			TopK:        *topK,
+			Strategy:    *strategy,
+			Rerank:      *rerank,
+			Model:       cfg.Chat.Model,
+			BaseURL:     cfg.Chat.BaseURL,
+			Temperature: *temperature,
+		},
+	}
+
+	for _, golden := range dataset.Questions {
+		log.Printf("[%s] %s", golden.ID, golden.Question)
+
+		result := QuestionResult{
+			ID:             golden.ID,
+			Question:       golden.Question,
+			ExpectedPages:  golden.ExpectedPages,
+			RetrievedPages: []PageRange{},
+		}
+
+		resp, err := ragService.Query(context.Background(), models.QueryRequest{
+			Question:   golden.Question,
+			TextbookID: textbook.ID,
+			TopK:       *topK,
+			Rerank:     *rerank,
+			Strategy:   *strategy,
+			// Every run must generate its own answers
+			NoCache: true,
+		}, textbook.UserID)
+		if err != nil {
+			result.Error = err.Error()
+			report.Questions = append(report.Questions, result)
+			continue
+		}
+
+		if resp.Retrieval != nil {
+			scoreRetrieval(&result, resp.Retrieval.Ranked)
+		}
+		scoreCitations(&result, resp)
+		result.AnswerMode = resp.AnswerMode
+		result.Answer = resp.Answer
+
+		if golden.ExpectedAnswer != "" {
+			similarity, err := answerSimilarity(embeddingService, resp.Answer, golden.ExpectedAnswer)
+			if err != nil {
+				log.Printf("Failed to score answer similarity: %v", err)
+			} else {
+				result.AnswerSimilarity = &similarity
+			}
+		}
+
+		report.Questions = append(report.Questions, result)
+	}
+
+	report.Summary = summarize(report.Questions)
+
+	if err := writeReport(report, *outPath); err != nil {
+		log.Fatal(err)
+	}
+
+	s := report.Summary
+	log.Printf("recall@%d=%.3f mrr=%.3f errors=%d not_covered=%d threshold_misses=%d missed_not_covered=%d",
+		*topK, s.RecallAtK, s.MRR, s.Errors, s.NotCovered, s.ThresholdMisses, s.MissedNotCovered)
+}
+
+func loadDataset(path string) (*Dataset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dataset: %w", err)
+	}
+
+	var dataset Dataset
+	if err := json.Unmarshal(data, &dataset); err != nil {
+		return nil, fmt.Errorf("failed to parse dataset: %w", err)
+	}
+	if len(dataset.Questions) == 0 {
+		return nil, fmt.Errorf("dataset %s has no questions", path)
+	}
+	if dataset.Name == "" {
+		dataset.Name = filepath.Base(path)
+	}
+
+	return &dataset, nil
+}
+
+func findTextbook(db *database.DB, dataset *Dataset, id int) (*models.Textbook, error) {
+	if id == 0 {
+		id = dataset.Textbook.ID
+	}
+	if id != 0 {
+		return db.GetTextbook(context.Background(), id)
+	}
+	if dataset.Textbook.Title == "" {
+		return nil, fmt.Errorf("dataset has no textbook id or title; pass -textbook")
+	}
+
+	textbook, err := db.GetTextbookByTitle(context.Background(), dataset.Textbook.Title)
+	if err != nil {
+		return nil, fmt.Errorf("textbook %q not found (ingest %s first): %w", dataset.Textbook.Title, dataset.Textbook.Fixture, err)
+	}
+	return textbook, nil
+}
+
+// Recall@k is the share of expected pages covered by the top K retrieved
+// chunks; the reciprocal rank is 1/position of the first one on an expected
+// page. Both are scored before the relevance threshold, which is reported
+// separately.
+func scoreRetrieval(result *QuestionResult, ranked []models.RankedChunk) {
+	covered := make(map[int]bool)
+
+	for i, chunk := range ranked {
+		pageEnd := max(chunk.PageEnd, chunk.PageNumber)
+		result.RetrievedPages = append(result.RetrievedPages, PageRange{Start: chunk.PageNumber, End: pageEnd})
+		if chunk.Relevant {
+			result.RelevantChunks++
+		}
+
+		hit := false
+		for _, page := range result.ExpectedPages {
+			if page >= chunk.PageNumber && page <= pageEnd {
+				covered[page] = true
+				hit = true
+			}
+		}
+		if hit && !chunk.Relevant {
+			result.ThresholdMisses++
+		}
+		if hit && result.ReciprocalRank == 0 {
+			result.ReciprocalRank = round(1 / float64(i+1))
+		}
+	}
+
+	if len(result.ExpectedPages) > 0 {
+		result.RecallAtK = round(float64(len(covered)) / float64(len(result.ExpectedPages)))
+	}
+}
+
+// A citation is correct when the chunk it cites spans an expected page.
+// Citations the pipeline stripped as invalid count against accuracy.
+func scoreCitations(result *QuestionResult, resp *models.QueryResponse) {
+	result.InvalidCitations = len(resp.Invalid)
+	result.Citations = len(resp.Citations) + len(resp.Invalid)
+
+	for _, citation := range resp.Citations {
+		pageEnd := max(citation.PageEnd, citation.PageNumber)
+		for _, page := range result.ExpectedPages {
+			if page >= citation.PageNumber && page <= pageEnd {
+				result.CorrectCitations++
+				break
+			}
+		}
+	}
+}
+
+// Cosine similarity between the embeddings of the two answers
+func answerSimilarity(embeddingService *services.EmbeddingService, answer, expected string) (float64, error) {
+	embeddings, err := embeddingService.GenerateEmbeddings(context.Background(), []string{answer, expected})
+	if err != nil {
+		return 0, err
+	}
+	a, b := embeddings[0], embeddings[1]
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0, nil
+	}
+	return round(dot / (math.Sqrt(normA) * math.Sqrt(normB))), nil
+}
+
+func summarize(results []QuestionResult) Summary {
+	summary := Summary{Questions: len(results)}
+
+	var recall, mrr, similarity float64
+	var similarities, citations, correct int
+
+	for _, result := range results {
+		if result.Error != "" {
+			summary.Errors++
+			continue
+		}
+		if result.AnswerMode == services.AnswerModeNotCovered {
+			summary.NotCovered++
+			if result.ReciprocalRank > 0 {
+				summary.MissedNotCovered++
+			}
+		}
+		summary.ThresholdMisses += result.ThresholdMisses
+
+		recall += result.RecallAtK
+		mrr += result.ReciprocalRank
+		citations += result.Citations
+		correct += result.CorrectCitations
+
+		if result.AnswerSimilarity != nil {
+			similarity += *result.AnswerSimilarity
+			similarities++
+		}
+	}
+
+	// Errored questions count as misses so a broken run can't look better
+	if summary.Questions > 0 {
+		summary.RecallAtK = round(recall / float64(summary.Questions))
+		summary.MRR = round(mrr / float64(summary.Questions))
+	}
+	if citations > 0 {
+		accuracy := round(float64(correct) / float64(citations))
+		summary.CitationAccuracy = &accuracy
+	}
+	if similarities > 0 {
+		mean := round(similarity / float64(similarities))
+		summary.AnswerSimilarity = &mean
+	}
+
+	return summary
+}
+
+func writeReport(report Report, path string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	data = append(data, '\n')
+
+	if path == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	log.Printf("Wrote report to %s", path)
+	return nil
+}
+
+// Round to 4 decimals so reports don't churn on float noise
+func round(x float64) float64 {
+	return math.Round(x*10000) / 10000
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+	"github.com/jonkermoo/rag-textbook/backend/internal/services"
+)
+
+func TestLoadDataset(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		wantName string
+		wantErr  string
+	}{
+		{
+			name:     "named dataset",
+			contents: `{"name": "biology", "textbook": {"title": "Biology"}, "questions": [{"id": "q1", "question": "Why?", "expected_pages": [3]}]}`,
+			wantName: "biology",
+		},
+		{
+			name:     "name defaults to the file name",
+			contents: `{"textbook": {"id": 4}, "questions": [{"id": "q1", "question": "Why?", "expected_pages": [3]}]}`,
+			wantName: "dataset.json",
+		},
+		{
+			name:     "no questions",
+			contents: `{"name": "empty", "questions": []}`,
+			wantErr:  "has no questions",
+		},
+		{
+			name:     "malformed",
+			contents: `{"questions": [`,
+			wantErr:  "failed to parse dataset",
+		},
+		{
+			name:     "wrong types",
+			contents: `{"questions": [{"id": "q1", "expected_pages": "3"}]}`,
+			wantErr:  "failed to parse dataset",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "dataset.json")
+			if err := os.WriteFile(path, []byte(tt.contents), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			dataset, err := loadDataset(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadDataset() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadDataset() error = %v", err)
+			}
+			if dataset.Name != tt.wantName {
+				t.Errorf("name = %q, want %q", dataset.Name, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestLoadDatasetMissingFile(t *testing.T) {
+	if _, err := loadDataset(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("loadDataset() error = nil, want a read error")
+	}
+}
+
+// The shipped golden set must stay loadable and complete
+func TestGoldenDataset(t *testing.T) {
+	dataset, err := loadDataset("testdata/golden.json")
+	if err != nil {
+		t.Fatalf("loadDataset() error = %v", err)
+	}
+	if dataset.Textbook.Title == "" || dataset.Textbook.Fixture == "" {
+		t.Errorf("textbook = %+v, want a title and fixture", dataset.Textbook)
+	}
+	if _, err := os.Stat(filepath.Join("testdata", dataset.Textbook.Fixture)); err != nil {
+		t.Errorf("fixture: %v", err)
+	}
+
+	ids := make(map[string]bool)
+	for _, q := range dataset.Questions {
+		if q.ID == "" || q.Question == "" || len(q.ExpectedPages) == 0 {
+			t.Errorf("question %+v is missing an id, question or expected pages", q)
+		}
+		if ids[q.ID] {
+			t.Errorf("duplicate question id %q", q.ID)
+		}
+		ids[q.ID] = true
+	}
+}
+
+func TestScoreRetrieval(t *testing.T) {
+	chunk := func(page, pageEnd int, relevant bool) models.RankedChunk {
+		return models.RankedChunk{PageNumber: page, PageEnd: pageEnd, Relevant: relevant}
+	}
+
+	tests := []struct {
+		name     string
+		expected []int
+		ranked   []models.RankedChunk
+		recall   float64
+		rank     float64
+		relevant int
+		misses   int
+		pages    []PageRange
+	}{
+		{
+			name:     "first chunk is a hit",
+			expected: []int{3},
+			ranked:   []models.RankedChunk{chunk(3, 3, true), chunk(7, 7, true)},
+			recall:   1,
+			rank:     1,
+			relevant: 2,
+			pages:    []PageRange{{3, 3}, {7, 7}},
+		},
+		{
+			name:     "hit at position three",
+			expected: []int{5},
+			ranked:   []models.RankedChunk{chunk(1, 1, true), chunk(2, 2, true), chunk(4, 6, true)},
+			recall:   1,
+			rank:     0.3333,
+			relevant: 3,
+			pages:    []PageRange{{1, 1}, {2, 2}, {4, 6}},
+		},
+		{
+			name:     "partial recall",
+			expected: []int{2, 8, 9},
+			ranked:   []models.RankedChunk{chunk(8, 8, true), chunk(2, 2, true)},
+			recall:   0.6667,
+			rank:     1,
+			relevant: 2,
+			pages:    []PageRange{{8, 8}, {2, 2}},
+		},
+		{
+			name:     "hits outside the threshold still count, as threshold misses",
+			expected: []int{4, 9},
+			ranked:   []models.RankedChunk{chunk(1, 1, true), chunk(4, 4, false), chunk(9, 9, false)},
+			recall:   1,
+			rank:     0.5,
+			relevant: 1,
+			misses:   2,
+			pages:    []PageRange{{1, 1}, {4, 4}, {9, 9}},
+		},
+		{
+			name:     "missing page end counts as a single page",
+			expected: []int{4},
+			ranked:   []models.RankedChunk{chunk(4, 0, true)},
+			recall:   1,
+			rank:     1,
+			relevant: 1,
+			pages:    []PageRange{{4, 4}},
+		},
+		{
+			name:     "no hits",
+			expected: []int{10},
+			ranked:   []models.RankedChunk{chunk(1, 2, false)},
+			pages:    []PageRange{{1, 2}},
+		},
+		{
+			name:     "nothing retrieved",
+			expected: []int{10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := QuestionResult{ExpectedPages: tt.expected}
+			scoreRetrieval(&result, tt.ranked)
+
+			if result.RecallAtK != tt.recall || result.ReciprocalRank != tt.rank {
+				t.Errorf("recall = %v, rank = %v, want %v, %v", result.RecallAtK, result.ReciprocalRank, tt.recall, tt.rank)
+			}
+			if result.RelevantChunks != tt.relevant || result.ThresholdMisses != tt.misses {
+				t.Errorf("relevant = %d, threshold misses = %d, want %d, %d", result.RelevantChunks, result.ThresholdMisses, tt.relevant, tt.misses)
+			}
+			if !reflect.DeepEqual(result.RetrievedPages, tt.pages) {
+				t.Errorf("retrieved pages = %v, want %v", result.RetrievedPages, tt.pages)
+			}
+		})
+	}
+}
+
+func TestScoreCitations(t *testing.T) {
+	citation := func(page, pageEnd int) models.Citation {
+		return models.Citation{PageNumber: page, PageEnd: pageEnd}
+	}
+
+	tests := []struct {
+		name      string
+		citations []models.Citation
+		invalid   []int
+		total     int
+		correct   int
+	}{
+		{"all correct", []models.Citation{citation(3, 3), citation(2, 4)}, nil, 2, 2},
+		{"wrong page", []models.Citation{citation(3, 3), citation(9, 9)}, nil, 2, 1},
+		{"invalid citations count against accuracy", []models.Citation{citation(3, 3)}, []int{41, 42}, 3, 1},
+		{"none", nil, nil, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := QuestionResult{ExpectedPages: []int{3}}
+			scoreCitations(&result, &models.QueryResponse{Citations: tt.citations, Invalid: tt.invalid})
+
+			if result.Citations != tt.total || result.CorrectCitations != tt.correct || result.InvalidCitations != len(tt.invalid) {
+				t.Errorf("citations = %d, correct = %d, invalid = %d, want %d, %d, %d",
+					result.Citations, result.CorrectCitations, result.InvalidCitations, tt.total, tt.correct, len(tt.invalid))
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	similarity := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name    string
+		results []QuestionResult
+		want    Summary
+	}{
+		{
+			name: "no questions",
+			want: Summary{},
+		},
+		{
+			name: "means over every question",
+			results: []QuestionResult{
+				{RecallAtK: 1, ReciprocalRank: 1, Citations: 2, CorrectCitations: 2, AnswerSimilarity: similarity(0.9)},
+				{RecallAtK: 0.5, ReciprocalRank: 0.5, Citations: 2, CorrectCitations: 1, AnswerSimilarity: similarity(0.7)},
+			},
+			want: Summary{Questions: 2, RecallAtK: 0.75, MRR: 0.75, CitationAccuracy: similarity(0.75), AnswerSimilarity: similarity(0.8)},
+		},
+		{
+			name: "errors count as misses",
+			results: []QuestionResult{
+				{RecallAtK: 1, ReciprocalRank: 1},
+				{Error: "timeout", RecallAtK: 1, ReciprocalRank: 1},
+			},
+			want: Summary{Questions: 2, Errors: 1, RecallAtK: 0.5, MRR: 0.5},
+		},
+		{
+			name: "not covered answers are counted",
+			results: []QuestionResult{
+				{AnswerMode: services.AnswerModeNotCovered},
+				{RecallAtK: 1, ReciprocalRank: 0.5},
+				{RecallAtK: 0, ReciprocalRank: 0},
+			},
+			want: Summary{Questions: 3, NotCovered: 1, RecallAtK: 0.3333, MRR: 0.1667},
+		},
+		{
+			name: "threshold misses and not covered answers despite a hit",
+			results: []QuestionResult{
+				{AnswerMode: services.AnswerModeNotCovered, RecallAtK: 1, ReciprocalRank: 1, ThresholdMisses: 2},
+				{AnswerMode: services.AnswerModeNotCovered},
+				{RecallAtK: 1, ReciprocalRank: 1, ThresholdMisses: 1},
+			},
+			want: Summary{Questions: 3, NotCovered: 2, MissedNotCovered: 1, ThresholdMisses: 3, RecallAtK: 0.6667, MRR: 0.6667},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarize(tt.results); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("summarize() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		in, want float64
+	}{
+		{1.0 / 3, 0.3333},
+		{2.0 / 3, 0.6667},
+		{0.12345, 0.1235},
+		{1, 1},
+	}
+
+	for _, tt := range tests {
+		if got := round(tt.in); got != tt.want {
+			t.Errorf("round(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
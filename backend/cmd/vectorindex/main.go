@@ -0,0 +1,129 @@
+// Command vectorindex manages the per-dimension HNSW indexes on
+// chunk_embeddings:
+//
+//	go run ./cmd/vectorindex status
+//	go run ./cmd/vectorindex analyze
+//	go run ./cmd/vectorindex rebuild -dimensions 1536 -m 24 -ef-construction 128 -maintenance-work-mem 2GB
+//
+// Build parameters default to HNSW_M and HNSW_EF_CONSTRUCTION. The search
+// side (ef_search) is set per query by the API from HNSW_EF_SEARCH.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/config"
+	"github.com/jonkermoo/rag-textbook/backend/internal/database"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: vectorindex <status|analyze|rebuild> [flags]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	// Load environment variables
+	if err := godotenv.Load("../.env"); err != nil {
+		if err := godotenv.Load(".env"); err != nil {
+			log.Println("Warning: Could not load .env file, using environment variables")
+		}
+	}
+
+	cfg, err := config.Load()
+	if err == nil {
+		err = cfg.Database.Validate()
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	command, args := os.Args[1], os.Args[2:]
+
+	rebuildFlags := flag.NewFlagSet("rebuild", flag.ExitOnError)
+	dimensions := rebuildFlags.Int("dimensions", cfg.Embedding.Dimensions, "embedding dimension whose index to rebuild")
+	m := rebuildFlags.Int("m", cfg.Database.HNSWM, "max connections per graph node")
+	efConstruction := rebuildFlags.Int("ef-construction", cfg.Database.HNSWEfConstruction, "candidate list size while building")
+	workMem := rebuildFlags.String("maintenance-work-mem", "", "maintenance_work_mem for the build, e.g. 2GB")
+
+	if command == "rebuild" {
+		rebuildFlags.Parse(args)
+	}
+
+	db, err := database.NewDB(cfg.Database)
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer db.Close()
+	if err := db.Ping(context.Background()); err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	ctx := context.Background()
+
+	switch command {
+	case "status":
+		printStatus(db)
+
+	case "analyze":
+		if err := db.AnalyzeChunks(ctx); err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Analyzed chunks")
+		printStatus(db)
+
+	case "rebuild":
+		log.Printf("Rebuilding vector index for %d dimensions (m=%d, ef_construction=%d)...", *dimensions, *m, *efConstruction)
+		start := time.Now()
+		if err := db.RebuildVectorIndex(ctx, *dimensions, *m, *efConstruction, *workMem); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Rebuilt vector index in %s", time.Since(start).Round(time.Second))
+
+		if err := db.AnalyzeChunks(ctx); err != nil {
+			log.Fatal(err)
+		}
+		printStatus(db)
+
+	default:
+		usage()
+	}
+}
+
+func printStatus(db *database.DB) {
+	stats, err := db.GetVectorIndexStats(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("pgvector:     %s\n", stats.ExtensionVersion)
+	fmt.Printf("embeddings:   %d rows, %d textbooks searchable (%s)\n", stats.EmbeddingCount, stats.TextbookCount, stats.TableSize)
+	if len(stats.Indexes) == 0 {
+		fmt.Println("indexes:      none, no embeddings yet")
+	}
+	for _, index := range stats.Indexes {
+		fmt.Printf("%-13s %d embeddings\n", fmt.Sprintf("%d dims:", index.Dimensions), index.Embeddings)
+		if index.Definition == "" {
+			fmt.Printf("  index:      %s is missing, run: vectorindex rebuild -dimensions %d\n", index.Name, index.Dimensions)
+		} else {
+			fmt.Printf("  index:      %s (%s, %d scans)\n", index.Name, index.Size, index.Scans)
+			fmt.Printf("  definition: %s\n", index.Definition)
+		}
+	}
+	if stats.LastAnalyze.Valid {
+		fmt.Printf("analyzed:     %s\n", stats.LastAnalyze.Time.Format(time.RFC3339))
+	} else {
+		fmt.Println("analyzed:     never, run: vectorindex analyze")
+	}
+}
@@ -1,23 +1,31 @@
 import os
+import re
 from dotenv import load_dotenv
 
 load_dotenv('../.env')
 
 class TextChunker:
+    """Legacy fixed-size word chunker, one page at a time (CHUNKER=simple)"""
+
     def __init__(self):
         """Initialize with chunk settings from environment"""
         self.chunk_size = int(os.getenv('CHUNK_SIZE', 500))
         self.chunk_overlap = int(os.getenv('CHUNK_OVERLAP', 50))
         print(f"Chunker initialized (size={self.chunk_size}, overlap={self.chunk_overlap})")
     
-    def chunk_pages(self, pages):
+    def chunk_pages(self, pages, outline=None):
         """
         Split pages into chunks with overlap
+
+        pages: list of (page_number, text) or (page_number, text, location)
+        outline: ignored, kept for interface parity with StructuredChunker
         """
         chunks = []
         global_index = 0
         
-        for page_num, text in pages:
+        for page_num, text, *rest in pages:
+            location = rest[0] if rest else None
+
             # Split by words
             words = text.split()
             
@@ -31,6 +39,9 @@ class TextChunker:
                 chunks.append({
                     'content': chunk_text,
                     'page_number': page_num,
+                    'page_end': page_num,
+                    'location': location,
+                    'section_path': None,
                     'chunk_index': global_index
                 })
                 
@@ -44,4 +55,252 @@ class TextChunker:
                     break
         
         print(f"Created {len(chunks)} chunks")
-        return chunks
\ No newline at end of file
+        return chunks
+
+
+class TokenCounter:
+    """Counts tokens with the embedding model's tokenizer (tiktoken)"""
+
+    def __init__(self, encoding_name='cl100k_base'):
+        try:
+            import tiktoken
+            self.encoding = tiktoken.get_encoding(encoding_name)
+        except ImportError:
+            print("WARNING: tiktoken not installed, approximating 4 characters per token")
+            self.encoding = None
+
+    def count(self, text):
+        if self.encoding is None:
+            return max(1, len(text) // 4)
+        return len(self.encoding.encode(text, disallowed_special=()))
+
+    def split(self, text, max_tokens):
+        """Hard split a piece of text into windows of at most max_tokens"""
+        if self.encoding is None:
+            step = max_tokens * 4
+            return [text[i:i + step] for i in range(0, len(text), step)]
+        tokens = self.encoding.encode(text, disallowed_special=())
+        return [self.encoding.decode(tokens[i:i + max_tokens]) for i in range(0, len(tokens), max_tokens)]
+
+
+class StructuredChunker:
+    """
+    Structure-aware chunker
+
+    - Splits on paragraph and sentence boundaries instead of raw words
+    - Sizes chunks in tokens (same tokenizer as the embedding model)
+    - Lets chunks span page breaks and records the page range
+    - Starts a new chunk at every heading and stores the section path
+      ("Chapter 4 > 4.2 Eigenvalues") on each chunk
+    """
+
+    sentence_pattern = re.compile(r'(?<=[.!?])\s+(?=[A-Z0-9"\'(\[])')
+
+    def __init__(self):
+        """Initialize with chunk settings from environment"""
+        self.chunk_tokens = int(os.getenv('CHUNK_TOKENS', 400))
+        self.overlap_tokens = int(os.getenv('CHUNK_OVERLAP_TOKENS', 50))
+        # Sections smaller than this are merged into the next one instead of
+        # producing a tiny chunk (e.g. a chapter title followed by a subsection)
+        self.min_chunk_tokens = int(os.getenv('CHUNK_MIN_TOKENS', 50))
+        self.tokens = TokenCounter()
+        print(f"Structured chunker initialized (tokens={self.chunk_tokens}, overlap={self.overlap_tokens})")
+
+    def chunk_pages(self, pages, outline=None):
+        """
+        Split a document into chunks along its structure
+
+        pages: list of (page_number, text, location)
+        outline: list of (level, title, page_number) headings in document order
+        """
+        paragraphs = self._paragraphs(pages, outline or [])
+
+        chunks = []
+        current = []
+        current_tokens = 0
+        current_section = None
+
+        def flush():
+            nonlocal current, current_tokens
+            if current:
+                chunks.append(self._make_chunk(current, current_section, len(chunks)))
+            current = []
+            current_tokens = 0
+
+        for para in paragraphs:
+            if para['section'] != current_section:
+                if current_tokens >= self.min_chunk_tokens:
+                    flush()
+                current_section = para['section']
+
+            for piece in self._fit(para['text']):
+                piece_tokens = self.tokens.count(piece)
+
+                if current and current_tokens + piece_tokens > self.chunk_tokens:
+                    overlap = self._overlap(current)
+                    flush()
+                    current = overlap
+                    current_tokens = sum(p['tokens'] for p in overlap)
+
+                current.append({
+                    'text': piece,
+                    'page': para['page'],
+                    'location': para['location'],
+                    'tokens': piece_tokens
+                })
+                current_tokens += piece_tokens
+
+        flush()
+
+        print(f"Created {len(chunks)} chunks")
+        return chunks
+
+    def _paragraphs(self, pages, outline):
+        """Flatten pages into paragraphs tagged with page, location and section path"""
+        headings_by_page = {}
+        for level, title, page in outline:
+            headings_by_page.setdefault(page, []).append((level, title))
+
+        outline_pages = sorted(headings_by_page)
+        stack = []
+        paragraphs = []
+        next_heading = 0
+
+        for page_num, text, *rest in pages:
+            location = rest[0] if rest else None
+
+            # Apply headings from pages we skipped (e.g. blank divider pages)
+            while next_heading < len(outline_pages) and outline_pages[next_heading] < page_num:
+                for level, title in headings_by_page[outline_pages[next_heading]]:
+                    stack = stack[:max(level - 1, 0)] + [title]
+                next_heading += 1
+
+            pending = headings_by_page.get(page_num, [])
+            page_paragraphs = split_paragraphs(text, [title for _, title in pending])
+            if next_heading < len(outline_pages) and outline_pages[next_heading] == page_num:
+                next_heading += 1
+
+            # Headings whose title opens a paragraph take effect there,
+            # the rest apply from the top of the page
+            anchored = {}
+            for level, title in pending:
+                index = _find_heading(page_paragraphs, title)
+                if index is None:
+                    stack = stack[:max(level - 1, 0)] + [title]
+                else:
+                    anchored.setdefault(index, []).append((level, title))
+
+            for i, para in enumerate(page_paragraphs):
+                for level, title in anchored.get(i, []):
+                    stack = stack[:max(level - 1, 0)] + [title]
+                paragraphs.append({
+                    'text': para,
+                    'page': page_num,
+                    'location': location,
+                    'section': ' > '.join(stack) if stack else None
+                })
+
+        return paragraphs
+
+    def _fit(self, text):
+        """Break a paragraph into pieces that fit in a chunk: sentences, then hard token splits"""
+        if self.tokens.count(text) <= self.chunk_tokens:
+            return [text]
+
+        pieces = []
+        for sentence in self.sentence_pattern.split(text):
+            if self.tokens.count(sentence) <= self.chunk_tokens:
+                pieces.append(sentence)
+            else:
+                pieces.extend(self.tokens.split(sentence, self.chunk_tokens))
+        return pieces
+
+    def _overlap(self, pieces):
+        """Trailing pieces (up to overlap_tokens) carried into the next chunk"""
+        carried = []
+        total = 0
+        for piece in reversed(pieces):
+            if total + piece['tokens'] > self.overlap_tokens:
+                break
+            carried.insert(0, piece)
+            total += piece['tokens']
+        # Never carry the whole chunk, or we would loop on the same content
+        return carried if len(carried) < len(pieces) else []
+
+    def _make_chunk(self, pieces, section, index):
+        page_start = pieces[0]['page']
+        page_end = pieces[-1]['page']
+
+        location = pieces[0]['location']
+        if page_end != page_start and location == f"Page {page_start}":
+            location = f"Pages {page_start}-{page_end}"
+
+        return {
+            'content': '\n\n'.join(p['text'] for p in pieces),
+            'page_number': page_start,
+            'page_end': page_end,
+            'location': location,
+            'section_path': section,
+            'chunk_index': index
+        }
+
+
+def get_chunker():
+    """Pick the chunker from the CHUNKER environment variable (structured or simple)"""
+    if os.getenv('CHUNKER', 'structured').lower() == 'simple':
+        return TextChunker()
+    return StructuredChunker()
+
+
+def split_paragraphs(text, headings=None):
+    """
+    Split extracted text into paragraphs. Blank lines are used when present;
+    PDF text layers often have none, so fall back to lines that end a sentence.
+    Lines matching a known heading always start a new paragraph.
+    """
+    heading_keys = {_normalize(h) for h in headings or []}
+
+    blocks = [b for b in re.split(r'\n\s*\n', text) if b.strip()]
+    if len(blocks) <= 1:
+        blocks = []
+        current = []
+        for line in text.splitlines():
+            line = line.strip()
+            if not line:
+                continue
+            if _normalize(line) in heading_keys:
+                if current:
+                    blocks.append(' '.join(current))
+                blocks.append(line)
+                current = []
+                continue
+            current.append(line)
+            if re.search(r'[.!?:"\')]$', line):
+                blocks.append(' '.join(current))
+                current = []
+        if current:
+            blocks.append(' '.join(current))
+
+    # Re-join hyphenated line breaks and collapse whitespace inside paragraphs
+    result = []
+    for block in blocks:
+        block = re.sub(r'(\w)-\n(\w)', r'\1\2', block)
+        block = re.sub(r'\s+', ' ', block).strip()
+        if block:
+            result.append(block)
+    return result
+
+
+def _find_heading(paragraphs, title):
+    """Index of the first paragraph starting with the heading title, if any"""
+    needle = _normalize(title)
+    if not needle:
+        return None
+    for i, para in enumerate(paragraphs):
+        if _normalize(para[:len(title) + 20]).startswith(needle):
+            return i
+    return None
+
+
+def _normalize(text):
+    return re.sub(r'\W+', ' ', text).strip().lower()
@@ -35,15 +35,94 @@ class Database:
             print(f"Created textbook with ID: {textbook_id}")
             return textbook_id
     
-    def insert_chunk(self, textbook_id, content, page_number, chunk_index, embedding):
+    def create_embedding_generation(self, textbook_id, model, dimensions, chunk_count):
         """
-        Insert a text chunk with its embedding
+        Start a new embedding generation for a textbook; it becomes searchable
+        once activated. Only one generation per textbook can be building, so
+        one left behind by an interrupted run (or a re-embed of the content
+        being replaced) is marked failed.
+        Returns: generation_id
         """
         with self.conn.cursor() as cur:
             cur.execute("""
-                INSERT INTO chunks (textbook_id, content, page_number, chunk_index, embedding)
-                VALUES (%s, %s, %s, %s, %s)
-            """, (textbook_id, content, page_number, chunk_index, embedding))
+                UPDATE embedding_generations
+                SET status = 'failed', error = 'Superseded by a new ingestion'
+                WHERE textbook_id = %s AND status = 'building'
+            """, (textbook_id,))
+            cur.execute("""
+                INSERT INTO embedding_generations (textbook_id, model, dimensions, status, chunk_count)
+                VALUES (%s, %s, %s, 'building', %s)
+                RETURNING id
+            """, (textbook_id, model, dimensions, chunk_count))
+            generation_id = cur.fetchone()[0]
+            self.conn.commit()
+            print(f"Created embedding generation {generation_id} ({model}, {dimensions} dimensions)")
+            return generation_id
+
+    def activate_embedding_generation(self, generation_id):
+        """
+        Make a building generation the textbook's active one. The previous
+        active generation is kept as retired; older retired ones are deleted.
+        """
+        with self.conn.cursor() as cur:
+            cur.execute("""
+                DELETE FROM embedding_generations
+                WHERE status = 'retired'
+                  AND textbook_id = (SELECT textbook_id FROM embedding_generations WHERE id = %s)
+            """, (generation_id,))
+            cur.execute("""
+                UPDATE embedding_generations SET status = 'retired'
+                WHERE status = 'active'
+                  AND textbook_id = (SELECT textbook_id FROM embedding_generations WHERE id = %s)
+            """, (generation_id,))
+            cur.execute("""
+                UPDATE embedding_generations
+                SET status = 'active', activated_at = CURRENT_TIMESTAMP, error = NULL,
+                    embedded_count = (SELECT COUNT(*) FROM chunk_embeddings WHERE generation_id = %s)
+                WHERE id = %s AND status = 'building'
+            """, (generation_id, generation_id))
+            if cur.rowcount == 0:
+                self.conn.rollback()
+                raise RuntimeError(f"Embedding generation {generation_id} is not building")
+            # Cached answers were generated from the previous content
+            cur.execute("""
+                DELETE FROM answer_cache
+                WHERE textbook_id = (SELECT textbook_id FROM embedding_generations WHERE id = %s)
+            """, (generation_id,))
+            self.conn.commit()
+
+    def insert_chunk(self, textbook_id, content, page_number, chunk_index, embedding, generation_id,
+                     location=None, ocr_confidence=None, page_end=None, section_path=None):
+        """
+        Insert a text chunk and its embedding for an embedding generation
+        location: citation label such as "Slide 4" or a section heading
+        ocr_confidence: 0..1 when the text came from OCR, None otherwise
+        page_end: last page the chunk spans (defaults to page_number)
+        section_path: heading path such as "Chapter 4 > 4.2 Eigenvalues"
+        """
+        with self.conn.cursor() as cur:
+            cur.execute("""
+                INSERT INTO chunks (textbook_id, content, page_number, page_end, chunk_index,
+                                    location, ocr_confidence, section_path)
+                VALUES (%s, %s, %s, %s, %s, %s, %s, %s)
+                RETURNING id
+            """, (textbook_id, content, page_number, page_end or page_number, chunk_index,
+                  location, ocr_confidence, section_path))
+            chunk_id = cur.fetchone()[0]
+            cur.execute("""
+                INSERT INTO chunk_embeddings (generation_id, chunk_id, dimensions, embedding)
+                VALUES (%s, %s, %s, %s)
+            """, (generation_id, chunk_id, len(embedding), embedding))
+            self.conn.commit()
+
+    def update_page_stats(self, textbook_id, page_count, ocr_page_count, dropped_page_count):
+        """Record how many pages were extracted, OCR'd or dropped"""
+        with self.conn.cursor() as cur:
+            cur.execute("""
+                UPDATE textbooks
+                SET page_count = %s, ocr_page_count = %s, dropped_page_count = %s
+                WHERE id = %s
+            """, (page_count, ocr_page_count, dropped_page_count, textbook_id))
             self.conn.commit()
     
     def mark_textbook_processed(self, textbook_id):
@@ -55,6 +134,28 @@ class Database:
             self.conn.commit()
             print(f"Marked textbook {textbook_id} as processed")
     
+    def replace_sections(self, textbook_id, sections):
+        """
+        Store the document outline, replacing any previous one
+        sections: output of outline.build_sections()
+        """
+        with self.conn.cursor() as cur:
+            cur.execute("DELETE FROM sections WHERE textbook_id = %s", (textbook_id,))
+
+            ids = []
+            for position, section in enumerate(sections):
+                parent_id = ids[section['parent']] if section['parent'] is not None else None
+                cur.execute("""
+                    INSERT INTO sections (textbook_id, parent_id, level, title, page_start, page_end, position)
+                    VALUES (%s, %s, %s, %s, %s, %s, %s)
+                    RETURNING id
+                """, (textbook_id, parent_id, section['level'], section['title'][:500],
+                      section['page_start'], section['page_end'], position))
+                ids.append(cur.fetchone()[0])
+
+            self.conn.commit()
+            print(f"Stored {len(sections)} sections")
+
     def close(self):
         """Close database connection"""
         self.conn.close()
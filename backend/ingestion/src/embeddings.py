@@ -10,21 +10,32 @@ class EmbeddingsGenerator:
         """Initialize OpenAI client"""
         # Create httpx client without proxies to avoid compatibility issues
         http_client = httpx.Client(verify=False)
+        # EMBEDDING_BASE_URL points at any OpenAI-compatible server (e.g. a local model)
         self.client = OpenAI(
-            api_key=os.getenv('OPENAI_API_KEY'),
+            api_key=os.getenv('EMBEDDING_API_KEY') or os.getenv('OPENAI_API_KEY'),
+            base_url=os.getenv('EMBEDDING_BASE_URL') or None,
             http_client=http_client
         )
-        self.model = "text-embedding-3-small"
+        self.model = os.getenv('EMBEDDING_MODEL', 'text-embedding-3-small')
+        # Requested output size; only text-embedding-3 models can shorten vectors
+        dimensions = os.getenv('EMBEDDING_DIMENSIONS')
+        self.dimensions = int(dimensions) if dimensions else None
         print(f"Embeddings generator initialized (model={self.model})")
+
+    def _request_options(self):
+        if self.dimensions and self.model.startswith('text-embedding-3'):
+            return {'dimensions': self.dimensions}
+        return {}
     
     def generate_embedding(self, text):
         """
         Generate embedding for a single text
-        Returns: List of 1536 floats
+        Returns: List of floats (1536 for the default model)
         """
         response = self.client.embeddings.create(
             model=self.model,
-            input=text
+            input=text,
+            **self._request_options()
         )
         return response.data[0].embedding
     
@@ -39,7 +50,8 @@ class EmbeddingsGenerator:
             
             response = self.client.embeddings.create(
                 model=self.model,
-                input=batch
+                input=batch,
+                **self._request_options()
             )
             
             batch_embeddings = [item.embedding for item in response.data]
@@ -0,0 +1,336 @@
+import os
+import re
+import zipfile
+from abc import ABC, abstractmethod
+
+from pdf_parser import PDFParser
+
+
+class DocumentExtractor(ABC):
+    """
+    Common interface for all document formats.
+
+    extract() returns a list of tuples (page_number, text, location) where
+    page_number is the page, slide or section ordinal (1-based) and location
+    is a human readable label used for citations ("Page 12", "Slide 4",
+    "Chapter 2 > Eigenvalues").
+    """
+
+    def __init__(self, path):
+        self.path = path
+
+        # Ingestion stats, filled in by extract()
+        self.page_count = 0
+        self.ocr_pages = []
+        self.dropped_pages = []
+        # page_number -> OCR confidence (0..1) for pages recovered by OCR
+        self.ocr_confidence = {}
+
+    @abstractmethod
+    def extract(self):
+        pass
+
+    def ocr_confidence_for(self, page_start, page_end=None):
+        """Lowest OCR confidence across a page range, None if no page was OCR'd"""
+        pages = range(page_start, (page_end or page_start) + 1)
+        scores = [self.ocr_confidence[p] for p in pages if p in self.ocr_confidence]
+        return min(scores) if scores else None
+
+    def outline(self):
+        """
+        Headings found in the document, in order
+        Returns: List of tuples (level, title, page_number)
+        """
+        return []
+
+
+class PdfExtractor(DocumentExtractor):
+    """PDF pages via PyPDF2"""
+
+    def __init__(self, path):
+        super().__init__(path)
+        self.parser = PDFParser(path)
+
+    def outline(self):
+        return self.parser.extract_outline()
+
+    def extract(self):
+        parser = self.parser
+        pages = parser.extract_text()
+
+        self.page_count = parser.page_count()
+        self.ocr_pages = parser.ocr_pages
+        self.dropped_pages = parser.dropped_pages
+        self.ocr_confidence = parser.ocr_confidence
+
+        return [(page_num, text, f"Page {page_num}") for page_num, text in pages]
+
+
+class _SectionedExtractor(DocumentExtractor):
+    """Base for formats without pages; sections (or slides) are numbered in reading order"""
+
+    def __init__(self, path):
+        super().__init__(path)
+        self.headings = []
+
+    def outline(self):
+        return self.headings
+
+
+class DocxExtractor(_SectionedExtractor):
+    """Word documents, split into sections on heading styles"""
+
+    def extract(self):
+        from docx import Document
+        from docx.oxml.ns import qn
+        from docx.table import Table
+        from docx.text.paragraph import Paragraph
+
+        document = Document(self.path)
+        builder = _SectionBuilder()
+
+        # Paragraphs and tables in body order, so each table lands in the
+        # section it appears in
+        for element in document.element.body.iterchildren():
+            if element.tag == qn("w:p"):
+                paragraph = Paragraph(element, document)
+                text = paragraph.text.strip()
+                if not text:
+                    continue
+                style = (paragraph.style.name or "").lower() if paragraph.style else ""
+                if style.startswith("heading") or style == "title":
+                    builder.heading(text, _heading_level(style))
+                else:
+                    builder.add(text)
+            elif element.tag == qn("w:tbl"):
+                for row in Table(element, document).rows:
+                    cells = [cell.text.strip() for cell in row.cells if cell.text.strip()]
+                    if cells:
+                        builder.add(" | ".join(cells))
+
+        sections = builder.finish()
+        print(f"Extracted {len(sections)} sections from DOCX")
+        self.page_count = len(sections)
+        self.headings = builder.headings
+        return sections
+
+
+class PptxExtractor(_SectionedExtractor):
+    """PowerPoint decks, one entry per slide including speaker notes"""
+
+    def extract(self):
+        from pptx import Presentation
+
+        presentation = Presentation(self.path)
+        slides = []
+
+        for i, slide in enumerate(presentation.slides, start=1):
+            parts = []
+            title = None
+
+            for shape in slide.shapes:
+                if not shape.has_text_frame:
+                    continue
+                text = shape.text_frame.text.strip()
+                if not text:
+                    continue
+                if title is None and shape == slide.shapes.title:
+                    title = text
+                parts.append(text)
+
+            if slide.has_notes_slide:
+                notes = slide.notes_slide.notes_text_frame.text.strip()
+                if notes:
+                    parts.append(f"Notes: {notes}")
+
+            if not parts:
+                continue
+
+            location = f"Slide {i}" if not title else f"Slide {i}: {title}"
+            slides.append((i, "\n".join(parts), location))
+            if title:
+                self.headings.append((1, title, i))
+
+        self.page_count = len(presentation.slides)
+        print(f"Extracted text from {len(slides)} slides")
+        return slides
+
+
+class HtmlExtractor(_SectionedExtractor):
+    """HTML pages, split into sections on h1-h6 headings"""
+
+    def extract(self):
+        with open(self.path, "rb") as f:
+            html = f.read()
+
+        builder = _html_sections(html, _SectionBuilder())
+        sections = builder.finish()
+        print(f"Extracted {len(sections)} sections from HTML")
+        self.page_count = len(sections)
+        self.headings = builder.headings
+        return sections
+
+
+class MarkdownExtractor(_SectionedExtractor):
+    """Markdown files, split into sections on ATX headings"""
+
+    heading_pattern = re.compile(r"^(#{1,6})\s+(.*?)\s*#*\s*$")
+
+    def extract(self):
+        with open(self.path, encoding="utf-8", errors="replace") as f:
+            lines = f.read().splitlines()
+
+        builder = _SectionBuilder()
+        paragraph = []
+        in_code = False
+
+        for line in lines:
+            if line.strip().startswith("```"):
+                in_code = not in_code
+            match = None if in_code else self.heading_pattern.match(line)
+            if match:
+                builder.add(" ".join(paragraph))
+                paragraph = []
+                builder.heading(match.group(2), len(match.group(1)))
+            elif not line.strip() and not in_code:
+                builder.add(" ".join(paragraph))
+                paragraph = []
+            else:
+                paragraph.append(line.strip())
+
+        builder.add(" ".join(paragraph))
+        sections = builder.finish()
+        print(f"Extracted {len(sections)} sections from Markdown")
+        self.page_count = len(sections)
+        self.headings = builder.headings
+        return sections
+
+
+class EpubExtractor(_SectionedExtractor):
+    """EPUB books, reading XHTML documents in spine order"""
+
+    def extract(self):
+        builder = _SectionBuilder()
+
+        with zipfile.ZipFile(self.path) as book:
+            for name in _epub_spine(book):
+                try:
+                    html = book.read(name)
+                except KeyError:
+                    continue
+                _html_sections(html, builder)
+
+        sections = builder.finish()
+        print(f"Extracted {len(sections)} sections from EPUB")
+        self.page_count = len(sections)
+        self.headings = builder.headings
+        return sections
+
+
+EXTRACTORS = {
+    ".pdf": PdfExtractor,
+    ".docx": DocxExtractor,
+    ".pptx": PptxExtractor,
+    ".html": HtmlExtractor,
+    ".htm": HtmlExtractor,
+    ".md": MarkdownExtractor,
+    ".markdown": MarkdownExtractor,
+    ".epub": EpubExtractor,
+}
+
+
+def get_extractor(path):
+    """Pick the extractor for a file based on its extension"""
+    ext = os.path.splitext(path)[1].lower()
+    extractor = EXTRACTORS.get(ext)
+    if extractor is None:
+        raise ValueError(f"Unsupported document format: {ext or path}")
+    return extractor(path)
+
+
+class _SectionBuilder:
+    """
+    Collects paragraphs under the current heading path and emits one
+    (ordinal, text, location) tuple per non-empty section
+    """
+
+    def __init__(self):
+        self.sections = []
+        self.path = []
+        self.paragraphs = []
+        # (level, title, ordinal of the section the heading opens)
+        self.headings = []
+
+    def heading(self, text, level):
+        self._flush()
+        self.path = self.path[:max(level - 1, 0)] + [text]
+        self.headings.append((level, text, len(self.sections) + 1))
+
+    def add(self, text):
+        if text and text.strip():
+            self.paragraphs.append(text.strip())
+
+    def finish(self):
+        self._flush()
+        return self.sections
+
+    def _flush(self):
+        if not self.paragraphs:
+            return
+        ordinal = len(self.sections) + 1
+        location = " > ".join(self.path) if self.path else f"Section {ordinal}"
+        self.sections.append((ordinal, "\n\n".join(self.paragraphs), location))
+        self.paragraphs = []
+
+
+def _heading_level(style):
+    if style == "title":
+        return 1
+    digits = "".join(ch for ch in style if ch.isdigit())
+    return int(digits) if digits else 1
+
+
+def _html_sections(html, builder):
+    from bs4 import BeautifulSoup
+
+    soup = BeautifulSoup(html, "html.parser")
+    # <header> is kept: EPUB chapters often put their <h1> in one
+    for tag in soup(["script", "style", "nav", "footer"]):
+        tag.decompose()
+
+    headings = ("h1", "h2", "h3", "h4", "h5", "h6")
+    body = soup.body or soup
+    for element in body.find_all([*headings, "p", "li", "pre", "td", "blockquote"]):
+        # Skip containers whose text is already emitted by a nested element
+        if element.find(["p", "li", "pre"]):
+            continue
+        text = element.get_text(" ", strip=True)
+        if element.name in headings:
+            if text:
+                builder.heading(text, int(element.name[1]))
+        else:
+            builder.add(text)
+
+    return builder
+
+
+def _epub_spine(book):
+    """Return the XHTML documents of an EPUB in reading order"""
+    from xml.etree import ElementTree
+
+    container = ElementTree.fromstring(book.read("META-INF/container.xml"))
+    rootfile = container.find(".//{*}rootfile").get("full-path")
+    base = os.path.dirname(rootfile)
+
+    opf = ElementTree.fromstring(book.read(rootfile))
+    manifest = {
+        item.get("id"): item.get("href")
+        for item in opf.iterfind(".//{*}manifest/{*}item")
+    }
+
+    names = []
+    for itemref in opf.iterfind(".//{*}spine/{*}itemref"):
+        href = manifest.get(itemref.get("idref"))
+        if href:
+            names.append(os.path.normpath(os.path.join(base, href)).replace(os.sep, "/"))
+    return names
@@ -1,12 +1,14 @@
+import os
 import sys
 from database import Database
-from pdf_parser import PDFParser
-from chunker import TextChunker
+from extractors import get_extractor
+from chunker import get_chunker
+from outline import build_sections
 from embeddings import EmbeddingsGenerator
 
-def process_pdf(pdf_path, user_id, title):
+def process_pdf(doc_path, user_id, title):
     """
-    pdf_path: Path to PDF file
+    doc_path: Path to document file (PDF, EPUB, DOCX, PPTX, Markdown or HTML)
     user_id: User who uploaded the textbook
     title: Title of the textbook
     """
@@ -16,25 +18,34 @@ def process_pdf(pdf_path, user_id, title):
     
     # Initialize components
     db = Database()
-    parser = PDFParser(pdf_path)
-    chunker = TextChunker()
+    extractor = get_extractor(doc_path)
+    chunker = get_chunker()
     embedder = EmbeddingsGenerator()
     
     try:
         # Create textbook entry in database
         # S3 dummy key for now
-        s3_key = f"textbooks/user{user_id}/{title}.pdf"
+        s3_key = f"textbooks/user{user_id}/{title}{os.path.splitext(doc_path)[1].lower()}"
         textbook_id = db.create_textbook(user_id, title, s3_key)
         
-        # Extract text from PDF
-        pages = parser.extract_text()
+        # Extract text from the document
+        pages = extractor.extract()
+
+        # Record OCR/dropped page counts so the status endpoint can report them
+        db.update_page_stats(
+            textbook_id,
+            extractor.page_count,
+            len(extractor.ocr_pages),
+            len(extractor.dropped_pages)
+        )
         
         if not pages:
-            print("No text found in PDF")
+            print("No text found in document")
             return
         
         # Chunk the text
-        chunks = chunker.chunk_pages(pages)
+        outline = extractor.outline()
+        chunks = chunker.chunk_pages(pages, outline)
         
         if not chunks:
             print("No chunks created")
@@ -44,6 +55,11 @@ def process_pdf(pdf_path, user_id, title):
         print(f"\nGenerating embeddings for {len(chunks)} chunks...")
         chunk_texts = [chunk['content'] for chunk in chunks]
         embeddings = embedder.generate_batch(chunk_texts, batch_size=50)
+
+        # Record which model produced the vectors so queries embed the same way
+        generation_id = db.create_embedding_generation(
+            textbook_id, embedder.model, len(embeddings[0]), len(chunks)
+        )
         
         # Insert chunks into database
         print(f"\nStoring chunks in database...")
@@ -53,7 +69,12 @@ def process_pdf(pdf_path, user_id, title):
                 content=chunk['content'],
                 page_number=chunk['page_number'],
                 chunk_index=chunk['chunk_index'],
-                embedding=embedding
+                embedding=embedding,
+                generation_id=generation_id,
+                location=chunk['location'],
+                page_end=chunk['page_end'],
+                section_path=chunk['section_path'],
+                ocr_confidence=extractor.ocr_confidence_for(chunk['page_number'], chunk['page_end'])
             )
             
             # Progress indicator
@@ -61,8 +82,12 @@ def process_pdf(pdf_path, user_id, title):
                 print(f"  Stored {i + 1}/{len(chunks)} chunks")
         
         print(f"Stored all {len(chunks)} chunks")
+
+        # Store the table of contents with page ranges
+        db.replace_sections(textbook_id, build_sections(outline, extractor.page_count))
         
         # Mark textbook as processed
+        db.activate_embedding_generation(generation_id)
         db.mark_textbook_processed(textbook_id)
         
         print(f"\n{'='*60}")
@@ -71,6 +96,8 @@ def process_pdf(pdf_path, user_id, title):
         print(f"Textbook ID: {textbook_id}")
         print(f"Total chunks: {len(chunks)}")
         print(f"Total pages: {len(pages)}")
+        print(f"OCR pages: {len(extractor.ocr_pages)}")
+        print(f"Dropped pages: {len(extractor.dropped_pages)}")
         print(f"\n")
         
     except Exception as e:
@@ -82,15 +109,15 @@ def process_pdf(pdf_path, user_id, title):
 
 def main():
     if len(sys.argv) < 4:
-        print("Usage: python main.py <pdf_path> <user_id> <title>")
+        print("Usage: python main.py <doc_path> <user_id> <title>")
         print("Example: python main.py ../test_data/calculus.pdf 1 'Calculus 101'")
         sys.exit(1)
     
-    pdf_path = sys.argv[1]
+    doc_path = sys.argv[1]
     user_id = int(sys.argv[2])
     title = sys.argv[3]
     
-    process_pdf(pdf_path, user_id, title)
+    process_pdf(doc_path, user_id, title)
 
 if __name__ == "__main__":
     main()
\ No newline at end of file
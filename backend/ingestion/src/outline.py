@@ -0,0 +1,34 @@
+def build_sections(outline, page_count):
+    """
+    Turn a flat outline into sections with page ranges and parents
+
+    outline: list of (level, title, page_number) in document order
+    page_count: last page (or section ordinal) of the document
+    Returns: list of dicts with level, title, page_start, page_end, parent
+             (index of the parent section in the list, or None)
+    """
+    sections = []
+    stack = []
+
+    for level, title, page in outline:
+        while stack and sections[stack[-1]]['level'] >= level:
+            stack.pop()
+
+        sections.append({
+            'level': level,
+            'title': title,
+            'page_start': page,
+            'page_end': page_count or page,
+            'parent': stack[-1] if stack else None
+        })
+        stack.append(len(sections) - 1)
+
+    # A section runs until the next heading at the same or a higher level
+    for i, section in enumerate(sections):
+        for following in sections[i + 1:]:
+            if following['level'] <= section['level']:
+                next_page = following['page_start']
+                section['page_end'] = next_page - 1 if next_page > section['page_start'] else section['page_start']
+                break
+
+    return sections
@@ -1,26 +1,211 @@
+import os
 from PyPDF2 import PdfReader
+from dotenv import load_dotenv
+
+load_dotenv('../.env')
 
 class PDFParser:
     def __init__(self, pdf_path):
         """Initialize with path to PDF file"""
         self.pdf_path = pdf_path
         self.reader = PdfReader(pdf_path)
+
+        # OCR fallback for scanned pages (requires tesseract + poppler locally)
+        self.ocr_enabled = os.getenv('OCR_ENABLED', 'true').lower() == 'true'
+        self.ocr_language = os.getenv('OCR_LANGUAGE', 'eng')
+        self.ocr_dpi = int(os.getenv('OCR_DPI', 300))
+        # Pages with less extracted text than this are treated as possibly scanned
+        self.min_text_chars = int(os.getenv('OCR_MIN_TEXT_CHARS', 20))
+
+        # Filled in by extract_text()
+        self.ocr_confidence = {}
+        self.ocr_pages = []
+        self.dropped_pages = []
+
         print(f"Loaded PDF: {pdf_path} ({len(self.reader.pages)} pages)")
-    
+
     def extract_text(self):
         """
-        Extract text from all pages
+        Extract text from all pages, running OCR on image-only pages
         Returns: List of tuples (page_number, text)
         """
         pages = []
+        self.ocr_confidence = {}
+        self.ocr_pages = []
+        self.dropped_pages = []
+
         for i, page in enumerate(self.reader.pages, start=1):
-            text = page.extract_text()
-            if text.strip():  # Only include pages with text
+            text = page.extract_text() or ''
+
+            if len(text.strip()) >= self.min_text_chars:
                 pages.append((i, text))
-        
+                continue
+
+            # Little or no text layer: if the page carries images it is most
+            # likely a scan, so try OCR before giving up on it
+            if self.ocr_enabled and self._has_images(page):
+                ocr_text, confidence = self._ocr_page(i)
+                if len(ocr_text.strip()) > len(text.strip()):
+                    pages.append((i, ocr_text))
+                    self.ocr_confidence[i] = confidence
+                    self.ocr_pages.append(i)
+                    continue
+
+            if text.strip():
+                pages.append((i, text))
+            else:
+                self.dropped_pages.append(i)
+
         print(f"Extracted text from {len(pages)} pages")
+        if self.ocr_pages:
+            print(f"OCR used on {len(self.ocr_pages)} pages: {self.ocr_pages}")
+        if self.dropped_pages:
+            print(f"WARNING: {len(self.dropped_pages)} pages had no extractable text and were dropped: {self.dropped_pages}")
         return pages
-    
+
+    def page_count(self):
+        """Total number of pages in the PDF"""
+        return len(self.reader.pages)
+
+    def _has_images(self, page):
+        """Check whether a page embeds any raster images"""
+        try:
+            return len(page.images) > 0
+        except Exception:
+            # Malformed image streams still indicate image content
+            return True
+
+    def _ocr_page(self, page_number):
+        """
+        Render a single page and run Tesseract on it
+        Returns: (text, confidence) with confidence in the range 0..1
+        """
+        try:
+            import pytesseract
+            from pdf2image import convert_from_path
+        except ImportError:
+            print("WARNING: OCR dependencies not installed (pytesseract, pdf2image), skipping OCR")
+            self.ocr_enabled = False
+            return '', 0.0
+
+        try:
+            images = convert_from_path(
+                self.pdf_path,
+                dpi=self.ocr_dpi,
+                first_page=page_number,
+                last_page=page_number
+            )
+            if not images:
+                return '', 0.0
+
+            data = pytesseract.image_to_data(
+                images[0],
+                lang=self.ocr_language,
+                output_type=pytesseract.Output.DICT
+            )
+        except Exception as e:
+            print(f"WARNING: OCR failed on page {page_number}: {e}")
+            return '', 0.0
+
+        # Rebuild lines from word boxes and average the word confidences
+        lines = {}
+        confidences = []
+        for word, conf, block, par, line in zip(
+            data['text'], data['conf'], data['block_num'], data['par_num'], data['line_num']
+        ):
+            conf = float(conf)
+            if not word.strip() or conf < 0:
+                continue
+            lines.setdefault((block, par, line), []).append(word)
+            confidences.append(conf)
+
+        text = '\n'.join(' '.join(words) for words in lines.values())
+        confidence = sum(confidences) / len(confidences) / 100.0 if confidences else 0.0
+        return text, confidence
+
+    def extract_outline(self):
+        """
+        Document outline from PDF bookmarks, or font-size heuristics when the
+        PDF has none
+        Returns: List of tuples (level, title, page_number)
+        """
+        headings = self._bookmark_outline()
+        if headings:
+            print(f"Found {len(headings)} bookmarks in PDF outline")
+            return headings
+
+        headings = self._font_size_outline()
+        print(f"Detected {len(headings)} headings from font sizes")
+        return headings
+
+    def _bookmark_outline(self):
+        headings = []
+
+        def walk(items, level):
+            for item in items:
+                if isinstance(item, list):
+                    walk(item, level + 1)
+                    continue
+                try:
+                    page = self.reader.get_destination_page_number(item) + 1
+                except Exception:
+                    continue
+                title = (item.title or '').strip()
+                if title:
+                    headings.append((level, title, page))
+
+        try:
+            walk(self.reader.outline, 1)
+        except Exception as e:
+            print(f"WARNING: Could not read PDF outline: {e}")
+            return []
+
+        return headings
+
+    def _font_size_outline(self):
+        """
+        Treat short lines set noticeably larger than the body text as headings.
+        Distinct heading sizes are ranked largest first to assign levels.
+        """
+        lines = []
+        char_counts = {}
+
+        for i, page in enumerate(self.reader.pages, start=1):
+            spans = []
+
+            def visitor(text, cm, tm, font_dict, font_size):
+                if text.strip():
+                    # Effective size includes the text matrix scaling
+                    scale = abs(tm[3]) if tm and tm[3] else 1
+                    spans.append((text.strip(), round(font_size * scale, 1)))
+
+            try:
+                page.extract_text(visitor_text=visitor)
+            except Exception:
+                continue
+
+            for text, size in spans:
+                char_counts[size] = char_counts.get(size, 0) + len(text)
+                lines.append((i, text, size))
+
+        if not char_counts:
+            return []
+
+        body_size = max(char_counts, key=char_counts.get)
+        candidates = [
+            (page, text, size) for page, text, size in lines
+            if size >= body_size * 1.2 and 2 < len(text) <= 100 and not text.isdigit()
+        ]
+
+        sizes = sorted({size for _, _, size in candidates}, reverse=True)[:3]
+        levels = {size: level for level, size in enumerate(sizes, start=1)}
+
+        return [
+            (levels[size], text, page)
+            for page, text, size in candidates
+            if size in levels
+        ]
+
     def get_metadata(self):
         """Get PDF metadata (title, author, etc.)"""
-        return self.reader.metadata
\ No newline at end of file
+        return self.reader.metadata
@@ -1,42 +1,52 @@
 import sys
 import os
 from database import Database
-from pdf_parser import PDFParser
-from chunker import TextChunker
+from extractors import get_extractor
+from chunker import get_chunker
+from outline import build_sections
 from embeddings import EmbeddingsGenerator
 
-def process_textbook(textbook_id, pdf_path):
+def process_textbook(textbook_id, doc_path):
     """
     Process an already-uploaded textbook by its ID
     
     textbook_id: ID of the textbook in the database
-    pdf_path: Path to the PDF file on disk
+    doc_path: Path to the document (PDF, EPUB, DOCX, PPTX, Markdown or HTML) on disk
     """
     print(f"\n{'='*60}")
     print(f"Processing textbook ID: {textbook_id}")
-    print(f"PDF path: {pdf_path}")
+    print(f"Document path: {doc_path}")
     print(f"{'='*60}\n")
     
     # Initialize components
     db = Database()
-    parser = PDFParser(pdf_path)
-    chunker = TextChunker()
+    extractor = get_extractor(doc_path)
+    chunker = get_chunker()
     embedder = EmbeddingsGenerator()
     
     try:
-        # Extract text from PDF
-        print("Extracting text from PDF...")
-        pages = parser.extract_text()
+        # Extract text from the document
+        print("Extracting text from document...")
+        pages = extractor.extract()
+
+        # Record OCR/dropped page counts so the status endpoint can report them
+        db.update_page_stats(
+            textbook_id,
+            extractor.page_count,
+            len(extractor.ocr_pages),
+            len(extractor.dropped_pages)
+        )
         
         if not pages:
-            print("ERROR: No text found in PDF")
+            print("ERROR: No text found in document")
             sys.exit(1)
         
         print(f"Extracted {len(pages)} pages")
         
         # Chunk the text
         print("\nChunking text...")
-        chunks = chunker.chunk_pages(pages)
+        outline = extractor.outline()
+        chunks = chunker.chunk_pages(pages, outline)
         
         if not chunks:
             print("ERROR: No chunks created")
@@ -48,6 +58,11 @@ def process_textbook(textbook_id, pdf_path):
         print(f"\nGenerating embeddings for {len(chunks)} chunks...")
         chunk_texts = [chunk['content'] for chunk in chunks]
         embeddings = embedder.generate_batch(chunk_texts, batch_size=50)
+
+        # Record which model produced the vectors so queries embed the same way
+        generation_id = db.create_embedding_generation(
+            textbook_id, embedder.model, len(embeddings[0]), len(chunks)
+        )
         
         # Insert chunks into database
         print(f"\nStoring chunks in database...")
@@ -57,7 +72,12 @@ def process_textbook(textbook_id, pdf_path):
                 content=chunk['content'],
                 page_number=chunk['page_number'],
                 chunk_index=chunk['chunk_index'],
-                embedding=embedding
+                embedding=embedding,
+                generation_id=generation_id,
+                location=chunk['location'],
+                page_end=chunk['page_end'],
+                section_path=chunk['section_path'],
+                ocr_confidence=extractor.ocr_confidence_for(chunk['page_number'], chunk['page_end'])
             )
             
             # Progress indicator every 50 chunks
@@ -65,9 +85,13 @@ def process_textbook(textbook_id, pdf_path):
                 print(f"  Stored {i + 1}/{len(chunks)} chunks")
         
         print(f"Stored all {len(chunks)} chunks")
+
+        # Store the table of contents with page ranges
+        db.replace_sections(textbook_id, build_sections(outline, extractor.page_count))
         
         # Mark textbook as processed
         print("\nMarking textbook as processed...")
+        db.activate_embedding_generation(generation_id)
         db.mark_textbook_processed(textbook_id)
         
         print(f"\n{'='*60}")
@@ -76,6 +100,8 @@ def process_textbook(textbook_id, pdf_path):
         print(f"Textbook ID: {textbook_id}")
         print(f"Total chunks: {len(chunks)}")
         print(f"Total pages: {len(pages)}")
+        print(f"OCR pages: {len(extractor.ocr_pages)}")
+        print(f"Dropped pages: {len(extractor.dropped_pages)}")
         print(f"{'='*60}\n")
         
     except Exception as e:
@@ -89,16 +115,16 @@ def process_textbook(textbook_id, pdf_path):
 
 if __name__ == "__main__":
     if len(sys.argv) < 3:
-        print("Usage: python process_existing.py <textbook_id> <pdf_path>")
+        print("Usage: python process_existing.py <textbook_id> <doc_path>")
         print("Example: python process_existing.py 5 ../uploads/3_calculus.pdf")
         sys.exit(1)
     
     textbook_id = int(sys.argv[1])
-    pdf_path = sys.argv[2]
+    doc_path = sys.argv[2]
     
-    # Verify PDF exists
-    if not os.path.exists(pdf_path):
-        print(f"ERROR: PDF file not found: {pdf_path}")
+    # Verify document exists
+    if not os.path.exists(doc_path):
+        print(f"ERROR: Document not found: {doc_path}")
         sys.exit(1)
     
-    process_textbook(textbook_id, pdf_path)
\ No newline at end of file
+    process_textbook(textbook_id, doc_path)
\ No newline at end of file
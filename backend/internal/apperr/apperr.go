@@ -0,0 +1,48 @@
+// Package apperr defines the kinds of errors the app reports to users and the
+// error type that carries a user-facing message.
+package apperr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of errors callers can check for with errors.Is
+var (
+	ErrNotFound            = errors.New("not found")
+	ErrForbidden           = errors.New("forbidden")
+	ErrConflict            = errors.New("conflict")
+	ErrNotReady            = errors.New("not ready")
+	ErrInvalidInput        = errors.New("invalid input")
+	ErrUnauthorized        = errors.New("unauthorized")
+	ErrRateLimited         = errors.New("rate limited")
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
+)
+
+// Error is an error of a known kind with a message that is safe to show to
+// users as is. Err, if set, is the underlying cause and is only logged.
+type Error struct {
+	Kind    error
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Lets errors.Is match both the kind and the cause
+func (e *Error) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+// Create an error of a kind with a formatted user-facing message
+func New(kind error, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
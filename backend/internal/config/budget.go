@@ -0,0 +1,38 @@
+package config
+
+// Context window sizes (input + output tokens) of the chat models we use
+var modelContextWindows = map[string]int{
+	"gpt-4":         8192,
+	"gpt-4-32k":     32768,
+	"gpt-4-turbo":   128000,
+	"gpt-4o":        128000,
+	"gpt-4o-mini":   128000,
+	"gpt-3.5-turbo": 16385,
+}
+
+const (
+	// Tokens reserved for the system prompt, question and formatting
+	promptReserveTokens = 1000
+	// Cap on the default budget so large-window models don't get huge (and costly) prompts
+	maxDefaultContextTokens = 12000
+	// Smallest context budget worth packing; a chunk cut shorter than this is dropped
+	MinContextTokens = 100
+)
+
+// Context window of a chat model. Unknown models are assumed to have
+// gpt-4's, the smallest we use.
+func ContextWindow(model string) int {
+	if window, ok := modelContextWindows[model]; ok {
+		return window
+	}
+	return modelContextWindows["gpt-4"]
+}
+
+// Tokens of textbook context per prompt: ContextTokenBudget if set,
+// otherwise what the model's window leaves after the answer and prompt
+func (c ChatConfig) ContextBudget() int {
+	if c.ContextTokenBudget > 0 {
+		return c.ContextTokenBudget
+	}
+	return min(ContextWindow(c.Model)-c.MaxAnswerTokens-promptReserveTokens, maxDefaultContextTokens)
+}
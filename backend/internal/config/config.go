@@ -0,0 +1,227 @@
+// Package config loads the backend's settings into a typed struct. Settings
+// come from an optional JSON file (CONFIG_FILE) and environment variables;
+// a non-empty environment variable overrides the file.
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+// Config holds every setting of the API server and the command line tools
+type Config struct {
+	Server       ServerConfig       `json:"server"`
+	Database     DatabaseConfig     `json:"database"`
+	Auth         AuthConfig         `json:"auth"`
+	Storage      StorageConfig      `json:"storage"`
+	OpenAIAPIKey string             `json:"openai_api_key" env:"OPENAI_API_KEY"` // Default key for every model provider
+	Embedding    EmbeddingConfig    `json:"embedding"`
+	Chat         ChatConfig         `json:"chat"`
+	Retrieval    RetrievalConfig    `json:"retrieval"`
+	Reranker     RerankerConfig     `json:"reranker"`
+	Faithfulness FaithfulnessConfig `json:"faithfulness"`
+	AnswerCache  AnswerCacheConfig  `json:"answer_cache"`
+	Timeouts     TimeoutConfig      `json:"timeouts"`
+}
+
+type ServerConfig struct {
+	Port int `json:"port" env:"PORT"`
+	// Origins allowed to call the API from a browser. A "*" matches any
+	// host label or port, e.g. "https://*.vercel.app" or "http://localhost:*".
+	AllowedOrigins []string `json:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+
+	// Connection limits. Writing a response has to outlast QUERY_TIMEOUT;
+	// uploads get UploadTimeout to send the file instead.
+	ReadHeaderTimeout time.Duration `json:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `json:"read_timeout" env:"HTTP_READ_TIMEOUT"`
+	WriteTimeout      time.Duration `json:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `json:"idle_timeout" env:"HTTP_IDLE_TIMEOUT"` // Keep-alive connections
+	UploadTimeout     time.Duration `json:"upload_timeout" env:"UPLOAD_TIMEOUT"`
+	// How long a shutdown waits for requests, ingestion and re-embeds to
+	// finish before interrupting them
+	ShutdownTimeout time.Duration `json:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+}
+
+type DatabaseConfig struct {
+	Host     string `json:"host" env:"DB_HOST"`
+	Port     int    `json:"port" env:"DB_PORT"`
+	User     string `json:"user" env:"DB_USER"`
+	Password string `json:"password" env:"DB_PASSWORD"`
+	Name     string `json:"name" env:"DB_NAME"`
+	SSLMode  string `json:"sslmode" env:"DB_SSLMODE"`
+
+	// HNSW index build parameters (cmd/vectorindex and re-embeds) and per-query search size
+	HNSWM              int `json:"hnsw_m" env:"HNSW_M"`
+	HNSWEfConstruction int `json:"hnsw_ef_construction" env:"HNSW_EF_CONSTRUCTION"`
+	HNSWEfSearch       int `json:"hnsw_ef_search" env:"HNSW_EF_SEARCH"`
+}
+
+type AuthConfig struct {
+	JWTSecret          string `json:"jwt_secret" env:"JWT_SECRET"`
+	JWTExpirationHours int    `json:"jwt_expiration_hours" env:"JWT_EXPIRATION_HOURS"`
+	AutoVerify         bool   `json:"auto_verify" env:"AUTO_VERIFY"` // Skip email verification (development)
+}
+
+type StorageConfig struct {
+	AWSRegion string `json:"aws_region" env:"AWS_REGION"`
+	S3Bucket  string `json:"s3_bucket" env:"S3_BUCKET_NAME"`
+}
+
+type EmbeddingConfig struct {
+	// Model new embedding generations are built with
+	Model      string `json:"model" env:"EMBEDDING_MODEL"`
+	Dimensions int    `json:"dimensions" env:"EMBEDDING_DIMENSIONS"`
+	BaseURL    string `json:"base_url" env:"EMBEDDING_BASE_URL"` // Any OpenAI-compatible server
+	APIKey     string `json:"api_key" env:"EMBEDDING_API_KEY"`
+
+	BatchSize   int `json:"batch_size" env:"EMBEDDING_BATCH_SIZE"` // Max inputs per request
+	Concurrency int `json:"concurrency" env:"EMBEDDING_CONCURRENCY"`
+	MaxRetries  int `json:"max_retries" env:"EMBEDDING_MAX_RETRIES"` // Retries on rate limits and server errors
+	CacheSize   int `json:"cache_size" env:"EMBEDDING_CACHE_SIZE"`   // Embeddings kept in memory
+}
+
+type ChatConfig struct {
+	Model           string  `json:"model" env:"CHAT_MODEL"`
+	BaseURL         string  `json:"base_url" env:"CHAT_BASE_URL"` // Any OpenAI-compatible provider
+	APIKey          string  `json:"api_key" env:"CHAT_API_KEY"`
+	Temperature     float64 `json:"temperature" env:"CHAT_TEMPERATURE"`
+	MaxAnswerTokens int     `json:"max_answer_tokens" env:"ANSWER_MAX_TOKENS"`
+	// Tokens of textbook context per prompt; 0 derives it from the model
+	ContextTokenBudget int `json:"context_token_budget" env:"CONTEXT_TOKEN_BUDGET"`
+}
+
+type RetrievalConfig struct {
+	// Max cosine distance for a relevant chunk when neither the textbook nor
+	// the user set one
+	RelevanceThreshold  float64 `json:"relevance_threshold" env:"RELEVANCE_THRESHOLD"`
+	MMRDiversity        float64 `json:"mmr_diversity" env:"MMR_DIVERSITY"`         // 0 disables MMR
+	RerankCandidates    int     `json:"rerank_candidates" env:"RERANK_CANDIDATES"` // Matches fetched before reranking
+	QueryExpansionModel string  `json:"query_expansion_model" env:"QUERY_EXPANSION_MODEL"`
+}
+
+// Reranker kinds
+const (
+	RerankerNone         = ""
+	RerankerLLM          = "llm"
+	RerankerCrossEncoder = "cross-encoder"
+)
+
+type RerankerConfig struct {
+	Kind    string `json:"kind" env:"RERANKER"`
+	Model   string `json:"model" env:"RERANK_MODEL"`
+	BaseURL string `json:"base_url" env:"RERANK_BASE_URL"`
+	APIKey  string `json:"api_key" env:"RERANK_API_KEY"`
+}
+
+type FaithfulnessConfig struct {
+	Always bool   `json:"always" env:"FAITHFULNESS_CHECK"` // Grade every answer, not just on request
+	Model  string `json:"model" env:"FAITHFULNESS_MODEL"`
+}
+
+type AnswerCacheConfig struct {
+	Enabled    bool    `json:"enabled" env:"ANSWER_CACHE"`
+	Similarity float64 `json:"similarity" env:"ANSWER_CACHE_SIMILARITY"` // Min cosine similarity between normalized questions
+}
+
+// TimeoutConfig bounds each stage of a query. Every stage also stops as soon
+// as the request is cancelled (e.g. the browser went away).
+type TimeoutConfig struct {
+	Query          time.Duration `json:"query" env:"QUERY_TIMEOUT"` // Whole query, including all stages
+	QueryExpansion time.Duration `json:"query_expansion" env:"QUERY_EXPANSION_TIMEOUT"`
+	Embedding      time.Duration `json:"embedding" env:"EMBEDDING_TIMEOUT"`
+	VectorSearch   time.Duration `json:"vector_search" env:"VECTOR_SEARCH_TIMEOUT"`
+	Rerank         time.Duration `json:"rerank" env:"RERANK_TIMEOUT"`
+	Generation     time.Duration `json:"generation" env:"GENERATION_TIMEOUT"` // Answer generation
+	Faithfulness   time.Duration `json:"faithfulness" env:"FAITHFULNESS_TIMEOUT"`
+}
+
+// Settings used when neither the file nor the environment sets them
+func Defaults() Config {
+	return Config{
+		Server: ServerConfig{
+			Port: 8080,
+			AllowedOrigins: []string{
+				"http://localhost",
+				"http://localhost:*",
+				"https://lexra.online",
+				"https://*.lexra.online",
+				"https://*.vercel.app",
+			},
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       60 * time.Second,
+			WriteTimeout:      150 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			UploadTimeout:     15 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Port:               5432,
+			SSLMode:            "require",
+			HNSWM:              16,
+			HNSWEfConstruction: 64,
+			HNSWEfSearch:       100,
+		},
+		Auth: AuthConfig{
+			JWTExpirationHours: 168, // 7 days
+		},
+		Embedding: EmbeddingConfig{
+			Model:       "text-embedding-3-small",
+			Dimensions:  1536,
+			BatchSize:   256,
+			Concurrency: 4,
+			MaxRetries:  3,
+			CacheSize:   10000,
+		},
+		Chat: ChatConfig{
+			Model:           "gpt-4",
+			Temperature:     0.7,
+			MaxAnswerTokens: 1500,
+		},
+		Retrieval: RetrievalConfig{
+			RelevanceThreshold:  0.5,
+			RerankCandidates:    50,
+			QueryExpansionModel: "gpt-4o-mini",
+		},
+		Reranker: RerankerConfig{
+			Model: "gpt-4o-mini",
+		},
+		Faithfulness: FaithfulnessConfig{
+			Model: "gpt-4o-mini",
+		},
+		AnswerCache: AnswerCacheConfig{
+			Enabled:    true,
+			Similarity: 0.95,
+		},
+		Timeouts: TimeoutConfig{
+			Query:          120 * time.Second,
+			QueryExpansion: 20 * time.Second,
+			Embedding:      15 * time.Second,
+			VectorSearch:   10 * time.Second,
+			Rerank:         30 * time.Second,
+			Generation:     90 * time.Second,
+			Faithfulness:   30 * time.Second,
+		},
+	}
+}
+
+// Fill settings that default to other settings
+func (c *Config) resolve() {
+	if c.Embedding.APIKey == "" {
+		c.Embedding.APIKey = c.OpenAIAPIKey
+	}
+	if c.Chat.APIKey == "" {
+		c.Chat.APIKey = c.OpenAIAPIKey
+	}
+
+	c.Reranker.Kind = strings.ToLower(c.Reranker.Kind)
+	switch c.Reranker.Kind {
+	case RerankerLLM:
+		if c.Reranker.APIKey == "" {
+			c.Reranker.APIKey = c.OpenAIAPIKey
+		}
+	case RerankerCrossEncoder:
+		if c.Reranker.BaseURL == "" {
+			c.Reranker.BaseURL = "http://localhost:8081"
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Load the configuration: defaults, then the JSON file named by CONFIG_FILE
+// (if set), then environment variables. Errors list every setting that
+// couldn't be parsed; call Validate to check the values.
+func Load() (*Config, error) {
+	cfg := Defaults()
+	var errs []error
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadFile(&cfg, path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	loadEnv(reflect.ValueOf(&cfg).Elem(), &errs)
+	cfg.resolve()
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return &cfg, nil
+}
+
+// Apply the settings in a JSON file. Unknown keys are errors, so typos
+// don't go unnoticed.
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	var errs []error
+	loadMap(reflect.ValueOf(cfg).Elem(), values, "", &errs)
+	if len(errs) > 0 {
+		return fmt.Errorf("config file %s: %w", path, errors.Join(errs...))
+	}
+	return nil
+}
+
+// Set struct fields from a decoded JSON object, matching json tags
+func loadMap(v reflect.Value, values map[string]interface{}, prefix string, errs *[]error) {
+	fields := make(map[string]int)
+	for i := 0; i < v.NumField(); i++ {
+		fields[jsonName(v.Type().Field(i))] = i
+	}
+
+	// Sorted so errors come out in a stable order
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		raw := values[key]
+		i, ok := fields[key]
+		if !ok {
+			*errs = append(*errs, fmt.Errorf("unknown setting %s%s", prefix, key))
+			continue
+		}
+
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			nested, ok := raw.(map[string]interface{})
+			if !ok {
+				*errs = append(*errs, fmt.Errorf("%s%s must be an object", prefix, key))
+				continue
+			}
+			loadMap(field, nested, prefix+key+".", errs)
+			continue
+		}
+
+		if err := setFromJSON(field, raw); err != nil {
+			*errs = append(*errs, fmt.Errorf("invalid %s%s: %w", prefix, key, err))
+		}
+	}
+}
+
+// Set struct fields from the environment variables named by env tags
+func loadEnv(v reflect.Value, errs *[]error) {
+	for i := 0; i < v.NumField(); i++ {
+		field, info := v.Field(i), v.Type().Field(i)
+		if field.Kind() == reflect.Struct {
+			loadEnv(field, errs)
+			continue
+		}
+
+		name := info.Tag.Get("env")
+		value := strings.TrimSpace(os.Getenv(name))
+		if name == "" || value == "" {
+			continue
+		}
+		if err := setFromString(field, value); err != nil {
+			*errs = append(*errs, fmt.Errorf("invalid %s %q: %w", name, value, err))
+		}
+	}
+}
+
+func setFromJSON(field reflect.Value, raw interface{}) error {
+	switch value := raw.(type) {
+	case string:
+		return setFromString(field, value)
+	case float64:
+		return setFromString(field, strconv.FormatFloat(value, 'f', -1, 64))
+	case bool:
+		return setFromString(field, strconv.FormatBool(value))
+	case []interface{}:
+		if field.Type() != reflect.TypeOf([]string(nil)) {
+			return fmt.Errorf("expected %s", typeName(field))
+		}
+		list := make([]string, 0, len(value))
+		for _, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("expected a list of strings")
+			}
+			list = append(list, s)
+		}
+		field.Set(reflect.ValueOf(list))
+		return nil
+	}
+	return fmt.Errorf("expected %s", typeName(field))
+}
+
+// Parse a setting into a field. Lists are comma-separated.
+func setFromString(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("expected %s", typeName(field))
+		}
+		field.SetInt(int64(d))
+
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("expected %s", typeName(field))
+		}
+		field.SetInt(int64(n))
+
+	case field.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("expected %s", typeName(field))
+		}
+		field.SetFloat(f)
+
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected %s", typeName(field))
+		}
+		field.SetBool(b)
+
+	case field.Type() == reflect.TypeOf([]string(nil)):
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
+
+// Description of the values a field accepts, for error messages
+func typeName(field reflect.Value) string {
+	switch {
+	case field.Type() == reflect.TypeOf(time.Duration(0)):
+		return `a duration such as "30s"`
+	case field.Kind() == reflect.Int:
+		return "an integer"
+	case field.Kind() == reflect.Float64:
+		return "a number"
+	case field.Kind() == reflect.Bool:
+		return "true or false"
+	case field.Kind() == reflect.Slice:
+		return "a list of strings"
+	}
+	return "a string"
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// The configuration as NAME=value environment entries, for child processes
+// (the Python ingestion pipeline) that read their settings from the
+// environment
+func (c *Config) Environ() []string {
+	var env []string
+	environ(reflect.ValueOf(c).Elem(), &env)
+	return env
+}
+
+func environ(v reflect.Value, env *[]string) {
+	for i := 0; i < v.NumField(); i++ {
+		field, info := v.Field(i), v.Type().Field(i)
+		if field.Kind() == reflect.Struct {
+			environ(field, env)
+			continue
+		}
+
+		name := info.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		var value string
+		switch {
+		case field.Type() == reflect.TypeOf(time.Duration(0)):
+			value = time.Duration(field.Int()).String()
+		case field.Kind() == reflect.Slice:
+			value = strings.Join(field.Interface().([]string), ",")
+		default:
+			value = fmt.Sprint(field.Interface())
+		}
+		*env = append(*env, name+"="+value)
+	}
+}
@@ -0,0 +1,289 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Clear every setting's environment variable so the host's don't leak in
+func clearEnv(t *testing.T) {
+	t.Helper()
+	cfg := Defaults()
+	for _, entry := range cfg.Environ() {
+		name, _, _ := strings.Cut(entry, "=")
+		t.Setenv(name, "")
+	}
+	t.Setenv("CONFIG_FILE", "")
+}
+
+// Point CONFIG_FILE at a temporary file with the given contents
+func writeConfigFile(t *testing.T, contents string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+}
+
+func TestLoadDefaults(t *testing.T) {
+	clearEnv(t)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if want := Defaults(); !reflect.DeepEqual(*cfg, want) {
+		t.Errorf("Load() = %+v, want the defaults %+v", *cfg, want)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		get  func(*Config) interface{}
+		want interface{}
+	}{
+		{
+			name: "file overrides default",
+			file: `{"server": {"port": 9000}}`,
+			get:  func(c *Config) interface{} { return c.Server.Port },
+			want: 9000,
+		},
+		{
+			name: "env overrides file",
+			file: `{"server": {"port": 9000}}`,
+			env:  map[string]string{"PORT": "9100"},
+			get:  func(c *Config) interface{} { return c.Server.Port },
+			want: 9100,
+		},
+		{
+			name: "blank env doesn't override file",
+			file: `{"database": {"host": "db.internal"}}`,
+			env:  map[string]string{"DB_HOST": "  "},
+			get:  func(c *Config) interface{} { return c.Database.Host },
+			want: "db.internal",
+		},
+		{
+			name: "env without a file",
+			env:  map[string]string{"CHAT_MODEL": "gpt-4o"},
+			get:  func(c *Config) interface{} { return c.Chat.Model },
+			want: "gpt-4o",
+		},
+		{
+			name: "settings missing from the file keep their default",
+			file: `{"chat": {"temperature": 0.2}}`,
+			get:  func(c *Config) interface{} { return c.Chat.Model },
+			want: "gpt-4",
+		},
+		{
+			name: "shared API key fills provider keys",
+			file: `{"openai_api_key": "sk-file"}`,
+			env:  map[string]string{"CHAT_API_KEY": "sk-chat"},
+			get:  func(c *Config) interface{} { return []string{c.Embedding.APIKey, c.Chat.APIKey} },
+			want: []string{"sk-file", "sk-chat"},
+		},
+		{
+			name: "reranker kind is case-insensitive",
+			env:  map[string]string{"RERANKER": "Cross-Encoder"},
+			get:  func(c *Config) interface{} { return []string{c.Reranker.Kind, c.Reranker.BaseURL} },
+			want: []string{RerankerCrossEncoder, "http://localhost:8081"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			if tt.file != "" {
+				writeConfigFile(t, tt.file)
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if got := tt.get(cfg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadParsing(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		get  func(*Config) interface{}
+		want interface{}
+	}{
+		{
+			name: "duration from env",
+			env:  map[string]string{"QUERY_TIMEOUT": "1m30s"},
+			get:  func(c *Config) interface{} { return c.Timeouts.Query },
+			want: 90 * time.Second,
+		},
+		{
+			name: "duration from file",
+			file: `{"timeouts": {"generation": "2m"}}`,
+			get:  func(c *Config) interface{} { return c.Timeouts.Generation },
+			want: 2 * time.Minute,
+		},
+		{
+			name: "comma-separated list from env",
+			env:  map[string]string{"CORS_ALLOWED_ORIGINS": " https://a.example, ,https://b.example,"},
+			get:  func(c *Config) interface{} { return c.Server.AllowedOrigins },
+			want: []string{"https://a.example", "https://b.example"},
+		},
+		{
+			name: "list from file",
+			file: `{"server": {"allowed_origins": ["https://a.example"]}}`,
+			get:  func(c *Config) interface{} { return c.Server.AllowedOrigins },
+			want: []string{"https://a.example"},
+		},
+		{
+			name: "empty list from file",
+			file: `{"server": {"allowed_origins": []}}`,
+			get:  func(c *Config) interface{} { return c.Server.AllowedOrigins },
+			want: []string{},
+		},
+		{
+			name: "number as a string in the file",
+			file: `{"database": {"port": "6543"}}`,
+			get:  func(c *Config) interface{} { return c.Database.Port },
+			want: 6543,
+		},
+		{
+			name: "float and bool",
+			env:  map[string]string{"MMR_DIVERSITY": "0.25", "ANSWER_CACHE": "false"},
+			get:  func(c *Config) interface{} { return []interface{}{c.Retrieval.MMRDiversity, c.AnswerCache.Enabled} },
+			want: []interface{}{0.25, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			if tt.file != "" {
+				writeConfigFile(t, tt.file)
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if got := tt.get(cfg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		want []string // Each must appear in the error
+	}{
+		{
+			name: "unknown top-level key",
+			file: `{"sever": {}}`,
+			want: []string{"unknown setting sever"},
+		},
+		{
+			name: "unknown nested key",
+			file: `{"server": {"prot": 8080}}`,
+			want: []string{"unknown setting server.prot"},
+		},
+		{
+			name: "section that isn't an object",
+			file: `{"server": 8080}`,
+			want: []string{"server must be an object"},
+		},
+		{
+			name: "invalid JSON",
+			file: `{"server": `,
+			want: []string{"failed to parse config file"},
+		},
+		{
+			name: "duration without a unit in env",
+			env:  map[string]string{"QUERY_TIMEOUT": "45"},
+			want: []string{`invalid QUERY_TIMEOUT "45": expected a duration such as "30s"`},
+		},
+		{
+			name: "duration as a number in the file",
+			file: `{"timeouts": {"query": 45}}`,
+			want: []string{`invalid timeouts.query: expected a duration such as "30s"`},
+		},
+		{
+			name: "integer",
+			env:  map[string]string{"PORT": "eighty"},
+			want: []string{`invalid PORT "eighty": expected an integer`},
+		},
+		{
+			name: "bool",
+			env:  map[string]string{"AUTO_VERIFY": "maybe"},
+			want: []string{`invalid AUTO_VERIFY "maybe": expected true or false`},
+		},
+		{
+			name: "list with a non-string",
+			file: `{"server": {"allowed_origins": ["https://a.example", 1]}}`,
+			want: []string{"invalid server.allowed_origins: expected a list of strings"},
+		},
+		{
+			name: "list for a scalar",
+			file: `{"server": {"port": [8080]}}`,
+			want: []string{"invalid server.port: expected an integer"},
+		},
+		{
+			name: "every problem is reported",
+			file: `{"server": {"prot": 1}, "chat": {"temperature": "hot"}}`,
+			env:  map[string]string{"DB_PORT": "x"},
+			want: []string{"unknown setting server.prot", "invalid chat.temperature: expected a number", `invalid DB_PORT "x"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			if tt.file != "" {
+				writeConfigFile(t, tt.file)
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := Load()
+			if err == nil {
+				t.Fatalf("Load() = %+v, want an error", cfg)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Load() error = %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("CONFIG_FILE", filepath.Join(t.TempDir(), "missing.json"))
+
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "failed to read config file") {
+		t.Errorf("Load() error = %v, want a read error", err)
+	}
+}
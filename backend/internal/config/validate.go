@@ -0,0 +1,227 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Check every setting the API server needs. The error lists all problems,
+// one per line.
+func (c *Config) Validate() error {
+	return errors.Join(
+		c.Server.Validate(),
+		c.Database.Validate(),
+		c.Auth.Validate(),
+		c.Storage.Validate(),
+		c.Embedding.Validate(),
+		c.Chat.Validate(),
+		c.Retrieval.Validate(),
+		c.Reranker.Validate(),
+		c.AnswerCache.Validate(),
+		c.Timeouts.Validate(),
+		c.validateLimits(),
+	)
+}
+
+// Settings that depend on each other across sections
+func (c *Config) validateLimits() error {
+	var v validator
+	if c.Server.WriteTimeout <= c.Timeouts.Query {
+		v.add("HTTP_WRITE_TIMEOUT (%s) must be longer than QUERY_TIMEOUT (%s)", c.Server.WriteTimeout, c.Timeouts.Query)
+	}
+	return v.err()
+}
+
+func (c ServerConfig) Validate() error {
+	var v validator
+	v.intRange("PORT", c.Port, 1, 65535)
+	v.positive("HTTP_READ_HEADER_TIMEOUT", c.ReadHeaderTimeout)
+	v.positive("HTTP_READ_TIMEOUT", c.ReadTimeout)
+	v.positive("HTTP_WRITE_TIMEOUT", c.WriteTimeout)
+	v.positive("HTTP_IDLE_TIMEOUT", c.IdleTimeout)
+	v.positive("UPLOAD_TIMEOUT", c.UploadTimeout)
+	v.positive("SHUTDOWN_TIMEOUT", c.ShutdownTimeout)
+	for _, origin := range c.AllowedOrigins {
+		if err := validOrigin(origin); err != nil {
+			v.add("invalid CORS_ALLOWED_ORIGINS entry %q: %v", origin, err)
+		}
+	}
+	return v.err()
+}
+
+func (c DatabaseConfig) Validate() error {
+	var v validator
+	v.required("DB_HOST", c.Host)
+	v.intRange("DB_PORT", c.Port, 1, 65535)
+	v.required("DB_USER", c.User)
+	v.required("DB_NAME", c.Name)
+	v.oneOf("DB_SSLMODE", c.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full")
+	v.intRange("HNSW_M", c.HNSWM, 2, 100)
+	v.intRange("HNSW_EF_CONSTRUCTION", c.HNSWEfConstruction, 2*c.HNSWM, 1000)
+	v.intRange("HNSW_EF_SEARCH", c.HNSWEfSearch, 1, 1000)
+	return v.err()
+}
+
+func (c AuthConfig) Validate() error {
+	var v validator
+	v.required("JWT_SECRET", c.JWTSecret)
+	v.intRange("JWT_EXPIRATION_HOURS", c.JWTExpirationHours, 1, 24*365)
+	return v.err()
+}
+
+func (c StorageConfig) Validate() error {
+	var v validator
+	v.required("AWS_REGION", c.AWSRegion)
+	v.required("S3_BUCKET_NAME", c.S3Bucket)
+	return v.err()
+}
+
+func (c EmbeddingConfig) Validate() error {
+	var v validator
+	v.required("EMBEDDING_MODEL", c.Model)
+	v.intRange("EMBEDDING_DIMENSIONS", c.Dimensions, 1, 16000)
+	if c.BaseURL == "" && c.APIKey == "" {
+		v.add("EMBEDDING_API_KEY or OPENAI_API_KEY is required unless EMBEDDING_BASE_URL is set")
+	}
+	v.intRange("EMBEDDING_BATCH_SIZE", c.BatchSize, 1, 2048)
+	v.intRange("EMBEDDING_CONCURRENCY", c.Concurrency, 1, 64)
+	v.intRange("EMBEDDING_MAX_RETRIES", c.MaxRetries, 0, 10)
+	v.intRange("EMBEDDING_CACHE_SIZE", c.CacheSize, 1, 10000000)
+	return v.err()
+}
+
+func (c ChatConfig) Validate() error {
+	var v validator
+	v.required("CHAT_MODEL", c.Model)
+	if c.BaseURL == "" && c.APIKey == "" {
+		v.add("CHAT_API_KEY or OPENAI_API_KEY is required unless CHAT_BASE_URL is set")
+	}
+	v.floatRange("CHAT_TEMPERATURE", c.Temperature, 0, 2)
+	v.intRange("ANSWER_MAX_TOKENS", c.MaxAnswerTokens, 1, 100000)
+	v.intRange("CONTEXT_TOKEN_BUDGET", c.ContextTokenBudget, 0, 1000000)
+	if budget := c.ContextBudget(); budget < MinContextTokens {
+		if c.ContextTokenBudget > 0 {
+			v.add("CONTEXT_TOKEN_BUDGET must be at least %d (got %d)", MinContextTokens, c.ContextTokenBudget)
+		} else {
+			v.add("ANSWER_MAX_TOKENS (%d) leaves fewer than %d tokens of context in %s's %d-token window; lower it or set CONTEXT_TOKEN_BUDGET",
+				c.MaxAnswerTokens, MinContextTokens, c.Model, ContextWindow(c.Model))
+		}
+	}
+	return v.err()
+}
+
+func (c RetrievalConfig) Validate() error {
+	var v validator
+	if c.RelevanceThreshold <= 0 || c.RelevanceThreshold > 2 {
+		v.add("RELEVANCE_THRESHOLD must be a cosine distance in (0, 2] (got %g)", c.RelevanceThreshold)
+	}
+	v.floatRange("MMR_DIVERSITY", c.MMRDiversity, 0, 1)
+	v.intRange("RERANK_CANDIDATES", c.RerankCandidates, 1, 1000)
+	v.required("QUERY_EXPANSION_MODEL", c.QueryExpansionModel)
+	return v.err()
+}
+
+func (c RerankerConfig) Validate() error {
+	var v validator
+	v.oneOf("RERANKER", c.Kind, RerankerNone, RerankerLLM, RerankerCrossEncoder)
+	if c.Kind == RerankerLLM {
+		v.required("RERANK_MODEL", c.Model)
+		if c.BaseURL == "" && c.APIKey == "" {
+			v.add("RERANK_API_KEY or OPENAI_API_KEY is required for the llm reranker unless RERANK_BASE_URL is set")
+		}
+	}
+	return v.err()
+}
+
+func (c AnswerCacheConfig) Validate() error {
+	var v validator
+	if c.Enabled && (c.Similarity <= 0 || c.Similarity > 1) {
+		v.add("ANSWER_CACHE_SIMILARITY must be in (0, 1] (got %g)", c.Similarity)
+	}
+	return v.err()
+}
+
+func (c TimeoutConfig) Validate() error {
+	var v validator
+	v.positive("QUERY_TIMEOUT", c.Query)
+	v.positive("QUERY_EXPANSION_TIMEOUT", c.QueryExpansion)
+	v.positive("EMBEDDING_TIMEOUT", c.Embedding)
+	v.positive("VECTOR_SEARCH_TIMEOUT", c.VectorSearch)
+	v.positive("RERANK_TIMEOUT", c.Rerank)
+	v.positive("GENERATION_TIMEOUT", c.Generation)
+	v.positive("FAITHFULNESS_TIMEOUT", c.Faithfulness)
+	return v.err()
+}
+
+// An origin is "*" or scheme://host[:port], where "*" may stand for one
+// part of the host or the port
+func validOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+	scheme, rest, ok := strings.Cut(origin, "://")
+	if !ok || (scheme != "http" && scheme != "https") {
+		return fmt.Errorf("must start with http:// or https://")
+	}
+	if rest == "" || strings.ContainsAny(rest, "/?#") {
+		return fmt.Errorf("must be scheme://host[:port] with no path")
+	}
+	if strings.Count(rest, "*") > 1 {
+		return fmt.Errorf("may contain at most one *")
+	}
+	return nil
+}
+
+// Collects validation problems
+type validator struct {
+	errs []error
+}
+
+func (v *validator) add(format string, args ...interface{}) {
+	v.errs = append(v.errs, fmt.Errorf(format, args...))
+}
+
+func (v *validator) err() error {
+	return errors.Join(v.errs...)
+}
+
+func (v *validator) required(name, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.add("%s is required", name)
+	}
+}
+
+func (v *validator) intRange(name string, value, min, max int) {
+	if value < min || value > max {
+		v.add("%s must be between %d and %d (got %d)", name, min, max, value)
+	}
+}
+
+func (v *validator) floatRange(name string, value, min, max float64) {
+	if value < min || value > max {
+		v.add("%s must be between %g and %g (got %g)", name, min, max, value)
+	}
+}
+
+func (v *validator) positive(name string, value time.Duration) {
+	if value <= 0 {
+		v.add("%s must be a positive duration (got %s)", name, value)
+	}
+}
+
+func (v *validator) oneOf(name, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	var quoted []string
+	for _, a := range allowed {
+		if a != "" {
+			quoted = append(quoted, a)
+		}
+	}
+	v.add("%s must be one of %s (got %q)", name, strings.Join(quoted, ", "), value)
+}
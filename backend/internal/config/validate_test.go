@@ -0,0 +1,176 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Defaults plus the settings that have none
+func validConfig() Config {
+	cfg := Defaults()
+	cfg.Database.Host = "localhost"
+	cfg.Database.User = "postgres"
+	cfg.Database.Name = "rag"
+	cfg.Auth.JWTSecret = "secret"
+	cfg.Storage.AWSRegion = "us-east-1"
+	cfg.Storage.S3Bucket = "textbooks"
+	cfg.Embedding.APIKey = "sk-test"
+	cfg.Chat.APIKey = "sk-test"
+	return cfg
+}
+
+func TestValidateValid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+	}{
+		{"defaults", func(c *Config) {}},
+		{"self-hosted providers without keys", func(c *Config) {
+			c.Embedding.APIKey, c.Embedding.BaseURL = "", "http://localhost:11434/v1"
+			c.Chat.APIKey, c.Chat.BaseURL = "", "http://localhost:11434/v1"
+		}},
+		{"llm reranker", func(c *Config) { c.Reranker.Kind, c.Reranker.APIKey = RerankerLLM, "sk-test" }},
+		{"cross-encoder reranker", func(c *Config) { c.Reranker.Kind = RerankerCrossEncoder }},
+		{"disabled answer cache ignores similarity", func(c *Config) { c.AnswerCache.Enabled, c.AnswerCache.Similarity = false, 0 }},
+		{"wildcard origins", func(c *Config) {
+			c.Server.AllowedOrigins = []string{"*", "https://*.example.com", "http://localhost:*"}
+		}},
+		{"explicit context budget", func(c *Config) { c.Chat.MaxAnswerTokens, c.Chat.ContextTokenBudget = 8000, 4000 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(&cfg)
+			if err := cfg.Validate(); err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   string
+	}{
+		// Server
+		{"port", func(c *Config) { c.Server.Port = 0 }, "PORT must be between 1 and 65535 (got 0)"},
+		{"read header timeout", func(c *Config) { c.Server.ReadHeaderTimeout = 0 }, "HTTP_READ_HEADER_TIMEOUT must be a positive duration"},
+		{"read timeout", func(c *Config) { c.Server.ReadTimeout = -time.Second }, "HTTP_READ_TIMEOUT must be a positive duration (got -1s)"},
+		{"idle timeout", func(c *Config) { c.Server.IdleTimeout = 0 }, "HTTP_IDLE_TIMEOUT must be a positive duration"},
+		{"upload timeout", func(c *Config) { c.Server.UploadTimeout = 0 }, "UPLOAD_TIMEOUT must be a positive duration"},
+		{"shutdown timeout", func(c *Config) { c.Server.ShutdownTimeout = 0 }, "SHUTDOWN_TIMEOUT must be a positive duration"},
+		{"origin scheme", func(c *Config) { c.Server.AllowedOrigins = []string{"example.com"} }, `invalid CORS_ALLOWED_ORIGINS entry "example.com": must start with http:// or https://`},
+		{"origin path", func(c *Config) { c.Server.AllowedOrigins = []string{"https://example.com/"} }, "must be scheme://host[:port] with no path"},
+		{"origin wildcards", func(c *Config) { c.Server.AllowedOrigins = []string{"https://*.*.example.com"} }, "may contain at most one *"},
+		{"write timeout vs query timeout", func(c *Config) { c.Server.WriteTimeout = c.Timeouts.Query }, "HTTP_WRITE_TIMEOUT (2m0s) must be longer than QUERY_TIMEOUT (2m0s)"},
+
+		// Database
+		{"db host", func(c *Config) { c.Database.Host = " " }, "DB_HOST is required"},
+		{"db port", func(c *Config) { c.Database.Port = 70000 }, "DB_PORT must be between 1 and 65535 (got 70000)"},
+		{"db user", func(c *Config) { c.Database.User = "" }, "DB_USER is required"},
+		{"db name", func(c *Config) { c.Database.Name = "" }, "DB_NAME is required"},
+		{"sslmode", func(c *Config) { c.Database.SSLMode = "on" }, `DB_SSLMODE must be one of disable, allow, prefer, require, verify-ca, verify-full (got "on")`},
+		{"hnsw m", func(c *Config) { c.Database.HNSWM, c.Database.HNSWEfConstruction = 1, 64 }, "HNSW_M must be between 2 and 100 (got 1)"},
+		{"hnsw ef construction", func(c *Config) { c.Database.HNSWEfConstruction = 16 }, "HNSW_EF_CONSTRUCTION must be between 32 and 1000 (got 16)"},
+		{"hnsw ef search", func(c *Config) { c.Database.HNSWEfSearch = 0 }, "HNSW_EF_SEARCH must be between 1 and 1000 (got 0)"},
+
+		// Auth and storage
+		{"jwt secret", func(c *Config) { c.Auth.JWTSecret = "" }, "JWT_SECRET is required"},
+		{"jwt expiration", func(c *Config) { c.Auth.JWTExpirationHours = 0 }, "JWT_EXPIRATION_HOURS must be between 1 and 8760 (got 0)"},
+		{"aws region", func(c *Config) { c.Storage.AWSRegion = "" }, "AWS_REGION is required"},
+		{"bucket", func(c *Config) { c.Storage.S3Bucket = "" }, "S3_BUCKET_NAME is required"},
+
+		// Embedding
+		{"embedding model", func(c *Config) { c.Embedding.Model = "" }, "EMBEDDING_MODEL is required"},
+		{"embedding dimensions", func(c *Config) { c.Embedding.Dimensions = 16001 }, "EMBEDDING_DIMENSIONS must be between 1 and 16000 (got 16001)"},
+		{"embedding key", func(c *Config) { c.Embedding.APIKey = "" }, "EMBEDDING_API_KEY or OPENAI_API_KEY is required unless EMBEDDING_BASE_URL is set"},
+		{"embedding batch size", func(c *Config) { c.Embedding.BatchSize = 0 }, "EMBEDDING_BATCH_SIZE must be between 1 and 2048 (got 0)"},
+		{"embedding concurrency", func(c *Config) { c.Embedding.Concurrency = 65 }, "EMBEDDING_CONCURRENCY must be between 1 and 64 (got 65)"},
+		{"embedding retries", func(c *Config) { c.Embedding.MaxRetries = -1 }, "EMBEDDING_MAX_RETRIES must be between 0 and 10 (got -1)"},
+		{"embedding cache size", func(c *Config) { c.Embedding.CacheSize = 0 }, "EMBEDDING_CACHE_SIZE must be between 1 and 10000000 (got 0)"},
+
+		// Chat
+		{"chat model", func(c *Config) { c.Chat.Model = "" }, "CHAT_MODEL is required"},
+		{"chat key", func(c *Config) { c.Chat.APIKey = "" }, "CHAT_API_KEY or OPENAI_API_KEY is required unless CHAT_BASE_URL is set"},
+		{"temperature", func(c *Config) { c.Chat.Temperature = 2.5 }, "CHAT_TEMPERATURE must be between 0 and 2 (got 2.5)"},
+		{"answer tokens", func(c *Config) { c.Chat.MaxAnswerTokens = 0 }, "ANSWER_MAX_TOKENS must be between 1 and 100000 (got 0)"},
+		{"context budget range", func(c *Config) { c.Chat.ContextTokenBudget = -1 }, "CONTEXT_TOKEN_BUDGET must be between 0 and 1000000 (got -1)"},
+		{"context budget too small", func(c *Config) { c.Chat.ContextTokenBudget = 50 }, "CONTEXT_TOKEN_BUDGET must be at least 100 (got 50)"},
+		{"answer tokens fill the window", func(c *Config) { c.Chat.MaxAnswerTokens = 7100 }, "ANSWER_MAX_TOKENS (7100) leaves fewer than 100 tokens of context in gpt-4's 8192-token window"},
+
+		// Retrieval, reranker and answer cache
+		{"relevance threshold", func(c *Config) { c.Retrieval.RelevanceThreshold = 0 }, "RELEVANCE_THRESHOLD must be a cosine distance in (0, 2] (got 0)"},
+		{"mmr diversity", func(c *Config) { c.Retrieval.MMRDiversity = 1.5 }, "MMR_DIVERSITY must be between 0 and 1 (got 1.5)"},
+		{"rerank candidates", func(c *Config) { c.Retrieval.RerankCandidates = 0 }, "RERANK_CANDIDATES must be between 1 and 1000 (got 0)"},
+		{"query expansion model", func(c *Config) { c.Retrieval.QueryExpansionModel = "" }, "QUERY_EXPANSION_MODEL is required"},
+		{"reranker kind", func(c *Config) { c.Reranker.Kind = "bm25" }, `RERANKER must be one of llm, cross-encoder (got "bm25")`},
+		{"rerank model", func(c *Config) { c.Reranker.Kind, c.Reranker.APIKey, c.Reranker.Model = RerankerLLM, "sk-test", "" }, "RERANK_MODEL is required"},
+		{"rerank key", func(c *Config) { c.Reranker.Kind = RerankerLLM }, "RERANK_API_KEY or OPENAI_API_KEY is required for the llm reranker unless RERANK_BASE_URL is set"},
+		{"answer cache similarity", func(c *Config) { c.AnswerCache.Similarity = 1.1 }, "ANSWER_CACHE_SIMILARITY must be in (0, 1] (got 1.1)"},
+
+		// Timeouts
+		{"query timeout", func(c *Config) { c.Timeouts.Query, c.Server.WriteTimeout = 0, time.Second }, "QUERY_TIMEOUT must be a positive duration"},
+		{"query expansion timeout", func(c *Config) { c.Timeouts.QueryExpansion = 0 }, "QUERY_EXPANSION_TIMEOUT must be a positive duration"},
+		{"embedding timeout", func(c *Config) { c.Timeouts.Embedding = 0 }, "EMBEDDING_TIMEOUT must be a positive duration"},
+		{"vector search timeout", func(c *Config) { c.Timeouts.VectorSearch = 0 }, "VECTOR_SEARCH_TIMEOUT must be a positive duration"},
+		{"rerank timeout", func(c *Config) { c.Timeouts.Rerank = 0 }, "RERANK_TIMEOUT must be a positive duration"},
+		{"generation timeout", func(c *Config) { c.Timeouts.Generation = 0 }, "GENERATION_TIMEOUT must be a positive duration"},
+		{"faithfulness timeout", func(c *Config) { c.Timeouts.Faithfulness = 0 }, "FAITHFULNESS_TIMEOUT must be a positive duration"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(&cfg)
+
+			err := cfg.Validate()
+			if err == nil {
+				t.Fatalf("Validate() error = nil, want %q", tt.want)
+			}
+			// Only the broken setting is reported
+			if lines := strings.Split(err.Error(), "\n"); len(lines) != 1 || !strings.Contains(lines[0], tt.want) {
+				t.Errorf("Validate() error = %q, want only %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := validConfig()
+	cfg.Server.Port = 0
+	cfg.Database.Host = ""
+	cfg.Timeouts.Rerank = 0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() error = nil, want three problems")
+	}
+	if lines := strings.Split(err.Error(), "\n"); len(lines) != 3 {
+		t.Errorf("Validate() reported %d problems, want 3:\n%v", len(lines), err)
+	}
+}
+
+func TestContextBudget(t *testing.T) {
+	tests := []struct {
+		name string
+		chat ChatConfig
+		want int
+	}{
+		{"explicit budget", ChatConfig{Model: "gpt-4", MaxAnswerTokens: 1500, ContextTokenBudget: 3000}, 3000},
+		{"derived from the window", ChatConfig{Model: "gpt-4", MaxAnswerTokens: 1500}, 8192 - 1500 - 1000},
+		{"capped for large windows", ChatConfig{Model: "gpt-4o", MaxAnswerTokens: 1500}, 12000},
+		{"unknown models get gpt-4's window", ChatConfig{Model: "local-llm", MaxAnswerTokens: 1000}, 8192 - 1000 - 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.chat.ContextBudget(); got != tt.want {
+				t.Errorf("ContextBudget() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// AnswerCacheKey: everything besides the question that a cached answer
+// depends on
+type AnswerCacheKey struct {
+	TextbookID    int
+	GenerationID  int
+	Dimensions    int
+	ChatModel     string
+	PromptVersion int
+	OptionsHash   string
+}
+
+// CachedAnswer: the closest cached answer to a question
+type CachedAnswer struct {
+	ID         int
+	Question   string
+	Response   []byte // JSON-encoded QueryResponse
+	Similarity float64
+}
+
+// Find the cached answer whose question embedding is closest to the given
+// one; nil when there is none for the key
+func (db *DB) FindCachedAnswer(ctx context.Context, key AnswerCacheKey, questionEmbedding []float32) (*CachedAnswer, error) {
+	distance := distanceExpr("question_embedding", key.Dimensions, "$6")
+
+	query := `
+		SELECT id, question, response, 1 - ` + distance + `
+		FROM answer_cache
+		WHERE textbook_id = $1 AND generation_id = $2 AND chat_model = $3
+		  AND prompt_version = $4 AND options_hash = $5
+		ORDER BY ` + distance + `
+		LIMIT 1
+	`
+
+	var answer CachedAnswer
+	err := db.conn.QueryRowContext(ctx, query, key.TextbookID, key.GenerationID, key.ChatModel, key.PromptVersion,
+		key.OptionsHash, Vector(questionEmbedding)).Scan(&answer.ID, &answer.Question, &answer.Response, &answer.Similarity)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find cached answer: %w", err)
+	}
+
+	return &answer, nil
+}
+
+// Store a generated answer for reuse
+func (db *DB) SaveCachedAnswer(ctx context.Context, key AnswerCacheKey, question string, questionEmbedding []float32, response []byte) error {
+	query := `
+		INSERT INTO answer_cache
+			(textbook_id, generation_id, chat_model, prompt_version, options_hash, question, question_embedding, response)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	_, err := db.conn.ExecContext(ctx, query, key.TextbookID, key.GenerationID, key.ChatModel, key.PromptVersion,
+		key.OptionsHash, question, Vector(questionEmbedding), response)
+	if err != nil {
+		return fmt.Errorf("failed to cache answer: %w", err)
+	}
+
+	return nil
+}
+
+// Count a cache hit
+func (db *DB) RecordCachedAnswerHit(ctx context.Context, id int) error {
+	_, err := db.conn.ExecContext(ctx, `UPDATE answer_cache SET hit_count = hit_count + 1, last_hit_at = CURRENT_TIMESTAMP WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to record cache hit: %w", err)
+	}
+	return nil
+}
+
+// Drop a textbook's cached answers, e.g. after its content changed
+func (db *DB) DeleteCachedAnswers(ctx context.Context, textbookID int) error {
+	if _, err := db.conn.ExecContext(ctx, `DELETE FROM answer_cache WHERE textbook_id = $1`, textbookID); err != nil {
+		return fmt.Errorf("failed to delete cached answers: %w", err)
+	}
+	return nil
+}
@@ -1,28 +1,46 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"strings"
+	"sync"
 
+	"github.com/jonkermoo/rag-textbook/backend/internal/apperr"
+	"github.com/jonkermoo/rag-textbook/backend/internal/config"
 	"github.com/jonkermoo/rag-textbook/backend/internal/models"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type DB struct {
 	conn *sql.DB
+
+	// HNSW search settings applied to every vector query
+	efSearch int
+	// HNSW build parameters for indexes created by EnsureVectorIndex
+	hnswM              int
+	hnswEfConstruction int
+
+	// Whether pgvector supports hnsw.iterative_scan (0.8 and later). Detected
+	// by the first vector search that finds the extension.
+	scanMu        sync.Mutex
+	iterativeScan *bool
 }
 
-// Create a new database connection
-func NewDB() (*DB, error) {
+// Create a new database handle. Nothing is connected yet, so the server can
+// start while Postgres is down; the readiness check reports it.
+func NewDB(cfg config.DatabaseConfig) (*DB, error) {
 	connStr := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"),
-		os.Getenv("DB_SSLMODE"),
+		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		quoteConnValue(cfg.Host),
+		cfg.Port,
+		quoteConnValue(cfg.User),
+		quoteConnValue(cfg.Password),
+		quoteConnValue(cfg.Name),
+		cfg.SSLMode,
 	)
 
 	conn, err := sql.Open("postgres", connStr)
@@ -30,28 +48,53 @@ func NewDB() (*DB, error) {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	if err := conn.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
-	}
+	return &DB{
+		conn:               conn,
+		efSearch:           cfg.HNSWEfSearch,
+		hnswM:              cfg.HNSWM,
+		hnswEfConstruction: cfg.HNSWEfConstruction,
+	}, nil
+}
 
-	return &DB{conn: conn}, nil
+// Quote a connection string value so passwords with spaces or quotes work
+func quoteConnValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
 }
 
-// Finds the most similar chunks to a query embedding
-func (db *DB) SearchSimilarChunks(textbookID int, queryEmbedding []float32, topK int) ([]models.Chunk, error) {
-	// Convert embedding to pgvector format
-	embeddingStr := fmt.Sprintf("[%v]", arrayToString(queryEmbedding))
+// Finds the most similar chunks to a query embedding, searching the given
+// embedding generation (the query must be embedded with its model).
+// Optional filters restrict the search to page ranges / sections and exclude pages.
+// withEmbeddings also loads each chunk's stored embedding (needed for MMR).
+func (db *DB) SearchSimilarChunks(ctx context.Context, generation *models.EmbeddingGeneration, queryEmbedding []float32, topK int, filters *models.QueryFilters, withEmbeddings bool) ([]models.Chunk, error) {
+	args := []interface{}{Vector(queryEmbedding), generation.ID, topK}
+	where := []string{"e.generation_id = $2", fmt.Sprintf("e.dimensions = %d", generation.Dimensions)}
+	where, args = appendChunkFilters(where, args, filters)
+
+	embeddingColumn := "NULL::vector"
+	if withEmbeddings {
+		embeddingColumn = "e.embedding"
+	}
+	distance := distanceExpr("e.embedding", generation.Dimensions, "$1")
 
 	query := `
-		SELECT id, textbook_id, content, page_number, chunk_index, created_at,
-		       embedding <=> $1::vector AS distance
-		FROM chunks
-		WHERE textbook_id = $2
-		ORDER BY embedding <=> $1::vector
+		SELECT chunks.id, chunks.textbook_id, chunks.content, chunks.page_number, COALESCE(chunks.page_end, chunks.page_number),
+		       COALESCE(chunks.location, ''), COALESCE(chunks.section_path, ''), chunks.chunk_index,
+		       chunks.ocr_confidence, chunks.created_at,
+		       ` + distance + ` AS distance, ` + embeddingColumn + `
+		FROM chunk_embeddings e
+		JOIN chunks ON chunks.id = e.chunk_id
+		WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY ` + distance + `
 		LIMIT $3
 	`
 
-	rows, err := db.conn.Query(query, embeddingStr, textbookID, topK)
+	tx, err := db.beginVectorSearch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query similar chunks: %w", err)
 	}
@@ -60,42 +103,157 @@ func (db *DB) SearchSimilarChunks(textbookID int, queryEmbedding []float32, topK
 	var chunks []models.Chunk
 	for rows.Next() {
 		var chunk models.Chunk
+		var embedding Vector
 
 		err := rows.Scan(
 			&chunk.ID,
 			&chunk.TextbookID,
 			&chunk.Content,
 			&chunk.PageNumber,
+			&chunk.PageEnd,
+			&chunk.Location,
+			&chunk.SectionPath,
 			&chunk.ChunkIndex,
+			&chunk.OCRConfidence,
 			&chunk.CreatedAt,
 			&chunk.Distance,
+			&embedding,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan chunk: %w", err)
 		}
 
+		chunk.Embedding = embedding
 		chunks = append(chunks, chunk)
 	}
 
 	return chunks, nil
 }
 
+// Semantic search over a user's processed textbooks, or one textbook when
+// textbookID is set. Only textbooks whose active embeddings come from the
+// given model are searched. Hits are ordered by similarity and paged with offset.
+func (db *DB) SearchChunks(ctx context.Context, userID, textbookID int, embeddingModel EmbeddingModel, queryEmbedding []float32, limit, offset int, maxDistance float64) ([]models.SearchHit, error) {
+	distance := distanceExpr("e.embedding", embeddingModel.Dimensions, "$1")
+
+	args := []interface{}{Vector(queryEmbedding), userID, limit, offset, embeddingModel.Model}
+	where := []string{
+		"t.user_id = $2",
+		"t.processed = true",
+		"g.status = 'active'",
+		"g.model = $5",
+		fmt.Sprintf("e.dimensions = %d", embeddingModel.Dimensions),
+	}
+	if textbookID != 0 {
+		args = append(args, textbookID)
+		where = append(where, fmt.Sprintf("c.textbook_id = $%d", len(args)))
+	}
+	if maxDistance > 0 {
+		args = append(args, maxDistance)
+		where = append(where, fmt.Sprintf("%s < $%d", distance, len(args)))
+	}
+
+	query := `
+		SELECT c.id, c.textbook_id, t.title, c.content, c.page_number, COALESCE(c.page_end, c.page_number),
+		       COALESCE(c.location, ''), COALESCE(c.section_path, ''), ` + distance + ` AS distance
+		FROM chunk_embeddings e
+		JOIN embedding_generations g ON g.id = e.generation_id
+		JOIN chunks c ON c.id = e.chunk_id
+		JOIN textbooks t ON t.id = c.textbook_id
+		WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY ` + distance + `
+		LIMIT $3 OFFSET $4
+	`
+
+	tx, err := db.beginVectorSearch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search chunks: %w", err)
+	}
+	defer rows.Close()
+
+	hits := []models.SearchHit{}
+	for rows.Next() {
+		var hit models.SearchHit
+		var distance float64
+
+		err := rows.Scan(
+			&hit.ChunkID,
+			&hit.TextbookID,
+			&hit.TextbookTitle,
+			&hit.Content,
+			&hit.PageNumber,
+			&hit.PageEnd,
+			&hit.Location,
+			&hit.SectionPath,
+			&distance,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan search hit: %w", err)
+		}
+
+		hit.Score = 1.0 - distance
+		hits = append(hits, hit)
+	}
+
+	return hits, nil
+}
+
 // Retrieve a textbook by ID
-func (db *DB) GetTextbook(id int) (*models.Textbook, error) {
+func (db *DB) GetTextbook(ctx context.Context, id int) (*models.Textbook, error) {
+	var textbook models.Textbook
+
+	query := `SELECT id, user_id, title, s3_key, uploaded_at, processed, ingestion_status, relevance_threshold FROM textbooks WHERE id = $1`
+	err := db.conn.QueryRowContext(ctx, query, id).Scan(
+		&textbook.ID,
+		&textbook.UserID,
+		&textbook.Title,
+		&textbook.S3Key,
+		&textbook.UploadedAt,
+		&textbook.Processed,
+		&textbook.IngestionStatus,
+		&textbook.RelevanceThreshold,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, apperr.New(apperr.ErrNotFound, "Textbook not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get textbook: %w", err)
+	}
+
+	return &textbook, nil
+}
+
+// Retrieve the most recently uploaded processed textbook with a title
+func (db *DB) GetTextbookByTitle(ctx context.Context, title string) (*models.Textbook, error) {
 	var textbook models.Textbook
 
-	query := `SELECT id, user_id, title, s3_key, uploaded_at, processed FROM textbooks WHERE id = $1`
-	err := db.conn.QueryRow(query, id).Scan(
+	query := `
+		SELECT id, user_id, title, s3_key, uploaded_at, processed, ingestion_status, relevance_threshold
+		FROM textbooks
+		WHERE title = $1 AND processed = true
+		ORDER BY uploaded_at DESC
+		LIMIT 1
+	`
+	err := db.conn.QueryRowContext(ctx, query, title).Scan(
 		&textbook.ID,
 		&textbook.UserID,
 		&textbook.Title,
 		&textbook.S3Key,
 		&textbook.UploadedAt,
 		&textbook.Processed,
+		&textbook.IngestionStatus,
+		&textbook.RelevanceThreshold,
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("textbook not found")
+		return nil, apperr.New(apperr.ErrNotFound, "Textbook not found")
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get textbook: %w", err)
@@ -105,22 +263,24 @@ func (db *DB) GetTextbook(id int) (*models.Textbook, error) {
 }
 
 // Create a new textbook record
-func (db *DB) CreateTextbook(userID int, title, s3Key string) (*models.Textbook, error) {
+func (db *DB) CreateTextbook(ctx context.Context, userID int, title, s3Key string) (*models.Textbook, error) {
 	var textbook models.Textbook
 
 	query := `
 		INSERT INTO textbooks (user_id, title, s3_key, processed)
 		VALUES ($1, $2, $3, false)
-		RETURNING id, user_id, title, s3_key, uploaded_at, processed
+		RETURNING id, user_id, title, s3_key, uploaded_at, processed, ingestion_status, relevance_threshold
 	`
 
-	err := db.conn.QueryRow(query, userID, title, s3Key).Scan(
+	err := db.conn.QueryRowContext(ctx, query, userID, title, s3Key).Scan(
 		&textbook.ID,
 		&textbook.UserID,
 		&textbook.Title,
 		&textbook.S3Key,
 		&textbook.UploadedAt,
 		&textbook.Processed,
+		&textbook.IngestionStatus,
+		&textbook.RelevanceThreshold,
 	)
 
 	if err != nil {
@@ -131,15 +291,15 @@ func (db *DB) CreateTextbook(userID int, title, s3Key string) (*models.Textbook,
 }
 
 // List all textbooks for a user
-func (db *DB) ListTextbooks(userID int) ([]models.Textbook, error) {
+func (db *DB) ListTextbooks(ctx context.Context, userID int) ([]models.Textbook, error) {
 	query := `
-		SELECT id, user_id, title, s3_key, uploaded_at, processed
+		SELECT id, user_id, title, s3_key, uploaded_at, processed, ingestion_status, relevance_threshold
 		FROM textbooks
 		WHERE user_id = $1
 		ORDER BY uploaded_at DESC
 	`
 
-	rows, err := db.conn.Query(query, userID)
+	rows, err := db.conn.QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list textbooks: %w", err)
 	}
@@ -155,6 +315,8 @@ func (db *DB) ListTextbooks(userID int) ([]models.Textbook, error) {
 			&textbook.S3Key,
 			&textbook.UploadedAt,
 			&textbook.Processed,
+			&textbook.IngestionStatus,
+			&textbook.RelevanceThreshold,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan textbook: %w", err)
@@ -165,29 +327,55 @@ func (db *DB) ListTextbooks(userID int) ([]models.Textbook, error) {
 	return textbooks, nil
 }
 
+// Set (or clear, with nil) a textbook's relevance threshold
+func (db *DB) UpdateTextbookRelevanceThreshold(ctx context.Context, textbookID, userID int, threshold *float64) error {
+	query := `UPDATE textbooks SET relevance_threshold = $1 WHERE id = $2 AND user_id = $3`
+
+	result, err := db.conn.ExecContext(ctx, query, threshold, textbookID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update relevance threshold: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return apperr.New(apperr.ErrNotFound, "Textbook not found")
+	}
+
+	return nil
+}
+
 // Delete a textbook and all its chunks
-func (db *DB) DeleteTextbook(textbookID, userID int) error {
+func (db *DB) DeleteTextbook(ctx context.Context, textbookID, userID int) error {
 	// First verify the user owns this textbook
 	var ownerID int
-	err := db.conn.QueryRow("SELECT user_id FROM textbooks WHERE id = $1", textbookID).Scan(&ownerID)
+	err := db.conn.QueryRowContext(ctx, "SELECT user_id FROM textbooks WHERE id = $1", textbookID).Scan(&ownerID)
 	if err == sql.ErrNoRows {
-		return fmt.Errorf("textbook not found")
+		return apperr.New(apperr.ErrNotFound, "Textbook not found")
 	}
 	if err != nil {
 		return fmt.Errorf("failed to check textbook ownership: %w", err)
 	}
 	if ownerID != userID {
-		return fmt.Errorf("permission denied")
+		return apperr.New(apperr.ErrForbidden, "You don't own this textbook")
 	}
 
 	// Delete chunks first
-	_, err = db.conn.Exec("DELETE FROM chunks WHERE textbook_id = $1", textbookID)
+	_, err = db.conn.ExecContext(ctx, "DELETE FROM chunks WHERE textbook_id = $1", textbookID)
 	if err != nil {
 		return fmt.Errorf("failed to delete chunks: %w", err)
 	}
 
+	// Delete the outline
+	_, err = db.conn.ExecContext(ctx, "DELETE FROM sections WHERE textbook_id = $1", textbookID)
+	if err != nil {
+		return fmt.Errorf("failed to delete sections: %w", err)
+	}
+
 	// Delete the textbook
-	_, err = db.conn.Exec("DELETE FROM textbooks WHERE id = $1", textbookID)
+	_, err = db.conn.ExecContext(ctx, "DELETE FROM textbooks WHERE id = $1", textbookID)
 	if err != nil {
 		return fmt.Errorf("failed to delete textbook: %w", err)
 	}
@@ -195,18 +383,79 @@ func (db *DB) DeleteTextbook(textbookID, userID int) error {
 	return nil
 }
 
+// List a textbook's sections in document order (flat, linked by ParentID)
+func (db *DB) ListSections(ctx context.Context, textbookID int) ([]models.Section, error) {
+	query := `
+		SELECT id, textbook_id, parent_id, level, title, page_start, page_end
+		FROM sections
+		WHERE textbook_id = $1
+		ORDER BY position
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, textbookID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sections: %w", err)
+	}
+	defer rows.Close()
+
+	var sections []models.Section
+	for rows.Next() {
+		var section models.Section
+		err := rows.Scan(
+			&section.ID,
+			&section.TextbookID,
+			&section.ParentID,
+			&section.Level,
+			&section.Title,
+			&section.PageStart,
+			&section.PageEnd,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan section: %w", err)
+		}
+		sections = append(sections, section)
+	}
+
+	return sections, nil
+}
+
 // Get chunk count for a textbook (useful for status)
-func (db *DB) GetTextbookChunkCount(textbookID int) (int, error) {
+func (db *DB) GetTextbookChunkCount(ctx context.Context, textbookID int) (int, error) {
 	var count int
-	err := db.conn.QueryRow("SELECT COUNT(*) FROM chunks WHERE textbook_id = $1", textbookID).Scan(&count)
+	err := db.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM chunks WHERE textbook_id = $1", textbookID).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count chunks: %w", err)
 	}
 	return count, nil
 }
 
+// Get page extraction stats (total, OCR'd, dropped) for a textbook
+func (db *DB) GetTextbookPageStats(ctx context.Context, textbookID int) (*models.PageStats, error) {
+	var stats models.PageStats
+
+	query := `
+		SELECT COALESCE(page_count, 0), COALESCE(ocr_page_count, 0), COALESCE(dropped_page_count, 0)
+		FROM textbooks
+		WHERE id = $1
+	`
+
+	err := db.conn.QueryRowContext(ctx, query, textbookID).Scan(
+		&stats.PageCount,
+		&stats.OCRPageCount,
+		&stats.DroppedPageCount,
+	)
+	if err == sql.ErrNoRows {
+		return nil, apperr.New(apperr.ErrNotFound, "Textbook not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get page stats: %w", err)
+	}
+
+	return &stats, nil
+}
+
 // Create a new user with hashed password and verification token
-func (db *DB) CreateUser(email, passwordHash, verificationToken string) (*models.User, error) {
+func (db *DB) CreateUser(ctx context.Context, email, passwordHash, verificationToken string) (*models.User, error) {
 	var user models.User
 
 	query := `
@@ -215,13 +464,17 @@ func (db *DB) CreateUser(email, passwordHash, verificationToken string) (*models
 		RETURNING id, email, verified, created_at
 	`
 
-	err := db.conn.QueryRow(query, email, passwordHash, verificationToken).Scan(
+	err := db.conn.QueryRowContext(ctx, query, email, passwordHash, verificationToken).Scan(
 		&user.ID,
 		&user.Email,
 		&user.Verified,
 		&user.CreatedAt,
 	)
 
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return nil, apperr.New(apperr.ErrConflict, "An account with this email already exists")
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
@@ -230,7 +483,7 @@ func (db *DB) CreateUser(email, passwordHash, verificationToken string) (*models
 }
 
 // Retrieve a user by their email address
-func (db *DB) GetUserByEmail(email string) (*models.User, error) {
+func (db *DB) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
 
 	query := `
@@ -239,7 +492,7 @@ func (db *DB) GetUserByEmail(email string) (*models.User, error) {
 		WHERE email = $1
 	`
 
-	err := db.conn.QueryRow(query, email).Scan(
+	err := db.conn.QueryRowContext(ctx, query, email).Scan(
 		&user.ID,
 		&user.Email,
 		&user.PasswordHash,
@@ -249,7 +502,7 @@ func (db *DB) GetUserByEmail(email string) (*models.User, error) {
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("user not found")
+		return nil, apperr.New(apperr.ErrNotFound, "User not found")
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
@@ -259,14 +512,14 @@ func (db *DB) GetUserByEmail(email string) (*models.User, error) {
 }
 
 // Mark a user's email as verified using their verification token
-func (db *DB) VerifyUser(token string) error {
+func (db *DB) VerifyUser(ctx context.Context, token string) error {
 	query := `
 		UPDATE users
 		SET verified = true, verification_token = NULL
 		WHERE verification_token = $1 AND verified = false
 	`
 
-	result, err := db.conn.Exec(query, token)
+	result, err := db.conn.ExecContext(ctx, query, token)
 	if err != nil {
 		return fmt.Errorf("failed to verify user: %w", err)
 	}
@@ -277,17 +530,67 @@ func (db *DB) VerifyUser(token string) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("invalid or already used verification token")
+		return apperr.New(apperr.ErrNotFound, "Invalid or already used verification token")
+	}
+
+	return nil
+}
+
+// Get a user's default relevance threshold (nil if not set)
+func (db *DB) GetUserRelevanceThreshold(ctx context.Context, userID int) (*float64, error) {
+	var threshold *float64
+
+	err := db.conn.QueryRowContext(ctx, "SELECT relevance_threshold FROM users WHERE id = $1", userID).Scan(&threshold)
+	if err == sql.ErrNoRows {
+		return nil, apperr.New(apperr.ErrNotFound, "User not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get relevance threshold: %w", err)
+	}
+
+	return threshold, nil
+}
+
+// Set (or clear, with nil) a user's default relevance threshold
+func (db *DB) UpdateUserRelevanceThreshold(ctx context.Context, userID int, threshold *float64) error {
+	result, err := db.conn.ExecContext(ctx, "UPDATE users SET relevance_threshold = $1 WHERE id = $2", threshold, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update relevance threshold: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return apperr.New(apperr.ErrNotFound, "User not found")
+	}
+
+	return nil
+}
+
+// Store the faithfulness check of an answer for analytics
+func (db *DB) SaveAnswerEvaluation(ctx context.Context, userID, textbookID int, question, answer string, faithfulness *models.Faithfulness) error {
+	labels, err := json.Marshal(faithfulness.Sentences)
+	if err != nil {
+		return fmt.Errorf("failed to encode sentence labels: %w", err)
+	}
+
+	query := `
+		INSERT INTO answer_evaluations
+			(user_id, textbook_id, question, answer, faithfulness_score, supported_count, unsupported_count, sentence_labels, model)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+
+	_, err = db.conn.ExecContext(ctx, query, userID, textbookID, question, answer,
+		faithfulness.Score, faithfulness.Supported, faithfulness.Unsupported, labels, faithfulness.Model)
+	if err != nil {
+		return fmt.Errorf("failed to save answer evaluation: %w", err)
 	}
 
 	return nil
 }
 
 // Update the user's last login timestamp
-func (db *DB) UpdateLastLogin(userID int) error {
+func (db *DB) UpdateLastLogin(ctx context.Context, userID int) error {
 	query := `UPDATE users SET last_login = CURRENT_TIMESTAMP WHERE id = $1`
 
-	_, err := db.conn.Exec(query, userID)
+	_, err := db.conn.ExecContext(ctx, query, userID)
 	if err != nil {
 		return fmt.Errorf("failed to update last login: %w", err)
 	}
@@ -300,14 +603,38 @@ func (db *DB) Close() error {
 	return db.conn.Close()
 }
 
-// Helper function to convert float slice to string for pgvector
-func arrayToString(arr []float32) string {
-	result := ""
-	for i, v := range arr {
-		if i > 0 {
-			result += ","
-		}
-		result += fmt.Sprintf("%f", v)
+// Add WHERE conditions for query filters. A chunk matches a page range or
+// section when any of its pages (page_number..page_end) fall inside it.
+func appendChunkFilters(where []string, args []interface{}, filters *models.QueryFilters) ([]string, []interface{}) {
+	if filters == nil {
+		return where, args
 	}
-	return result
+
+	chunkEnd := "COALESCE(chunks.page_end, chunks.page_number)"
+
+	if filters.PageStart > 0 {
+		args = append(args, filters.PageStart)
+		where = append(where, fmt.Sprintf("%s >= $%d", chunkEnd, len(args)))
+	}
+	if filters.PageEnd > 0 {
+		args = append(args, filters.PageEnd)
+		where = append(where, fmt.Sprintf("chunks.page_number <= $%d", len(args)))
+	}
+
+	if len(filters.SectionIDs) > 0 {
+		args = append(args, pq.Array(filters.SectionIDs))
+		where = append(where, fmt.Sprintf(`EXISTS (
+			SELECT 1 FROM sections s
+			WHERE s.id = ANY($%d) AND s.textbook_id = chunks.textbook_id
+			  AND chunks.page_number <= s.page_end
+			  AND %s >= s.page_start
+		)`, len(args), chunkEnd))
+	}
+
+	for _, excluded := range filters.ExcludePages {
+		args = append(args, excluded.Start, excluded.End)
+		where = append(where, fmt.Sprintf("NOT (chunks.page_number <= $%d AND %s >= $%d)", len(args), chunkEnd, len(args)-1))
+	}
+
+	return where, args
 }
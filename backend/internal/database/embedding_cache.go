@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Look up cached embeddings by text hash; hashes that aren't cached are
+// missing from the result
+func (db *DB) GetCachedEmbeddings(ctx context.Context, model string, dimensions int, hashes []string) (map[string][]float32, error) {
+	embeddings := make(map[string][]float32, len(hashes))
+	if len(hashes) == 0 {
+		return embeddings, nil
+	}
+
+	query := `
+		SELECT text_hash, embedding
+		FROM embedding_cache
+		WHERE model = $1 AND dimensions = $2 AND text_hash = ANY($3)
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, model, dimensions, pq.StringArray(hashes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash string
+		var embedding Vector
+		if err := rows.Scan(&hash, &embedding); err != nil {
+			return nil, fmt.Errorf("failed to scan cached embedding: %w", err)
+		}
+		embeddings[hash] = embedding
+	}
+
+	return embeddings, nil
+}
+
+// Rows per cache insert; each row takes two parameters, which keeps a
+// statement well under Postgres's limit of 65535
+const cacheInsertBatchSize = 1000
+
+// Store embeddings in the cache; existing entries are left as they are
+func (db *DB) SaveCachedEmbeddings(ctx context.Context, model string, dimensions int, hashes []string, embeddings [][]float32) error {
+	if len(hashes) != len(embeddings) {
+		return fmt.Errorf("got %d embeddings for %d hashes", len(embeddings), len(hashes))
+	}
+
+	for start := 0; start < len(hashes); start += cacheInsertBatchSize {
+		end := min(start+cacheInsertBatchSize, len(hashes))
+
+		values := make([]string, 0, end-start)
+		args := []interface{}{model, dimensions}
+		for i := start; i < end; i++ {
+			args = append(args, hashes[i], Vector(embeddings[i]))
+			values = append(values, fmt.Sprintf("($1, $2, $%d, $%d)", len(args)-1, len(args)))
+		}
+
+		_, err := db.conn.ExecContext(ctx, `
+			INSERT INTO embedding_cache (model, dimensions, text_hash, embedding)
+			VALUES `+strings.Join(values, ", ")+`
+			ON CONFLICT DO NOTHING`, args...)
+		if err != nil {
+			return fmt.Errorf("failed to cache embeddings: %w", err)
+		}
+	}
+
+	return nil
+}
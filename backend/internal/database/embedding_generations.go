@@ -0,0 +1,293 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/apperr"
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+	"github.com/lib/pq"
+)
+
+// Embedding generation statuses
+const (
+	GenerationBuilding = "building"
+	GenerationActive   = "active"
+	GenerationRetired  = "retired"
+	GenerationFailed   = "failed"
+)
+
+// EmbeddingModel identifies the vector space a search has to embed into
+type EmbeddingModel struct {
+	Model      string
+	Dimensions int
+}
+
+const generationColumns = `id, textbook_id, model, dimensions, status, chunk_count, embedded_count,
+	COALESCE(error, ''), created_at, activated_at`
+
+func scanGeneration(row interface{ Scan(...interface{}) error }) (*models.EmbeddingGeneration, error) {
+	var g models.EmbeddingGeneration
+	err := row.Scan(&g.ID, &g.TextbookID, &g.Model, &g.Dimensions, &g.Status, &g.ChunkCount,
+		&g.EmbeddedCount, &g.Error, &g.CreatedAt, &g.ActivatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// Get the generation a textbook is currently searched with
+func (db *DB) GetActiveEmbeddingGeneration(ctx context.Context, textbookID int) (*models.EmbeddingGeneration, error) {
+	query := `SELECT ` + generationColumns + ` FROM embedding_generations WHERE textbook_id = $1 AND status = 'active'`
+
+	g, err := scanGeneration(db.conn.QueryRowContext(ctx, query, textbookID))
+	if err == sql.ErrNoRows {
+		return nil, apperr.New(apperr.ErrNotReady, "Textbook has no active embeddings")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get embedding generation: %w", err)
+	}
+
+	return g, nil
+}
+
+// Get an embedding generation by ID
+func (db *DB) GetEmbeddingGeneration(ctx context.Context, id int) (*models.EmbeddingGeneration, error) {
+	query := `SELECT ` + generationColumns + ` FROM embedding_generations WHERE id = $1`
+
+	g, err := scanGeneration(db.conn.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, apperr.New(apperr.ErrNotFound, "Embedding generation not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get embedding generation: %w", err)
+	}
+
+	return g, nil
+}
+
+// List a textbook's embedding generations, newest first
+func (db *DB) ListEmbeddingGenerations(ctx context.Context, textbookID int) ([]models.EmbeddingGeneration, error) {
+	return db.queryGenerations(ctx, `SELECT `+generationColumns+` FROM embedding_generations
+		WHERE textbook_id = $1 ORDER BY created_at DESC, id DESC`, textbookID)
+}
+
+// List re-embeds still being built (e.g. interrupted by a restart). The
+// first generation of a textbook that is still being ingested isn't included.
+func (db *DB) ListBuildingEmbeddingGenerations(ctx context.Context) ([]models.EmbeddingGeneration, error) {
+	return db.queryGenerations(ctx, `SELECT `+generationColumns+` FROM embedding_generations
+		WHERE status = 'building'
+		  AND textbook_id IN (SELECT id FROM textbooks WHERE processed = true)
+		ORDER BY id`)
+}
+
+func (db *DB) queryGenerations(ctx context.Context, query string, args ...interface{}) ([]models.EmbeddingGeneration, error) {
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list embedding generations: %w", err)
+	}
+	defer rows.Close()
+
+	generations := []models.EmbeddingGeneration{}
+	for rows.Next() {
+		g, err := scanGeneration(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan embedding generation: %w", err)
+		}
+		generations = append(generations, *g)
+	}
+
+	return generations, nil
+}
+
+// Start building a new generation for a textbook from the chunks of its
+// active generation. Only one generation per textbook can be building at a
+// time.
+func (db *DB) CreateEmbeddingGeneration(ctx context.Context, textbookID int, model string, dimensions int) (*models.EmbeddingGeneration, error) {
+	active, err := db.GetActiveEmbeddingGeneration(ctx, textbookID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO embedding_generations (textbook_id, model, dimensions, status, chunk_count)
+		VALUES ($1, $2, $3, 'building', (SELECT COUNT(*) FROM chunk_embeddings WHERE generation_id = $4))
+		RETURNING ` + generationColumns
+
+	g, err := scanGeneration(db.conn.QueryRowContext(ctx, query, textbookID, model, dimensions, active.ID))
+	// idx_embedding_generations_building allows one building generation per textbook
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return nil, apperr.New(apperr.ErrConflict, "A re-embed is already in progress for this textbook")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedding generation: %w", err)
+	}
+
+	return g, nil
+}
+
+// Chunks of the textbook's active generation that don't have an embedding in
+// the given one yet, in ID order (only ID and content are loaded). Chunks
+// left behind by earlier ingestions aren't in the active generation.
+func (db *DB) ListChunksToEmbed(ctx context.Context, generation *models.EmbeddingGeneration, limit int) ([]models.Chunk, error) {
+	query := `
+		SELECT c.id, c.content
+		FROM chunks c
+		WHERE c.textbook_id = $1
+		  AND c.id IN (
+			SELECT e.chunk_id
+			FROM chunk_embeddings e
+			JOIN embedding_generations g ON g.id = e.generation_id
+			WHERE g.textbook_id = $1 AND g.status = 'active'
+		  )
+		  AND NOT EXISTS (SELECT 1 FROM chunk_embeddings e WHERE e.generation_id = $2 AND e.chunk_id = c.id)
+		ORDER BY c.id
+		LIMIT $3
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, generation.TextbookID, generation.ID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chunks to embed: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []models.Chunk
+	for rows.Next() {
+		chunk := models.Chunk{TextbookID: generation.TextbookID}
+		if err := rows.Scan(&chunk.ID, &chunk.Content); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, nil
+}
+
+// Store embeddings for a batch of chunks and update the generation's progress
+func (db *DB) InsertChunkEmbeddings(ctx context.Context, generation *models.EmbeddingGeneration, chunkIDs []int, embeddings [][]float32) error {
+	if len(chunkIDs) != len(embeddings) {
+		return fmt.Errorf("got %d embeddings for %d chunks", len(embeddings), len(chunkIDs))
+	}
+	if len(chunkIDs) == 0 {
+		return nil
+	}
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	values := make([]string, 0, len(chunkIDs))
+	args := []interface{}{generation.ID, generation.Dimensions}
+	for i, id := range chunkIDs {
+		args = append(args, id, Vector(embeddings[i]))
+		values = append(values, fmt.Sprintf("($1, $%d, $2, $%d)", len(args)-1, len(args)))
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO chunk_embeddings (generation_id, chunk_id, dimensions, embedding)
+		VALUES `+strings.Join(values, ", ")+`
+		ON CONFLICT (generation_id, chunk_id) DO UPDATE SET embedding = EXCLUDED.embedding`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to insert chunk embeddings: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE embedding_generations
+		SET embedded_count = (SELECT COUNT(*) FROM chunk_embeddings WHERE generation_id = $1)
+		WHERE id = $1`, generation.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update embedding progress: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// Switch a textbook's searches to a completed generation. The previous
+// active generation is kept as retired (for rolling back); older retired
+// generations and their vectors are deleted.
+func (db *DB) ActivateEmbeddingGeneration(ctx context.Context, generation *models.EmbeddingGeneration) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM embedding_generations WHERE textbook_id = $1 AND status = 'retired'`, generation.TextbookID)
+	if err != nil {
+		return fmt.Errorf("failed to delete retired generations: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE embedding_generations SET status = 'retired' WHERE textbook_id = $1 AND status = 'active'`, generation.TextbookID)
+	if err != nil {
+		return fmt.Errorf("failed to retire active generation: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE embedding_generations
+		SET status = 'active', activated_at = CURRENT_TIMESTAMP, error = NULL
+		WHERE id = $1 AND status = 'building'`, generation.ID)
+	if err != nil {
+		return fmt.Errorf("failed to activate generation: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return apperr.New(apperr.ErrConflict, "Embedding generation %d is not building", generation.ID)
+	}
+
+	// Answers were retrieved from the old embeddings
+	_, err = tx.ExecContext(ctx, `DELETE FROM answer_cache WHERE textbook_id = $1`, generation.TextbookID)
+	if err != nil {
+		return fmt.Errorf("failed to delete cached answers: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// Mark a generation as failed; the active generation stays in use
+func (db *DB) FailEmbeddingGeneration(ctx context.Context, id int, reason string) error {
+	_, err := db.conn.ExecContext(ctx, `UPDATE embedding_generations SET status = 'failed', error = $2 WHERE id = $1`, id, reason)
+	if err != nil {
+		return fmt.Errorf("failed to mark generation failed: %w", err)
+	}
+	return nil
+}
+
+// Distinct models the user's textbooks are currently searched with
+func (db *DB) ListActiveEmbeddingModels(ctx context.Context, userID int) ([]EmbeddingModel, error) {
+	query := `
+		SELECT DISTINCT g.model, g.dimensions
+		FROM embedding_generations g
+		JOIN textbooks t ON t.id = g.textbook_id
+		WHERE t.user_id = $1 AND t.processed = true AND g.status = 'active'
+		ORDER BY g.model, g.dimensions
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list embedding models: %w", err)
+	}
+	defer rows.Close()
+
+	var embeddingModels []EmbeddingModel
+	for rows.Next() {
+		var m EmbeddingModel
+		if err := rows.Scan(&m.Model, &m.Dimensions); err != nil {
+			return nil, fmt.Errorf("failed to scan embedding model: %w", err)
+		}
+		embeddingModels = append(embeddingModels, m)
+	}
+
+	return embeddingModels, nil
+}
+
+// Distance expression for a dimension. The cast must match the partial HNSW
+// index expression exactly for the index to be used, so the dimension is
+// inlined rather than passed as a parameter.
+func distanceExpr(column string, dimensions int, param string) string {
+	return fmt.Sprintf("(%s::vector(%d) <=> %s::vector(%d))", column, dimensions, param, dimensions)
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Highest migration (database/migrations) the server needs
+const RequiredSchemaVersion = 16
+
+// Check the connection with a round trip
+func (db *DB) Ping(ctx context.Context) error {
+	if err := db.conn.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+	return nil
+}
+
+// Check that pgvector is installed and new enough for HNSW indexes.
+// Returns its version.
+func (db *DB) CheckVectorExtension(ctx context.Context) (string, error) {
+	version, err := db.VectorExtensionVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !versionAtLeast(version, 0, 5) {
+		return version, fmt.Errorf("pgvector %s is too old; HNSW indexes need 0.5.0 or later", version)
+	}
+	return version, nil
+}
+
+// Highest migration applied to the database
+func (db *DB) SchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	err := db.conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "42P01" { // undefined_table
+		return 0, fmt.Errorf("schema_version table is missing; apply database/migrations")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	return version, nil
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/apperr"
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+)
+
+// Ingestion statuses
+const (
+	IngestionPending     = "pending"     // Uploaded; taken over once stale if the run never starts
+	IngestionRunning     = "running"     // Heartbeats while it runs; taken over by another server once stale
+	IngestionInterrupted = "interrupted" // Stopped by a shutdown; taken over by the next server that checks
+	IngestionComplete    = "complete"
+	IngestionFailed      = "failed"
+)
+
+// Record the progress of a textbook's ingestion run. Also counts as a
+// heartbeat.
+func (db *DB) SetIngestionStatus(ctx context.Context, textbookID int, status string) error {
+	_, err := db.conn.ExecContext(ctx,
+		"UPDATE textbooks SET ingestion_status = $1, ingestion_heartbeat_at = CURRENT_TIMESTAMP WHERE id = $2",
+		status, textbookID)
+	if err != nil {
+		return fmt.Errorf("failed to set ingestion status: %w", err)
+	}
+	return nil
+}
+
+// Report that a running ingestion is still alive
+func (db *DB) HeartbeatIngestion(ctx context.Context, textbookID int) error {
+	_, err := db.conn.ExecContext(ctx,
+		"UPDATE textbooks SET ingestion_heartbeat_at = CURRENT_TIMESTAMP WHERE id = $1 AND ingestion_status = 'running'",
+		textbookID)
+	if err != nil {
+		return fmt.Errorf("failed to record ingestion heartbeat: %w", err)
+	}
+	return nil
+}
+
+// Take over the ingestion runs a shutdown interrupted, and pending or running
+// ones with no heartbeat for staleAfter (their server crashed or was killed
+// before or during the run). Pending runs that never had a heartbeat count
+// from the upload. They're marked running with a fresh heartbeat so other
+// servers don't take them too.
+func (db *DB) ClaimInterruptedIngestions(ctx context.Context, staleAfter time.Duration) ([]models.Textbook, error) {
+	query := `
+		UPDATE textbooks SET ingestion_status = 'running', ingestion_heartbeat_at = CURRENT_TIMESTAMP
+		WHERE processed = false
+		  AND (ingestion_status = 'interrupted'
+		       OR (ingestion_status IN ('pending', 'running')
+		           AND COALESCE(ingestion_heartbeat_at, uploaded_at, 'epoch') < CURRENT_TIMESTAMP - make_interval(secs => $1)))
+		RETURNING id, user_id, title, s3_key, uploaded_at, processed, ingestion_status, relevance_threshold
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, staleAfter.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim interrupted ingestions: %w", err)
+	}
+	defer rows.Close()
+
+	var textbooks []models.Textbook
+	for rows.Next() {
+		var textbook models.Textbook
+		err := rows.Scan(
+			&textbook.ID,
+			&textbook.UserID,
+			&textbook.Title,
+			&textbook.S3Key,
+			&textbook.UploadedAt,
+			&textbook.Processed,
+			&textbook.IngestionStatus,
+			&textbook.RelevanceThreshold,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan textbook: %w", err)
+		}
+		textbooks = append(textbooks, textbook)
+	}
+
+	return textbooks, rows.Err()
+}
+
+// Delete what an unfinished ingestion run stored (chunks, their embeddings
+// and the generation being built) so the run can start over. Processed
+// textbooks are left alone.
+func (db *DB) ResetIngestion(ctx context.Context, textbookID int) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var processed bool
+	err = tx.QueryRowContext(ctx, "SELECT processed FROM textbooks WHERE id = $1 FOR UPDATE", textbookID).Scan(&processed)
+	if err != nil {
+		return fmt.Errorf("failed to get textbook: %w", err)
+	}
+	if processed {
+		return apperr.New(apperr.ErrConflict, "Textbook is already processed")
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM chunks WHERE textbook_id = $1", textbookID); err != nil {
+		return fmt.Errorf("failed to delete chunks: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM embedding_generations WHERE textbook_id = $1", textbookID); err != nil {
+		return fmt.Errorf("failed to delete embedding generations: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+)
+
+// Largest dimension pgvector's vector type accepts, and the largest an HNSW
+// index on it supports
+const (
+	MaxVectorDim = 16000
+	maxHNSWDim   = 2000
+)
+
+// Vector is a pgvector value for database/sql, in pgvector's text format
+// ("[0.1,0.2,...]") both ways. Elements are written with the fewest digits
+// that parse back to the same float32, so there's no precision loss.
+type Vector []float32
+
+func (v Vector) Value() (driver.Value, error) {
+	if len(v) > MaxVectorDim {
+		return nil, fmt.Errorf("vector has %d dimensions, max is %d", len(v), MaxVectorDim)
+	}
+
+	// A string, not []byte, so lib/pq sends it as text
+	buf := make([]byte, 0, 2+12*len(v))
+	buf = append(buf, '[')
+	for i, f := range v {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendFloat(buf, float64(f), 'g', -1, 32)
+	}
+	buf = append(buf, ']')
+	return string(buf), nil
+}
+
+// Parse pgvector's text format ("[0.1,0.2,...]"); NULL scans to nil
+func (v *Vector) Scan(src interface{}) error {
+	var text []byte
+	switch src := src.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case []byte:
+		text = src
+	case string:
+		text = []byte(src)
+	default:
+		return fmt.Errorf("cannot scan %T into Vector", src)
+	}
+
+	text = bytes.TrimSpace(text)
+	if len(text) < 2 || text[0] != '[' || text[len(text)-1] != ']' {
+		return fmt.Errorf("invalid vector %q", text)
+	}
+	text = text[1 : len(text)-1]
+	if len(text) == 0 {
+		*v = Vector{}
+		return nil
+	}
+
+	vec := make(Vector, 0, bytes.Count(text, []byte{','})+1)
+	for len(text) > 0 {
+		part := text
+		if i := bytes.IndexByte(text, ','); i >= 0 {
+			part, text = text[:i], text[i+1:]
+		} else {
+			text = nil
+		}
+
+		f, err := strconv.ParseFloat(string(bytes.TrimSpace(part)), 32)
+		if err != nil {
+			return fmt.Errorf("invalid vector element %q: %w", part, err)
+		}
+		vec = append(vec, float32(f))
+	}
+
+	*v = vec
+	return nil
+}
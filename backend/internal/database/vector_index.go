@@ -0,0 +1,255 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HNSW indexes need a fixed dimension, so chunk_embeddings has one partial
+// index per dimension in use
+func vectorIndexName(dimensions int) string {
+	return fmt.Sprintf("idx_chunk_embeddings_hnsw_%d", dimensions)
+}
+
+// VectorIndexStats describes chunk_embeddings and its vector indexes
+type VectorIndexStats struct {
+	ExtensionVersion string
+	Indexes          []VectorIndex
+	TableSize        string
+	EmbeddingCount   int64
+	TextbookCount    int64
+	LastAnalyze      sql.NullTime
+}
+
+// VectorIndex describes one per-dimension HNSW index
+type VectorIndex struct {
+	Name       string
+	Dimensions int
+	Embeddings int64
+	Definition string // Empty when the index is missing
+	Size       string
+	Scans      int64
+}
+
+// Start a read-only transaction for a vector query with the HNSW search
+// settings applied. SET LOCAL keeps them from leaking to other queries on
+// the pooled connection.
+func (db *DB) beginVectorSearch(ctx context.Context) (*sql.Tx, error) {
+	iterativeScan, err := db.supportsIterativeScan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin vector search: %w", err)
+	}
+
+	// Higher ef_search = better recall, slower queries
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL hnsw.ef_search = %d", db.efSearch)); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to set hnsw.ef_search: %w", err)
+	}
+
+	// Keep scanning the graph until enough rows pass the textbook filter,
+	// instead of returning fewer than LIMIT rows
+	if iterativeScan {
+		if _, err := tx.ExecContext(ctx, "SET LOCAL hnsw.iterative_scan = strict_order"); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to set hnsw.iterative_scan: %w", err)
+		}
+	}
+
+	return tx, nil
+}
+
+// Whether hnsw.iterative_scan can be set. Checked once pgvector is found;
+// failures are retried by the next search.
+func (db *DB) supportsIterativeScan(ctx context.Context) (bool, error) {
+	db.scanMu.Lock()
+	defer db.scanMu.Unlock()
+
+	if db.iterativeScan == nil {
+		version, err := db.VectorExtensionVersion(ctx)
+		if err != nil {
+			return false, err
+		}
+		supported := versionAtLeast(version, 0, 8)
+		db.iterativeScan = &supported
+	}
+	return *db.iterativeScan, nil
+}
+
+// Installed pgvector version, e.g. "0.8.0"
+func (db *DB) VectorExtensionVersion(ctx context.Context) (string, error) {
+	var version string
+
+	err := db.conn.QueryRowContext(ctx, "SELECT extversion FROM pg_extension WHERE extname = 'vector'").Scan(&version)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("pgvector extension is not installed")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get pgvector version: %w", err)
+	}
+
+	return version, nil
+}
+
+// Create the HNSW index for a dimension if it doesn't exist yet, with the
+// configured HNSW_M and HNSW_EF_CONSTRUCTION. Called before a generation of
+// that dimension is activated.
+func (db *DB) EnsureVectorIndex(ctx context.Context, dimensions int) error {
+	if dimensions > maxHNSWDim {
+		// Searched with an exact scan
+		return nil
+	}
+
+	var exists bool
+	err := db.conn.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = $1)", vectorIndexName(dimensions)).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check vector index: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	return db.RebuildVectorIndex(ctx, dimensions, db.hnswM, db.hnswEfConstruction, "")
+}
+
+// Rebuild a dimension's HNSW index with new build parameters. The new index
+// is built concurrently next to the old one and swapped in, so searches keep
+// using an index throughout. maintenanceWorkMem (e.g. "2GB") speeds up large builds.
+func (db *DB) RebuildVectorIndex(ctx context.Context, dimensions, m, efConstruction int, maintenanceWorkMem string) error {
+	if dimensions < 1 || dimensions > MaxVectorDim {
+		return fmt.Errorf("dimensions must be between 1 and %d", MaxVectorDim)
+	}
+	if dimensions > maxHNSWDim {
+		return fmt.Errorf("HNSW indexes support at most %d dimensions", maxHNSWDim)
+	}
+	if m < 2 || m > 100 {
+		return fmt.Errorf("m must be between 2 and 100")
+	}
+	if efConstruction < 4 || efConstruction > 1000 || efConstruction < 2*m {
+		return fmt.Errorf("ef_construction must be between 4 and 1000 and at least 2*m")
+	}
+
+	// CONCURRENTLY can't run in a transaction, and the session settings must
+	// apply to the build, so pin a single connection
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if maintenanceWorkMem != "" {
+		if _, err := conn.ExecContext(ctx, "SET maintenance_work_mem = "+quoteLiteral(maintenanceWorkMem)); err != nil {
+			return fmt.Errorf("failed to set maintenance_work_mem: %w", err)
+		}
+	}
+
+	name := vectorIndexName(dimensions)
+	newName := name + "_new"
+	statements := []string{
+		// An interrupted earlier rebuild leaves an invalid index behind
+		"DROP INDEX CONCURRENTLY IF EXISTS " + newName,
+		// The expression must match distanceExpr for searches to use the index
+		fmt.Sprintf("CREATE INDEX CONCURRENTLY %s ON chunk_embeddings USING hnsw ((embedding::vector(%d)) vector_cosine_ops) WITH (m = %d, ef_construction = %d) WHERE dimensions = %d",
+			newName, dimensions, m, efConstruction, dimensions),
+		"DROP INDEX CONCURRENTLY IF EXISTS " + name,
+		fmt.Sprintf("ALTER INDEX %s RENAME TO %s", newName, name),
+	}
+	for _, statement := range statements {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to rebuild vector index: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Refresh planner statistics for chunks and their embeddings so it can
+// choose between an HNSW index and an exact per-textbook scan
+func (db *DB) AnalyzeChunks(ctx context.Context) error {
+	if _, err := db.conn.ExecContext(ctx, "ANALYZE chunks, chunk_embeddings"); err != nil {
+		return fmt.Errorf("failed to analyze chunks: %w", err)
+	}
+	return nil
+}
+
+// Size and usage of the vector indexes, one per dimension that has
+// embeddings or an index
+func (db *DB) GetVectorIndexStats(ctx context.Context) (*VectorIndexStats, error) {
+	stats := &VectorIndexStats{}
+
+	version, err := db.VectorExtensionVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats.ExtensionVersion = version
+
+	rows, err := db.conn.QueryContext(ctx, "SELECT dimensions, COUNT(*) FROM chunk_embeddings GROUP BY dimensions ORDER BY dimensions")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var index VectorIndex
+		if err := rows.Scan(&index.Dimensions, &index.Embeddings); err != nil {
+			return nil, fmt.Errorf("failed to scan embedding count: %w", err)
+		}
+		index.Name = vectorIndexName(index.Dimensions)
+		stats.Indexes = append(stats.Indexes, index)
+	}
+
+	query := `
+		SELECT COALESCE(pg_get_indexdef(i.indexrelid), ''),
+		       COALESCE(pg_size_pretty(pg_relation_size(i.indexrelid)), ''),
+		       COALESCE(i.idx_scan, 0)
+		FROM pg_stat_user_indexes i
+		WHERE i.indexrelname = $1
+	`
+	for i := range stats.Indexes {
+		index := &stats.Indexes[i]
+		err = db.conn.QueryRowContext(ctx, query, index.Name).Scan(&index.Definition, &index.Size, &index.Scans)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to get index stats: %w", err)
+		}
+	}
+
+	query = `
+		SELECT pg_size_pretty(pg_total_relation_size('chunk_embeddings')),
+		       (SELECT COUNT(*) FROM chunk_embeddings),
+		       (SELECT COUNT(DISTINCT g.textbook_id) FROM embedding_generations g WHERE g.status = 'active'),
+		       GREATEST(last_analyze, last_autoanalyze)
+		FROM pg_stat_user_tables
+		WHERE relname = 'chunk_embeddings'
+	`
+	err = db.conn.QueryRowContext(ctx, query).Scan(&stats.TableSize, &stats.EmbeddingCount, &stats.TextbookCount, &stats.LastAnalyze)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get table stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// Compare a dotted version string against major.minor
+func versionAtLeast(version string, major, minor int) bool {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	maj, err1 := strconv.Atoi(parts[0])
+	mnr, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	return maj > major || (maj == major && mnr >= minor)
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
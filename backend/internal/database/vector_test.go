@@ -0,0 +1,84 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVectorValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		vector Vector
+		want   string
+	}{
+		{"empty", Vector{}, "[]"},
+		{"integers", Vector{1, -2, 0}, "[1,-2,0]"},
+		{"shortest float32 digits", Vector{0.1, -0.5, 0.33333334}, "[0.1,-0.5,0.33333334]"},
+		{"exponents", Vector{1e-7, 3.4e38}, "[1e-07,3.4e+38]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.vector.Value()
+			if err != nil {
+				t.Fatalf("Value() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Value() = %#v, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVectorValueTooManyDimensions(t *testing.T) {
+	if _, err := make(Vector, MaxVectorDim+1).Value(); err == nil {
+		t.Error("Value() error = nil, want an error")
+	}
+}
+
+func TestVectorScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     interface{}
+		want    Vector
+		wantErr bool
+	}{
+		{name: "null", src: nil, want: nil},
+		{name: "bytes", src: []byte("[1,2.5,-3]"), want: Vector{1, 2.5, -3}},
+		{name: "string with spaces", src: " [0.1, 1e-07] ", want: Vector{0.1, 1e-7}},
+		{name: "empty", src: "[]", want: Vector{}},
+		{name: "missing brackets", src: "1,2", wantErr: true},
+		{name: "bad element", src: "[1,x]", wantErr: true},
+		{name: "empty element", src: "[1,,2]", wantErr: true},
+		{name: "unsupported type", src: 42, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Vector
+			err := got.Scan(tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Scan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Scan() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVectorRoundTrip(t *testing.T) {
+	want := Vector{0.1, 1.0 / 3, -1e-20, 123456.79, 0}
+
+	value, err := want.Value()
+	if err != nil {
+		t.Fatalf("Value() error = %v", err)
+	}
+	var got Vector
+	if err := got.Scan(value); err != nil {
+		t.Fatalf("Scan(%q) error = %v", value, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip through %q = %v, want %v", value, got, want)
+	}
+}
@@ -20,30 +20,24 @@ func NewAuthHandler(authService *services.AuthService) *AuthHandler {
 
 // Handle user registration
 func (h *AuthHandler) HandleRegister(w http.ResponseWriter, r *http.Request) {
-	// Only allow POST requests
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Parse the JSON request body
 	var req models.RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	// Call the auth service to register the user
-	user, err := h.authService.Register(req)
+	user, err := h.authService.Register(r.Context(), req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeServiceError(w, r, err, "Failed to register")
 		return
 	}
 
 	// Generate JWT token for the newly registered user
 	token, err := h.authService.GenerateToken(user.ID, user.Email)
 	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, "Failed to generate token")
 		return
 	}
 
@@ -63,23 +57,17 @@ func (h *AuthHandler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 
 // Handle user login
 func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
-	// Only allow POST requests
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Parse the JSON request body
 	var req models.LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	// Call the auth service to login (verify credentials and generate JWT)
-	token, user, err := h.authService.Login(req)
+	token, user, err := h.authService.Login(r.Context(), req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		writeServiceError(w, r, err, "Failed to log in")
 		return
 	}
 
@@ -99,24 +87,18 @@ func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 
 // Handle email verification
 func (h *AuthHandler) HandleVerify(w http.ResponseWriter, r *http.Request) {
-	// Only allow POST requests
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Parse the verification token from request
 	var req struct {
 		Token string `json:"token"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	// Call the auth service to verify the email
-	if err := h.authService.VerifyEmail(req.Token); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := h.authService.VerifyEmail(r.Context(), req.Token); err != nil {
+		writeServiceError(w, r, err, "Failed to verify email")
 		return
 	}
 
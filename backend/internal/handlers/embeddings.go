@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/database"
+	"github.com/jonkermoo/rag-textbook/backend/internal/middleware"
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+	"github.com/jonkermoo/rag-textbook/backend/internal/services"
+)
+
+type EmbeddingHandler struct {
+	db               *database.DB
+	embeddingService *services.EmbeddingService
+	reembedService   *services.ReembedService
+}
+
+// Create a new embedding handler
+func NewEmbeddingHandler(db *database.DB, embeddingService *services.EmbeddingService, reembedService *services.ReembedService) *EmbeddingHandler {
+	return &EmbeddingHandler{
+		db:               db,
+		embeddingService: embeddingService,
+		reembedService:   reembedService,
+	}
+}
+
+// List a textbook's embedding generations
+func (h *EmbeddingHandler) HandleListEmbeddings(w http.ResponseWriter, r *http.Request) {
+	textbook, ok := h.ownedTextbook(w, r)
+	if !ok {
+		return
+	}
+
+	generations, err := h.db.ListEmbeddingGenerations(r.Context(), textbook.ID)
+	if err != nil {
+		log.Printf("Error listing embedding generations: %v", err)
+		writeServiceError(w, r, err, "Failed to list embeddings")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(generations)
+}
+
+// Re-embed a textbook with another model in the background. Searches keep
+// using the current embeddings until the new ones are complete.
+func (h *EmbeddingHandler) HandleReembed(w http.ResponseWriter, r *http.Request) {
+	textbook, ok := h.ownedTextbook(w, r)
+	if !ok {
+		return
+	}
+	if !textbook.Processed {
+		middleware.WriteErrorCode(w, r, http.StatusConflict, middleware.CodeNotReady, "Textbook not yet processed")
+		return
+	}
+
+	// An empty body re-embeds with the server's embedding model
+	var req models.ReembedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	req.Model = strings.TrimSpace(req.Model)
+	if req.Model == "" {
+		req.Model, req.Dimensions = h.embeddingService.DefaultModel()
+	}
+	if req.Dimensions < 1 || req.Dimensions > database.MaxVectorDim {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("dimensions must be between 1 and %d", database.MaxVectorDim))
+		return
+	}
+
+	generation, err := h.reembedService.Start(r.Context(), textbook.ID, req.Model, req.Dimensions)
+	if err != nil {
+		writeServiceError(w, r, err, "Failed to start re-embed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(generation)
+}
+
+// Load the textbook in the URL path and check that the user owns it. Writes
+// the error response and returns false otherwise.
+func (h *EmbeddingHandler) ownedTextbook(w http.ResponseWriter, r *http.Request) (*models.Textbook, bool) {
+	// Get user ID from context
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return nil, false
+	}
+
+	// Get textbook ID from the URL path
+	textbookID, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid textbook ID")
+		return nil, false
+	}
+
+	textbook, err := h.db.GetTextbook(r.Context(), textbookID)
+	if err != nil {
+		writeServiceError(w, r, err, "Failed to get textbook")
+		return nil, false
+	}
+
+	// Check ownership
+	if textbook.UserID != userID {
+		writeError(w, r, http.StatusForbidden, "Permission denied")
+		return nil, false
+	}
+
+	return textbook, true
+}
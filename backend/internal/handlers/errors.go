@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/apperr"
+	"github.com/jonkermoo/rag-textbook/backend/internal/middleware"
+	"github.com/jonkermoo/rag-textbook/backend/internal/services"
+)
+
+// Write a JSON error response
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	middleware.WriteError(w, r, status, message)
+}
+
+// Respond to an error returned by a service or the database, picking the
+// status from its kind. Errors of no known kind are logged and reported as
+// fallback with a 500.
+func writeServiceError(w http.ResponseWriter, r *http.Request, err error, fallback string) {
+	var timeout *services.TimeoutError
+	if errors.As(err, &timeout) {
+		middleware.WriteErrorCode(w, r, http.StatusGatewayTimeout, middleware.CodeTimeout, "Request timed out during "+timeout.Stage)
+		return
+	}
+	if errors.Is(r.Context().Err(), context.Canceled) {
+		// Nobody is waiting for a response
+		log.Printf("Request %s cancelled by client: %s %s", middleware.GetRequestID(r), r.Method, r.URL.Path)
+		return
+	}
+
+	status, code := http.StatusInternalServerError, middleware.CodeInternal
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		status, code = http.StatusGatewayTimeout, middleware.CodeTimeout
+	case errors.Is(err, services.ErrNotFound):
+		status, code = http.StatusNotFound, middleware.CodeNotFound
+	case errors.Is(err, services.ErrForbidden):
+		status, code = http.StatusForbidden, middleware.CodeForbidden
+	case errors.Is(err, services.ErrUnauthorized):
+		status, code = http.StatusUnauthorized, middleware.CodeUnauthorized
+	case errors.Is(err, services.ErrInvalidInput):
+		status, code = http.StatusBadRequest, middleware.CodeBadRequest
+	case errors.Is(err, services.ErrConflict):
+		status, code = http.StatusConflict, middleware.CodeConflict
+	case errors.Is(err, services.ErrNotReady):
+		status, code = http.StatusConflict, middleware.CodeNotReady
+	case errors.Is(err, services.ErrRateLimited):
+		status, code = http.StatusTooManyRequests, middleware.CodeRateLimited
+	case errors.Is(err, services.ErrUpstreamUnavailable):
+		status, code = http.StatusBadGateway, middleware.CodeUpstreamUnavailable
+	}
+
+	if status >= 500 {
+		log.Printf("Request %s failed: %s %s: %v", middleware.GetRequestID(r), r.Method, r.URL.Path, err)
+	}
+
+	message := fallback
+	var typed *apperr.Error
+	if errors.As(err, &typed) && status != http.StatusInternalServerError {
+		message = typed.Message
+	} else if status == http.StatusGatewayTimeout {
+		message = "Request timed out"
+	}
+
+	middleware.WriteErrorCode(w, r, status, code, message)
+}
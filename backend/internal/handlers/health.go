@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+	"github.com/jonkermoo/rag-textbook/backend/internal/services"
+)
+
+type HealthHandler struct {
+	healthService *services.HealthService
+}
+
+func NewHealthHandler(healthService *services.HealthService) *HealthHandler {
+	return &HealthHandler{
+		healthService: healthService,
+	}
+}
+
+// Liveness: the process is up and serving requests. Dependencies aren't
+// checked, so an outage doesn't get the server restarted.
+func (h *HealthHandler) HandleLive(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, &models.HealthResponse{Status: services.HealthOK})
+}
+
+// Readiness: every dependency is reachable and set up. Responds 503 with
+// each check's status and latency when one fails, so traffic goes elsewhere.
+func (h *HealthHandler) HandleReady(w http.ResponseWriter, r *http.Request) {
+	response := h.healthService.Check(r.Context())
+
+	status := http.StatusOK
+	if response.Status != services.HealthOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeHealth(w, status, response)
+}
+
+func writeHealth(w http.ResponseWriter, status int, response *models.HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
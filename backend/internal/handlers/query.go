@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 
@@ -23,43 +24,49 @@ func NewQueryHandler(ragService *services.RAGService) *QueryHandler {
 
 // Process RAG query request
 func (h *QueryHandler) HandleQuery(w http.ResponseWriter, r *http.Request) {
-	// Only accept POST request
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Get user ID from context (added by auth middleware)
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	// Parse request body
 	var req models.QueryRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	// Validate request
 	if req.Question == "" {
-		http.Error(w, "Question is required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Question is required")
 		return
 	}
 	if req.TextbookID == 0 {
-		http.Error(w, "Textbook ID is required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Textbook ID is required")
+		return
+	}
+	if req.TopK < 0 || req.TopK > services.MaxTopK {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("top_k must be between 1 and %d", services.MaxTopK))
+		return
+	}
+	if !services.IsValidStrategy(req.Strategy) {
+		writeError(w, r, http.StatusBadRequest, "Invalid strategy. Use: rewrite, multi_query or hyde")
+		return
+	}
+	if err := normalizeFilters(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	// Process query
 	log.Printf("Processing query: %s (textbook_id=%d)", req.Question, req.TextbookID)
 
-	resp, err := h.ragService.Query(req, userID)
+	resp, err := h.ragService.Query(r.Context(), req, userID)
 	if err != nil {
 		log.Printf("Query error: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeServiceError(w, r, err, "Failed to answer question")
 		return
 	}
 
@@ -70,8 +77,37 @@ func (h *QueryHandler) HandleQuery(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Query completed in %.2fms", resp.TimeTaken)
 }
 
-// Health check endpoint
-func HandleHealth(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+// Validate query filters and drop them entirely when none are set, so the
+// response only echoes filters that were actually applied
+func normalizeFilters(req *models.QueryRequest) error {
+	if len(req.SectionIDs) > 0 {
+		if req.Filters == nil {
+			req.Filters = &models.QueryFilters{}
+		}
+		req.Filters.SectionIDs = append(req.Filters.SectionIDs, req.SectionIDs...)
+		req.SectionIDs = nil
+	}
+
+	f := req.Filters
+	if f == nil {
+		return nil
+	}
+
+	if f.PageStart < 0 || f.PageEnd < 0 {
+		return fmt.Errorf("page numbers must be positive")
+	}
+	if f.PageStart > 0 && f.PageEnd > 0 && f.PageStart > f.PageEnd {
+		return fmt.Errorf("page_start must not be after page_end")
+	}
+	for _, r := range f.ExcludePages {
+		if r.Start <= 0 || r.End < r.Start {
+			return fmt.Errorf("invalid excluded page range %d-%d", r.Start, r.End)
+		}
+	}
+
+	if f.PageStart == 0 && f.PageEnd == 0 && len(f.SectionIDs) == 0 && len(f.ExcludePages) == 0 {
+		req.Filters = nil
+	}
+
+	return nil
 }
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/middleware"
+	"github.com/jonkermoo/rag-textbook/backend/internal/services"
+)
+
+type SearchHandler struct {
+	searchService *services.SearchService
+}
+
+// Create a new search handler
+func NewSearchHandler(searchService *services.SearchService) *SearchHandler {
+	return &SearchHandler{
+		searchService: searchService,
+	}
+}
+
+// Search all of the user's textbooks
+func (h *SearchHandler) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	h.search(w, r, 0)
+}
+
+// Search a single textbook
+func (h *SearchHandler) HandleSearchTextbook(w http.ResponseWriter, r *http.Request) {
+	// Get textbook ID from the URL path
+	textbookID, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid textbook ID")
+		return
+	}
+
+	h.search(w, r, textbookID)
+}
+
+func (h *SearchHandler) search(w http.ResponseWriter, r *http.Request, textbookID int) {
+	// Get user ID from context
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	params := r.URL.Query()
+
+	query := strings.TrimSpace(params.Get("q"))
+	if query == "" {
+		writeError(w, r, http.StatusBadRequest, "Query parameter q is required")
+		return
+	}
+
+	page := 1
+	if v := params.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, r, http.StatusBadRequest, "page must be a positive integer")
+			return
+		}
+		page = n
+	}
+
+	pageSize := services.DefaultSearchPageSize
+	if v := params.Get("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > services.MaxSearchPageSize {
+			writeError(w, r, http.StatusBadRequest, "page_size must be between 1 and 50")
+			return
+		}
+		pageSize = n
+	}
+
+	minScore := 0.0
+	if v := params.Get("min_score"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 1 {
+			writeError(w, r, http.StatusBadRequest, "min_score must be between 0 and 1")
+			return
+		}
+		minScore = f
+	}
+
+	resp, err := h.searchService.Search(r.Context(), userID, textbookID, query, page, pageSize, minScore)
+	if err != nil {
+		writeServiceError(w, r, err, "Search failed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/database"
+	"github.com/jonkermoo/rag-textbook/backend/internal/middleware"
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+	"github.com/jonkermoo/rag-textbook/backend/internal/services"
+)
+
+type SettingsHandler struct {
+	db         *database.DB
+	ragService *services.RAGService
+}
+
+// Create a new settings handler
+func NewSettingsHandler(db *database.DB, ragService *services.RAGService) *SettingsHandler {
+	return &SettingsHandler{
+		db:         db,
+		ragService: ragService,
+	}
+}
+
+// Get the user's query settings
+func (h *SettingsHandler) HandleGetSettings(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	h.writeSettings(w, r, userID)
+}
+
+// Update the user's query settings
+func (h *SettingsHandler) HandleUpdateSettings(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.SettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !validRelevanceThreshold(req.RelevanceThreshold) {
+		writeError(w, r, http.StatusBadRequest, "relevance_threshold must be between 0 and 2")
+		return
+	}
+	if err := h.db.UpdateUserRelevanceThreshold(r.Context(), userID, req.RelevanceThreshold); err != nil {
+		log.Printf("Error updating settings: %v", err)
+		writeServiceError(w, r, err, "Failed to update settings")
+		return
+	}
+
+	h.writeSettings(w, r, userID)
+}
+
+// Respond with the user's current settings
+func (h *SettingsHandler) writeSettings(w http.ResponseWriter, r *http.Request, userID int) {
+	threshold, err := h.db.GetUserRelevanceThreshold(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting settings: %v", err)
+		writeServiceError(w, r, err, "Failed to get settings")
+		return
+	}
+
+	response := models.SettingsResponse{
+		RelevanceThreshold:        threshold,
+		DefaultRelevanceThreshold: h.ragService.DefaultRelevanceThreshold(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -6,7 +6,6 @@ import (
 	"log"
 	"net/http"
 	"strconv"
-	"strings"
 
 	"github.com/jonkermoo/rag-textbook/backend/internal/database"
 	"github.com/jonkermoo/rag-textbook/backend/internal/middleware"
@@ -23,23 +22,18 @@ func NewTextbookHandler(db *database.DB) *TextbookHandler {
 
 // List all textbooks for the authenticated user
 func (h *TextbookHandler) HandleListTextbooks(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Get user ID from context
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	// Get textbooks from database
-	textbooks, err := h.db.ListTextbooks(userID)
+	textbooks, err := h.db.ListTextbooks(r.Context(), userID)
 	if err != nil {
 		log.Printf("Error listing textbooks: %v", err)
-		http.Error(w, "Failed to list textbooks", http.StatusInternalServerError)
+		writeServiceError(w, r, err, "Failed to list textbooks")
 		return
 	}
 
@@ -54,36 +48,30 @@ func (h *TextbookHandler) HandleListTextbooks(w http.ResponseWriter, r *http.Req
 
 // Get a single textbook by ID
 func (h *TextbookHandler) HandleGetTextbook(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Get user ID from context
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	// Extract textbook ID from URL path
-	// Expecting: /api/textbooks/123
-	textbookID, err := extractIDFromPath(r.URL.Path, "/api/textbooks/")
+	// Get textbook ID from the URL path
+	textbookID, err := pathID(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid textbook ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid textbook ID")
 		return
 	}
 
 	// Get textbook from database
-	textbook, err := h.db.GetTextbook(textbookID)
+	textbook, err := h.db.GetTextbook(r.Context(), textbookID)
 	if err != nil {
-		http.Error(w, "Textbook not found", http.StatusNotFound)
+		writeServiceError(w, r, err, "Failed to get textbook")
 		return
 	}
 
 	// Check ownership
 	if textbook.UserID != userID {
-		http.Error(w, "Permission denied", http.StatusForbidden)
+		writeError(w, r, http.StatusForbidden, "Permission denied")
 		return
 	}
 
@@ -93,38 +81,24 @@ func (h *TextbookHandler) HandleGetTextbook(w http.ResponseWriter, r *http.Reque
 
 // Delete a textbook
 func (h *TextbookHandler) HandleDeleteTextbook(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Get user ID from context
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	// Extract textbook ID from URL path
-	textbookID, err := extractIDFromPath(r.URL.Path, "/api/textbooks/")
+	// Get textbook ID from the URL path
+	textbookID, err := pathID(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid textbook ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid textbook ID")
 		return
 	}
 
 	// Delete textbook (also deletes chunks via database method)
-	err = h.db.DeleteTextbook(textbookID, userID)
+	err = h.db.DeleteTextbook(r.Context(), textbookID, userID)
 	if err != nil {
-		if strings.Contains(err.Error(), "permission denied") {
-			http.Error(w, "Permission denied", http.StatusForbidden)
-			return
-		}
-		if strings.Contains(err.Error(), "not found") {
-			http.Error(w, "Textbook not found", http.StatusNotFound)
-			return
-		}
-		log.Printf("Error deleting textbook: %v", err)
-		http.Error(w, "Failed to delete textbook", http.StatusInternalServerError)
+		writeServiceError(w, r, err, "Failed to delete textbook")
 		return
 	}
 
@@ -136,69 +110,189 @@ func (h *TextbookHandler) HandleDeleteTextbook(w http.ResponseWriter, r *http.Re
 	})
 }
 
-// Get textbook processing status
-func (h *TextbookHandler) HandleGetTextbookStatus(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// Update textbook settings (currently the relevance threshold)
+func (h *TextbookHandler) HandleUpdateTextbook(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get textbook ID from the URL path
+	textbookID, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid textbook ID")
 		return
 	}
 
+	// Parse request body
+	var req models.SettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !validRelevanceThreshold(req.RelevanceThreshold) {
+		writeError(w, r, http.StatusBadRequest, "relevance_threshold must be between 0 and 2")
+		return
+	}
+
+	// Only updates textbooks the user owns
+	if err := h.db.UpdateTextbookRelevanceThreshold(r.Context(), textbookID, userID, req.RelevanceThreshold); err != nil {
+		writeServiceError(w, r, err, "Failed to update textbook")
+		return
+	}
+
+	textbook, err := h.db.GetTextbook(r.Context(), textbookID)
+	if err != nil {
+		writeServiceError(w, r, err, "Failed to get textbook")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(textbook)
+}
+
+// Get textbook processing status
+func (h *TextbookHandler) HandleGetTextbookStatus(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	// Extract textbook ID from URL path
-	// Expecting: /api/textbooks/123/status
-	textbookID, err := extractIDFromPath(r.URL.Path, "/api/textbooks/")
+	// Get textbook ID from the URL path
+	textbookID, err := pathID(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid textbook ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid textbook ID")
 		return
 	}
 
 	// Get textbook from database
-	textbook, err := h.db.GetTextbook(textbookID)
+	textbook, err := h.db.GetTextbook(r.Context(), textbookID)
 	if err != nil {
-		http.Error(w, "Textbook not found", http.StatusNotFound)
+		writeServiceError(w, r, err, "Failed to get textbook")
 		return
 	}
 
 	// Check ownership
 	if textbook.UserID != userID {
-		http.Error(w, "Permission denied", http.StatusForbidden)
+		writeError(w, r, http.StatusForbidden, "Permission denied")
 		return
 	}
 
 	// Get chunk count
-	chunkCount, err := h.db.GetTextbookChunkCount(textbookID)
+	chunkCount, err := h.db.GetTextbookChunkCount(r.Context(), textbookID)
 	if err != nil {
 		log.Printf("Error getting chunk count: %v", err)
 		chunkCount = 0
 	}
 
+	// Get OCR / dropped page stats
+	pageStats, err := h.db.GetTextbookPageStats(r.Context(), textbookID)
+	if err != nil {
+		log.Printf("Error getting page stats: %v", err)
+		pageStats = &models.PageStats{}
+	}
+
 	status := map[string]interface{}{
-		"textbook_id": textbook.ID,
-		"title":       textbook.Title,
-		"processed":   textbook.Processed,
-		"chunk_count": chunkCount,
-		"uploaded_at": textbook.UploadedAt,
+		"textbook_id":        textbook.ID,
+		"title":              textbook.Title,
+		"processed":          textbook.Processed,
+		"ingestion_status":   textbook.IngestionStatus,
+		"chunk_count":        chunkCount,
+		"page_count":         pageStats.PageCount,
+		"ocr_page_count":     pageStats.OCRPageCount,
+		"dropped_page_count": pageStats.DroppedPageCount,
+		"uploaded_at":        textbook.UploadedAt,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(status)
 }
 
-// Helper function to extract ID from URL path
-func extractIDFromPath(path, prefix string) (int, error) {
-	// Remove prefix and any trailing parts (like /status)
-	idStr := strings.TrimPrefix(path, prefix)
-	idStr = strings.Split(idStr, "/")[0]
+// Get the textbook's table of contents as a tree of sections
+func (h *TextbookHandler) HandleGetTextbookOutline(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get textbook ID from the URL path
+	textbookID, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid textbook ID")
+		return
+	}
+
+	// Get textbook from database
+	textbook, err := h.db.GetTextbook(r.Context(), textbookID)
+	if err != nil {
+		writeServiceError(w, r, err, "Failed to get textbook")
+		return
+	}
+
+	// Check ownership
+	if textbook.UserID != userID {
+		writeError(w, r, http.StatusForbidden, "Permission denied")
+		return
+	}
+
+	sections, err := h.db.ListSections(r.Context(), textbookID)
+	if err != nil {
+		log.Printf("Error listing sections: %v", err)
+		writeServiceError(w, r, err, "Failed to get outline")
+		return
+	}
+
+	response := models.OutlineResponse{
+		TextbookID: textbook.ID,
+		Sections:   buildSectionTree(sections),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Nest a flat, ordered section list under its parents
+func buildSectionTree(sections []models.Section) []models.Section {
+	children := make(map[int][]models.Section)
+	var roots []models.Section
+
+	// Walk backwards so children are complete before their parent is attached
+	for i := len(sections) - 1; i >= 0; i-- {
+		section := sections[i]
+		section.Children = children[section.ID]
+		if section.ParentID == nil {
+			roots = append([]models.Section{section}, roots...)
+		} else {
+			children[*section.ParentID] = append([]models.Section{section}, children[*section.ParentID]...)
+		}
+	}
+
+	// Return empty array if no outline (not null)
+	if roots == nil {
+		roots = []models.Section{}
+	}
+
+	return roots
+}
+
+// A threshold is a cosine distance, so valid values are in (0, 2]; nil clears it
+func validRelevanceThreshold(threshold *float64) bool {
+	return threshold == nil || (*threshold > 0 && *threshold <= 2)
+}
+
+// Integer path parameter, e.g. {id} in /api/textbooks/{id}
+func pathID(r *http.Request, name string) (int, error) {
+	value := r.PathValue(name)
 
-	id, err := strconv.Atoi(idStr)
+	id, err := strconv.Atoi(value)
 	if err != nil {
-		return 0, fmt.Errorf("invalid ID: %s", idStr)
+		return 0, fmt.Errorf("invalid ID: %s", value)
 	}
 
 	return id, nil
@@ -3,73 +3,90 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
-	"os"
-	"os/exec"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jonkermoo/rag-textbook/backend/internal/config"
 	"github.com/jonkermoo/rag-textbook/backend/internal/database"
 	"github.com/jonkermoo/rag-textbook/backend/internal/middleware"
 	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+	"github.com/jonkermoo/rag-textbook/backend/internal/services"
 )
 
-type UploadHandler struct {
-	db       *database.DB
-	s3Client *s3.S3
-	s3Bucket string
+// Supported document formats and the content type stored in S3
+var supportedFormats = map[string]string{
+	".pdf":      "application/pdf",
+	".epub":     "application/epub+zip",
+	".docx":     "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".pptx":     "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".md":       "text/markdown",
+	".markdown": "text/markdown",
+	".html":     "text/html",
+	".htm":      "text/html",
 }
 
-func NewUploadHandler(db *database.DB) *UploadHandler {
-	// Initialize AWS session
-	sess := session.Must(session.NewSession(&aws.Config{
-		Region: aws.String(os.Getenv("AWS_REGION")),
-	}))
+type UploadHandler struct {
+	db               *database.DB
+	ingestionService *services.IngestionService
+	s3Client         *s3.S3
+	s3Bucket         string
+	uploadTimeout    time.Duration // Replaces the server's read and write timeouts
+}
 
+func NewUploadHandler(db *database.DB, ingestionService *services.IngestionService, s3Client *s3.S3, cfg *config.Config) *UploadHandler {
 	return &UploadHandler{
-		db:       db,
-		s3Client: s3.New(sess),
-		s3Bucket: os.Getenv("S3_BUCKET_NAME"),
+		db:               db,
+		ingestionService: ingestionService,
+		s3Client:         s3Client,
+		s3Bucket:         cfg.Storage.S3Bucket,
+		uploadTimeout:    cfg.Server.UploadTimeout,
 	}
 }
 
-// Handle PDF upload
+// Handle document upload (PDF, EPUB, DOCX, PPTX, Markdown or HTML)
 func (h *UploadHandler) HandleUpload(w http.ResponseWriter, r *http.Request) {
-	// Only accept POST requests
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Get user ID from context (added by auth middleware)
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
+	// Large files take longer to send than the server's timeouts allow
+	deadline := time.Now().Add(h.uploadTimeout)
+	controller := http.NewResponseController(w)
+	if err := controller.SetReadDeadline(deadline); err != nil {
+		log.Printf("Failed to extend upload read deadline: %v", err)
+	}
+	if err := controller.SetWriteDeadline(deadline); err != nil {
+		log.Printf("Failed to extend upload write deadline: %v", err)
+	}
+
 	// Parse multipart form (max 2GB)
 	err := r.ParseMultipartForm(2 << 30)
 	if err != nil {
-		http.Error(w, "File too large or invalid form data", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "File too large or invalid form data")
 		return
 	}
 
 	// Get the file from form
 	file, header, err := r.FormFile("file")
 	if err != nil {
-		http.Error(w, "No file provided", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "No file provided")
 		return
 	}
 	defer file.Close()
 
-	// Validate file is a PDF
-	if !strings.HasSuffix(strings.ToLower(header.Filename), ".pdf") {
-		http.Error(w, "Only PDF files are allowed", http.StatusBadRequest)
+	// Validate file is a supported document format
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	contentType, ok := supportedFormats[ext]
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, "Unsupported file type. Allowed: PDF, EPUB, DOCX, PPTX, Markdown, HTML")
 		return
 	}
 
@@ -77,15 +94,15 @@ func (h *UploadHandler) HandleUpload(w http.ResponseWriter, r *http.Request) {
 	s3Key := fmt.Sprintf("textbooks/%d/%s", userID, header.Filename)
 
 	// Upload file to S3
-	_, err = h.s3Client.PutObject(&s3.PutObjectInput{
+	_, err = h.s3Client.PutObjectWithContext(r.Context(), &s3.PutObjectInput{
 		Bucket:      aws.String(h.s3Bucket),
 		Key:         aws.String(s3Key),
 		Body:        file,
-		ContentType: aws.String("application/pdf"),
+		ContentType: aws.String(contentType),
 	})
 	if err != nil {
 		log.Printf("Failed to upload to S3: %v", err)
-		http.Error(w, "Failed to upload file", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, "Failed to upload file")
 		return
 	}
 
@@ -94,20 +111,20 @@ func (h *UploadHandler) HandleUpload(w http.ResponseWriter, r *http.Request) {
 	// Get title from form or use filename
 	title := r.FormValue("title")
 	if title == "" {
-		title = strings.TrimSuffix(header.Filename, ".pdf")
+		title = strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
 	}
 
 	// Create textbook record in database with S3 key
-	textbook, err := h.db.CreateTextbook(userID, title, s3Key)
+	textbook, err := h.db.CreateTextbook(r.Context(), userID, title, s3Key)
 	if err != nil {
 		log.Printf("Failed to create textbook record: %v", err)
-		http.Error(w, "Failed to create textbook record", http.StatusInternalServerError)
+		writeServiceError(w, r, err, "Failed to create textbook record")
 		return
 	}
 
 	log.Printf("File uploaded successfully: %s (textbook_id=%d)", s3Key, textbook.ID)
 	// Trigger background processing
-	h.triggerProcessing(textbook.ID, s3Key)
+	h.ingestionService.Start(textbook.ID, s3Key)
 	log.Printf("Processing triggered for textbook_id=%d", textbook.ID)
 
 	// Return response
@@ -120,57 +137,3 @@ func (h *UploadHandler) HandleUpload(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
-
-// triggerProcessing launches the Python ingestion pipeline in the background
-func (h *UploadHandler) triggerProcessing(textbookID int, s3Key string) {
-	go func() {
-		log.Printf("Starting background processing for textbook %d", textbookID)
-
-		// Download PDF from S3 to temporary file
-		tmpFile := fmt.Sprintf("/tmp/textbook_%d.pdf", textbookID)
-
-		result, err := h.s3Client.GetObject(&s3.GetObjectInput{
-			Bucket: aws.String(h.s3Bucket),
-			Key:    aws.String(s3Key),
-		})
-		if err != nil {
-			log.Printf("Error downloading from S3: %v", err)
-			return
-		}
-		defer result.Body.Close()
-
-		// Create temporary file
-		outFile, err := os.Create(tmpFile)
-		if err != nil {
-			log.Printf("Error creating temp file: %v", err)
-			return
-		}
-		defer outFile.Close()
-		defer os.Remove(tmpFile) // Clean up after processing
-
-		// Copy S3 object to file
-		_, err = io.Copy(outFile, result.Body)
-		if err != nil {
-			log.Printf("Error saving temp file: %v", err)
-			return
-		}
-
-		pythonScript := "./ingestion/src/process_existing.py"
-
-		// Run the Python script with local temp file
-		cmd := exec.Command("python3", pythonScript,
-			fmt.Sprintf("%d", textbookID),
-			tmpFile)
-
-		// Capture output
-		output, err := cmd.CombinedOutput()
-
-		if err != nil {
-			log.Printf("Error processing textbook %d: %v", textbookID, err)
-			log.Printf("Python output: %s", string(output))
-		} else {
-			log.Printf("Successfully processed textbook %d", textbookID)
-			log.Printf("Python output: %s", string(output))
-		}
-	}()
-}
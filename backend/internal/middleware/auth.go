@@ -20,14 +20,14 @@ func AuthMiddleware(authService *services.AuthService) func(http.Handler) http.H
 			// Get Authorization header
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
-				http.Error(w, "Missing authorization header", http.StatusUnauthorized)
+				WriteError(w, r, http.StatusUnauthorized, "Missing authorization header")
 				return
 			}
 
 			// Check if it's a Bearer token
 			parts := strings.Split(authHeader, " ")
 			if len(parts) != 2 || parts[0] != "Bearer" {
-				http.Error(w, "Invalid authorization header format. Use: Bearer <token>", http.StatusUnauthorized)
+				WriteError(w, r, http.StatusUnauthorized, "Invalid authorization header format. Use: Bearer <token>")
 				return
 			}
 
@@ -36,7 +36,7 @@ func AuthMiddleware(authService *services.AuthService) func(http.Handler) http.H
 			// Validate the JWT token
 			userID, err := authService.ValidateToken(token)
 			if err != nil {
-				http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+				WriteError(w, r, http.StatusUnauthorized, "Invalid or expired token")
 				return
 			}
 
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Middleware that records its name before and after the wrapped handler
+func recording(name string, calls *[]string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*calls = append(*calls, name)
+			next.ServeHTTP(w, r)
+			*calls = append(*calls, "/"+name)
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		want  []string
+	}{
+		{"empty", nil, []string{"handler"}},
+		{"one", []string{"a"}, []string{"a", "handler", "/a"}},
+		{"first is outermost", []string{"a", "b", "c"}, []string{"a", "b", "c", "handler", "/c", "/b", "/a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			var middlewares []Middleware
+			for _, name := range tt.names {
+				middlewares = append(middlewares, recording(name, &calls))
+			}
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, "handler")
+			})
+
+			Chain(middlewares...)(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if !reflect.DeepEqual(calls, tt.want) {
+				t.Errorf("calls = %v, want %v", calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestChainShortCircuit(t *testing.T) {
+	var calls []string
+	deny := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			WriteError(w, r, http.StatusUnauthorized, "Unauthorized")
+		})
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+	})
+
+	rec := httptest.NewRecorder()
+	Chain(recording("a", &calls), deny, recording("b", &calls))(handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if want := []string{"a", "/a"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), CodeUnauthorized) {
+		t.Errorf("response = %d %s, want a 401 %s error", rec.Code, rec.Body.String(), CodeUnauthorized)
+	}
+}
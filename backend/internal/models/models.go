@@ -24,46 +24,240 @@ type Class struct {
 
 // Textbook represents an uploaded textbook
 type Textbook struct {
-	ID         int       `json:"id"`
-	UserID     int       `json:"user_id"`
-	Title      string    `json:"title"`
-	S3Key      string    `json:"s3_key"`
-	UploadedAt time.Time `json:"uploaded_at"`
-	Processed  bool      `json:"processed"`
+	ID                 int       `json:"id"`
+	UserID             int       `json:"user_id"`
+	Title              string    `json:"title"`
+	S3Key              string    `json:"s3_key"`
+	UploadedAt         time.Time `json:"uploaded_at"`
+	Processed          bool      `json:"processed"`
+	IngestionStatus    string    `json:"ingestion_status"`              // "pending", "running", "interrupted", "complete" or "failed"
+	RelevanceThreshold *float64  `json:"relevance_threshold,omitempty"` // Max cosine distance for a relevant chunk; nil uses the user/server default
 }
 
 // Chunk: text chunk with embedding
 type Chunk struct {
+	ID            int          `json:"id"`
+	TextbookID    int          `json:"textbook_id"`
+	Content       string       `json:"content"`
+	PageNumber    int          `json:"page_number"`
+	PageEnd       int          `json:"page_end"`               // Last page the chunk spans (same as PageNumber for single-page chunks)
+	Location      string       `json:"location,omitempty"`     // Citation label: "Page 12", "Slide 4", or a section heading
+	SectionPath   string       `json:"section_path,omitempty"` // Heading path: "Chapter 4 > 4.2 Eigenvalues"
+	ChunkIndex    int          `json:"chunk_index"`
+	OCRConfidence *float64     `json:"ocr_confidence,omitempty"` // Set when the text came from OCR (0..1)
+	Embedding     []float32    `json:"-"`
+	CreatedAt     time.Time    `json:"created_at"`
+	Distance      float64      `json:"distance"`         // Cosine distance from the question (0 = identical, higher = less similar)
+	Scores        *StageScores `json:"scores,omitempty"` // Per-stage retrieval scores when reranking or MMR ran
+}
+
+// StageScores: how a chunk scored at each retrieval stage (for debugging)
+type StageScores struct {
+	VectorRank       int      `json:"vector_rank"`            // 1-based rank among the candidates by similarity to the question
+	VectorSimilarity float64  `json:"vector_similarity"`      // 1 - cosine distance from the question
+	FusionScore      *float64 `json:"fusion_score,omitempty"` // Reciprocal rank fusion score (multi-query)
+	FusionRank       int      `json:"fusion_rank,omitempty"`  // 1-based position after fusing the queries' results (multi-query)
+	RerankScore      *float64 `json:"rerank_score,omitempty"` // Reranker relevance (0..1)
+	MMRScore         *float64 `json:"mmr_score,omitempty"`    // Marginal relevance when the chunk was picked
+	FinalRank        int      `json:"final_rank"`             // 1-based position after all stages
+}
+
+// RetrievalInfo: summary of the retrieval pipeline for a query
+type RetrievalInfo struct {
+	EmbeddingModel string   `json:"embedding_model"`     // Model the textbook's active embeddings (and the query) use
+	Strategy       string   `json:"strategy,omitempty"`  // Pre-retrieval strategy used, if any
+	Queries        []string `json:"queries,omitempty"`   // Generated queries (or HyDE passage) that were embedded
+	Candidates     int      `json:"candidates"`          // Chunks fetched from vector search
+	Reranker       string   `json:"reranker,omitempty"`  // Reranker used, if any
+	Diversity      float64  `json:"diversity,omitempty"` // MMR diversity used, if any
+	Returned       int      `json:"returned"`            // Chunks passed to the prompt
+	ContextTokens  int      `json:"context_tokens"`      // Tokens of context in the prompt
+	ContextBudget  int      `json:"context_budget"`      // Token budget for context
+	Dropped        int      `json:"dropped,omitempty"`   // Chunks left out or cut short by the budget
+
+	// The top K chunks in final order, before the relevance threshold and
+	// context packing drop any
+	Ranked []RankedChunk `json:"ranked,omitempty"`
+}
+
+// RankedChunk: a chunk retrieval ranked in the top K
+type RankedChunk struct {
+	ChunkID    int     `json:"chunk_id"`
+	PageNumber int     `json:"page_number"`
+	PageEnd    int     `json:"page_end"`
+	Distance   float64 `json:"distance"` // From the question
+	Relevant   bool    `json:"relevant"` // Within the relevance threshold
+}
+
+// Section: an entry in a textbook's table of contents
+type Section struct {
 	ID         int       `json:"id"`
 	TextbookID int       `json:"textbook_id"`
-	Content    string    `json:"content"`
-	PageNumber int       `json:"page_number"`
-	ChunkIndex int       `json:"chunk_index"`
-	Embedding  []float32 `json:"-"`
-	CreatedAt  time.Time `json:"created_at"`
-	Distance   float64   `json:"distance"` // Cosine distance from query (0 = identical, higher = less similar)
+	ParentID   *int      `json:"parent_id,omitempty"`
+	Level      int       `json:"level"`
+	Title      string    `json:"title"`
+	PageStart  int       `json:"page_start"`
+	PageEnd    int       `json:"page_end"`
+	Children   []Section `json:"children,omitempty"`
+}
+
+// OutlineResponse
+type OutlineResponse struct {
+	TextbookID int       `json:"textbook_id"`
+	Sections   []Section `json:"sections"`
+}
+
+// PageStats: extraction results recorded by the ingestion pipeline
+type PageStats struct {
+	PageCount        int `json:"page_count"`
+	OCRPageCount     int `json:"ocr_page_count"`
+	DroppedPageCount int `json:"dropped_page_count"`
 }
 
 // QueryRequest
 type QueryRequest struct {
-	Question   string `json:"question"`
-	TextbookID int    `json:"textbook_id"`
-	TopK       int    `json:"top_k"`
+	Question   string        `json:"question"`
+	TextbookID int           `json:"textbook_id"`
+	TopK       int           `json:"top_k"`
+	Filters    *QueryFilters `json:"filters,omitempty"`
+	Rerank     bool          `json:"rerank,omitempty"`    // Over-fetch and rerank candidates (if a reranker is configured)
+	Diversity  *float64      `json:"diversity,omitempty"` // MMR diversity 0..1 (0 = pure relevance); server default if unset
+	Strategy   string        `json:"strategy,omitempty"`  // Pre-retrieval strategy: "rewrite", "multi_query" or "hyde"
+
+	CheckFaithfulness bool `json:"check_faithfulness,omitempty"` // Grade the answer's grounding in the retrieved chunks
+	NoCache           bool `json:"no_cache,omitempty"`           // Always generate a fresh answer (and don't cache it)
+
+	// Earlier form of filters.section_ids, still accepted and merged into it
+	SectionIDs []int `json:"section_ids,omitempty"`
+}
+
+// QueryFilters: optional restrictions applied inside the similarity search
+type QueryFilters struct {
+	PageStart    int         `json:"page_start,omitempty"`    // Only pages >= PageStart
+	PageEnd      int         `json:"page_end,omitempty"`      // Only pages <= PageEnd
+	SectionIDs   []int       `json:"section_ids,omitempty"`   // Only these chapters/sections (from the outline)
+	ExcludePages []PageRange `json:"exclude_pages,omitempty"` // Skip these pages, e.g. index or bibliography
+}
+
+// PageRange: inclusive range of pages
+type PageRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
 }
 
 // QueryResponse
 type QueryResponse struct {
-	Answer    string        `json:"answer"`
-	Sources   []ChunkSource `json:"sources"`
-	Question  string        `json:"question"`
-	TimeTaken float64       `json:"time_taken_ms"`
+	Answer       string         `json:"answer"`
+	AnswerMode   string         `json:"answer_mode"`         // "textbook" or "not_covered"
+	Coverage     string         `json:"coverage"`            // "none", "partial" or "full"
+	Threshold    float64        `json:"relevance_threshold"` // Max cosine distance used to judge relevance
+	Sources      []ChunkSource  `json:"sources"`
+	Citations    []Citation     `json:"citations"`                   // Validated citations in the answer
+	Invalid      []int          `json:"invalid_citations,omitempty"` // Chunk IDs the model cited that weren't retrieved (stripped)
+	Faithfulness *Faithfulness  `json:"faithfulness,omitempty"`      // Grounding check, when requested
+	Question     string         `json:"question"`
+	Filters      *QueryFilters  `json:"filters,omitempty"`   // Filters that were applied, if any
+	Retrieval    *RetrievalInfo `json:"retrieval,omitempty"` // Retrieval pipeline details
+	Cached       bool           `json:"cached"`              // Answer reused from a near-identical earlier question
+	TimeTaken    float64        `json:"time_taken_ms"`
 }
 
 // ChunkSource
 type ChunkSource struct {
-	PageNumber int     `json:"page_number"`
-	Content    string  `json:"content"`
-	Similarity float64 `json:"similarity"`
+	ChunkID       int          `json:"chunk_id"`
+	TextbookID    int          `json:"textbook_id"`
+	PageNumber    int          `json:"page_number"`
+	PageEnd       int          `json:"page_end"`
+	Location      string       `json:"location,omitempty"`
+	SectionPath   string       `json:"section_path,omitempty"`
+	Content       string       `json:"content"`
+	Similarity    float64      `json:"similarity"`
+	OCRConfidence *float64     `json:"ocr_confidence,omitempty"`
+	Scores        *StageScores `json:"scores,omitempty"`
+}
+
+// Citation links a span of the answer to the source chunk it cites.
+// Offsets are rune (code point) positions in the answer text.
+type Citation struct {
+	ChunkID     int `json:"chunk_id"`
+	TextbookID  int `json:"textbook_id"`
+	SourceIndex int `json:"source_index"` // Index into QueryResponse.Sources
+	PageNumber  int `json:"page_number"`
+	PageEnd     int `json:"page_end"`
+	Start       int `json:"start"`        // Start of the cited sentence
+	End         int `json:"end"`          // End of the cited sentence (before the marker)
+	MarkerStart int `json:"marker_start"` // The "[n]" marker itself
+	MarkerEnd   int `json:"marker_end"`
+}
+
+// Faithfulness: how well the answer is grounded in the retrieved chunks
+type Faithfulness struct {
+	Score       float64         `json:"score"` // Supported / (supported + unsupported) sentences
+	Supported   int             `json:"supported"`
+	Unsupported int             `json:"unsupported"`
+	Sentences   []SentenceLabel `json:"sentences"`
+	Model       string          `json:"model"`
+}
+
+// SentenceLabel: grounding label for one answer sentence (rune offsets)
+type SentenceLabel struct {
+	Text     string `json:"text"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	Label    string `json:"label"`               // "supported", "unsupported" or "not_applicable"
+	ChunkIDs []int  `json:"chunk_ids,omitempty"` // Chunks that support the sentence
+}
+
+// SearchResponse: a page of semantic search hits (no answer generation)
+type SearchResponse struct {
+	Query      string      `json:"query"`
+	TextbookID int         `json:"textbook_id,omitempty"` // Unset for library-wide searches
+	Page       int         `json:"page"`
+	PageSize   int         `json:"page_size"`
+	HasMore    bool        `json:"has_more"`
+	Hits       []SearchHit `json:"hits"`
+	TimeTaken  float64     `json:"time_taken_ms"`
+}
+
+// SearchHit: one matching chunk with a highlighted snippet
+type SearchHit struct {
+	ChunkID       int         `json:"chunk_id"`
+	TextbookID    int         `json:"textbook_id"`
+	TextbookTitle string      `json:"textbook_title"`
+	PageNumber    int         `json:"page_number"`
+	PageEnd       int         `json:"page_end"`
+	Location      string      `json:"location,omitempty"`
+	SectionPath   string      `json:"section_path,omitempty"`
+	Snippet       string      `json:"snippet"`
+	Highlights    []Highlight `json:"highlights"` // Query term matches in the snippet
+	Score         float64     `json:"score"`      // 1 - cosine distance
+	Content       string      `json:"-"`
+}
+
+// Highlight: rune offsets of a match within a snippet
+type Highlight struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// EmbeddingGeneration: one embedding model's vectors for a textbook's chunks
+type EmbeddingGeneration struct {
+	ID            int        `json:"id"`
+	TextbookID    int        `json:"textbook_id"`
+	Model         string     `json:"model"`
+	Dimensions    int        `json:"dimensions"`
+	Status        string     `json:"status"` // "building", "active", "retired" or "failed"
+	ChunkCount    int        `json:"chunk_count"`
+	EmbeddedCount int        `json:"embedded_count"`
+	Error         string     `json:"error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ActivatedAt   *time.Time `json:"activated_at,omitempty"`
+}
+
+// Re-embed request; empty fields use the server's embedding model
+type ReembedRequest struct {
+	Model      string `json:"model"`
+	Dimensions int    `json:"dimensions"`
 }
 
 // Auth request/response models
@@ -86,9 +280,42 @@ type VerifyEmailRequest struct {
 	Token string `json:"token"`
 }
 
+// Settings request/response models
+type SettingsRequest struct {
+	RelevanceThreshold *float64 `json:"relevance_threshold"` // null resets to the default
+}
+
+type SettingsResponse struct {
+	RelevanceThreshold        *float64 `json:"relevance_threshold"`
+	DefaultRelevanceThreshold float64  `json:"default_relevance_threshold"`
+}
+
 // Upload request/response models
 type UploadResponse struct {
 	TextbookID int    `json:"textbook_id"`
 	Title      string `json:"title"`
 	Message    string `json:"message"`
 }
+
+// Error response returned by every endpoint
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Code      string `json:"code"` // Machine-readable, e.g. "not_found"
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Health check response models
+type HealthResponse struct {
+	Status string                 `json:"status"` // "ok" when every check passed, otherwise "unavailable"
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+// Public result of one dependency check; details only go to the log
+type HealthCheck struct {
+	Status    string  `json:"status"` // "ok" or "fail"
+	LatencyMS float64 `json:"latency_ms"`
+}
@@ -0,0 +1,81 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/middleware"
+)
+
+// Router registers handlers with http.ServeMux patterns such as
+// "GET /api/textbooks/{id}" and wraps them in a middleware chain. Requests
+// that match no route get the same JSON errors as the handlers.
+type Router struct {
+	mux         *http.ServeMux
+	middlewares []middleware.Middleware
+}
+
+// Create an empty router
+func New() *Router {
+	return &Router{mux: http.NewServeMux()}
+}
+
+// Router that shares these routes but wraps the handlers registered through
+// it in more middleware, e.g. authentication for a group of routes
+func (rt *Router) With(middlewares ...middleware.Middleware) *Router {
+	return &Router{
+		mux:         rt.mux,
+		middlewares: append(append([]middleware.Middleware{}, rt.middlewares...), middlewares...),
+	}
+}
+
+// Register a handler for a pattern ("METHOD /path/{param}")
+func (rt *Router) Handle(pattern string, handler http.Handler) {
+	rt.mux.Handle(pattern, middleware.Chain(rt.middlewares...)(handler))
+}
+
+// Register a handler function for a pattern ("METHOD /path/{param}")
+func (rt *Router) HandleFunc(pattern string, handler http.HandlerFunc) {
+	rt.Handle(pattern, handler)
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler, pattern := rt.mux.Handler(r)
+	if pattern == "" {
+		// The mux's own 404 and 405 responses are plain text
+		handler.ServeHTTP(&unmatchedWriter{ResponseWriter: w, r: r}, r)
+		return
+	}
+	rt.mux.ServeHTTP(w, r)
+}
+
+// Replaces the mux's plain text error for an unmatched request with a JSON
+// one, keeping headers such as Allow
+type unmatchedWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	wroteHeader bool
+}
+
+func (w *unmatchedWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	message := http.StatusText(status)
+	switch status {
+	case http.StatusNotFound:
+		message = "Not found"
+	case http.StatusMethodNotAllowed:
+		message = "Method not allowed"
+	}
+	middleware.WriteError(w.ResponseWriter, w.r, status, message)
+}
+
+func (w *unmatchedWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	// Drop the plain text body
+	return len(b), nil
+}
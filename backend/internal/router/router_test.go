@@ -0,0 +1,110 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/middleware"
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+)
+
+// Middleware that appends its name to the X-Trace header
+func tracing(name string) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func newTestRouter() *Router {
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Trace", "handler:"+r.PathValue("id"))
+	}
+
+	r := New()
+	r.HandleFunc("GET /public", ok)
+
+	api := r.With(tracing("a"), tracing("b"))
+	api.HandleFunc("GET /api/items/{id}", ok)
+	api.With(tracing("c")).HandleFunc("DELETE /api/items/{id}", ok)
+
+	// Registered after the groups, so it must not pick up their middleware
+	r.HandleFunc("GET /late", ok)
+	return r
+}
+
+func TestRouterWith(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   []string
+	}{
+		{http.MethodGet, "/public", []string{"handler:"}},
+		{http.MethodGet, "/api/items/7", []string{"a", "b", "handler:7"}},
+		{http.MethodDelete, "/api/items/7", []string{"a", "b", "c", "handler:7"}},
+		{http.MethodGet, "/late", []string{"handler:"}},
+	}
+
+	r := newTestRouter()
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", rec.Code)
+			}
+			if got := rec.Header().Values("X-Trace"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("trace = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouterUnmatched(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		status    int
+		code      string
+		wantAllow bool
+	}{
+		{"unknown path", http.MethodGet, "/missing", http.StatusNotFound, middleware.CodeNotFound, false},
+		{"wrong method", http.MethodPost, "/api/items/7", http.StatusMethodNotAllowed, middleware.CodeMethodNotAllowed, true},
+	}
+
+	r := newTestRouter()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+			if got := rec.Header().Get("Allow") != ""; got != tt.wantAllow {
+				t.Errorf("Allow header present = %v, want %v", got, tt.wantAllow)
+			}
+			if rec.Header().Get("X-Trace") != "" {
+				t.Error("route middleware ran for an unmatched request")
+			}
+
+			var body models.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q is not JSON: %v", rec.Body.String(), err)
+			}
+			if body.Error.Code != tt.code {
+				t.Errorf("code = %q, want %q", body.Error.Code, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/config"
+	"github.com/jonkermoo/rag-textbook/backend/internal/database"
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+)
+
+// AnswerCache serves answers to near-duplicate questions about the same
+// textbook without calling the chat model again
+type AnswerCache struct {
+	db               *database.DB
+	embeddingService *EmbeddingService
+	similarity       float64 // Min cosine similarity between normalized questions
+}
+
+// A question looked up in the cache, kept to store its answer on a miss
+type answerCacheEntry struct {
+	key       database.AnswerCacheKey
+	question  string
+	embedding []float32
+}
+
+// Options that change the answer to a question besides the question itself
+type answerOptions struct {
+	TopK        int                  `json:"top_k"`
+	Filters     *models.QueryFilters `json:"filters"`
+	Rerank      bool                 `json:"rerank"`
+	Diversity   float64              `json:"diversity"`
+	Strategy    string               `json:"strategy"`
+	Threshold   float64              `json:"threshold"`
+	Temperature float32              `json:"temperature"`
+}
+
+// Create the answer cache, or nil when it is disabled
+func NewAnswerCache(db *database.DB, embeddingService *EmbeddingService, cfg config.AnswerCacheConfig) *AnswerCache {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	return &AnswerCache{
+		db:               db,
+		embeddingService: embeddingService,
+		similarity:       cfg.Similarity,
+	}
+}
+
+// Find a cached answer for the question. The returned entry is passed to
+// Store when there was no hit.
+func (c *AnswerCache) Lookup(ctx context.Context, key database.AnswerCacheKey, generation *models.EmbeddingGeneration, question string) (*models.QueryResponse, *answerCacheEntry, error) {
+	normalized := normalizeQuestion(question)
+	embedding, err := c.embeddingService.Embed(ctx, generation.Model, generation.Dimensions, normalized)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to embed question: %w", err)
+	}
+	entry := &answerCacheEntry{key: key, question: question, embedding: embedding}
+
+	cached, err := c.db.FindCachedAnswer(ctx, key, embedding)
+	if err != nil {
+		return nil, entry, err
+	}
+	if cached == nil || cached.Similarity < c.similarity {
+		return nil, entry, nil
+	}
+
+	var response models.QueryResponse
+	if err := json.Unmarshal(cached.Response, &response); err != nil {
+		return nil, entry, fmt.Errorf("failed to decode cached answer: %w", err)
+	}
+
+	if err := c.db.RecordCachedAnswerHit(ctx, cached.ID); err != nil {
+		log.Printf("Failed to record answer cache hit: %v", err)
+	}
+	log.Printf("Answer cache hit for textbook %d (similarity %.3f to %q)", key.TextbookID, cached.Similarity, cached.Question)
+
+	return &response, entry, nil
+}
+
+// Cache the answer generated for a looked up question
+func (c *AnswerCache) Store(ctx context.Context, entry *answerCacheEntry, response *models.QueryResponse) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("failed to encode answer: %w", err)
+	}
+
+	return c.db.SaveCachedAnswer(ctx, entry.key, entry.question, entry.embedding, data)
+}
+
+// Hex SHA-256 of the options, so answers are only shared between requests
+// that would retrieve and generate the same way
+func (o answerOptions) hash() string {
+	data, _ := json.Marshal(o)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Lowercase the question and reduce punctuation and spacing, so trivial
+// differences ("What is mitosis?" / "what is mitosis") embed identically
+func normalizeQuestion(question string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(question), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
@@ -1,47 +1,48 @@
 package services
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/jonkermoo/rag-textbook/backend/internal/apperr"
+	"github.com/jonkermoo/rag-textbook/backend/internal/config"
 	"github.com/jonkermoo/rag-textbook/backend/internal/database"
 	"github.com/jonkermoo/rag-textbook/backend/internal/models"
 )
 
 type AuthService struct {
-	db        *database.DB
-	jwtSecret []byte
+	db         *database.DB
+	jwtSecret  []byte
+	tokenTTL   time.Duration
+	autoVerify bool
 }
 
-func NewAuthService(db *database.DB) *AuthService {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		panic("JWT_SECRET environment variable not set")
-	}
-
+func NewAuthService(db *database.DB, cfg config.AuthConfig) *AuthService {
 	return &AuthService{
-		db:        db,
-		jwtSecret: []byte(secret),
+		db:         db,
+		jwtSecret:  []byte(cfg.JWTSecret),
+		tokenTTL:   time.Duration(cfg.JWTExpirationHours) * time.Hour,
+		autoVerify: cfg.AutoVerify,
 	}
 }
 
 // Create a new user account
-func (s *AuthService) Register(req models.RegisterRequest) (*models.User, error) {
+func (s *AuthService) Register(ctx context.Context, req models.RegisterRequest) (*models.User, error) {
 	// Validate email
 	if !isValidEmail(req.Email) {
-		return nil, errors.New("invalid email format")
+		return nil, apperr.New(ErrInvalidInput, "Invalid email format")
 	}
 
 	// Validate password strength
 	if len(req.Password) < 8 {
-		return nil, errors.New("password must be at least 8 characters")
+		return nil, apperr.New(ErrInvalidInput, "Password must be at least 8 characters")
 	}
 
 	// Hash password
@@ -57,38 +58,41 @@ func (s *AuthService) Register(req models.RegisterRequest) (*models.User, error)
 	}
 
 	// Create user in database
-	user, err := s.db.CreateUser(req.Email, string(hashedPassword), verificationToken)
+	user, err := s.db.CreateUser(ctx, req.Email, string(hashedPassword), verificationToken)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
+		return nil, err
 	}
 
 	// TODO: Send verification email (we'll skip for now)
 	// For development, auto-verify
-	if os.Getenv("AUTO_VERIFY") == "true" {
+	if s.autoVerify {
 		user.Verified = true
-		s.db.VerifyUser(verificationToken)
+		s.db.VerifyUser(ctx, verificationToken)
 	}
 
 	return user, nil
 }
 
 // Login authenticates a user and returns a JWT token
-func (s *AuthService) Login(req models.LoginRequest) (string, *models.User, error) {
+func (s *AuthService) Login(ctx context.Context, req models.LoginRequest) (string, *models.User, error) {
 	// Get user from database
-	user, err := s.db.GetUserByEmail(req.Email)
+	user, err := s.db.GetUserByEmail(ctx, req.Email)
+	if errors.Is(err, ErrNotFound) {
+		return "", nil, apperr.New(ErrUnauthorized, "Invalid email or password")
+	}
 	if err != nil {
-		return "", nil, errors.New("invalid email or password")
+		return "", nil, err
 	}
 
 	// Check if verified
 	if !user.Verified {
-		return "", nil, errors.New("email not verified")
+		return "", nil, apperr.New(ErrForbidden, "Email not verified")
 	}
 
 	// Verify password
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
 	if err != nil {
-		return "", nil, errors.New("invalid email or password")
+		return "", nil, apperr.New(ErrUnauthorized, "Invalid email or password")
 	}
 
 	// Generate JWT token
@@ -98,14 +102,14 @@ func (s *AuthService) Login(req models.LoginRequest) (string, *models.User, erro
 	}
 
 	// Update last login
-	s.db.UpdateLastLogin(user.ID)
+	s.db.UpdateLastLogin(ctx, user.ID)
 
 	return token, user, nil
 }
 
 // Mark a user's email as verified
-func (s *AuthService) VerifyEmail(token string) error {
-	return s.db.VerifyUser(token)
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	return s.db.VerifyUser(ctx, token)
 }
 
 // Validate a JWT token and returns the user ID
@@ -131,15 +135,10 @@ func (s *AuthService) ValidateToken(tokenString string) (int, error) {
 
 // Create a new JWT token
 func (s *AuthService) GenerateToken(userID int, email string) (string, error) {
-	expirationHours := 168 // 7 days
-	if envHours := os.Getenv("JWT_EXPIRATION_HOURS"); envHours != "" {
-		fmt.Sscanf(envHours, "%d", &expirationHours)
-	}
-
 	claims := jwt.MapClaims{
 		"user_id": userID,
 		"email":   email,
-		"exp":     time.Now().Add(time.Hour * time.Duration(expirationHours)).Unix(),
+		"exp":     time.Now().Add(s.tokenTTL).Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
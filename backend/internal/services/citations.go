@@ -0,0 +1,143 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+)
+
+// Citation markers the model is asked to write, e.g. "[chunk:123]"
+var citationPattern = regexp.MustCompile(`\[\s*chunk\s*:\s*(\d+)\s*\]`)
+
+// Header that labels an excerpt in the prompt so the model can cite it
+func citationHeader(chunk models.Chunk) string {
+	return fmt.Sprintf("[chunk:%d] %s", chunk.ID, chunkLabel(chunk))
+}
+
+// Validate the chunk citations in an answer against the chunks that were in
+// the prompt. Valid markers are replaced with the 1-based number of the
+// matching source ("[2]"); markers for chunks that weren't in the prompt are
+// stripped and their IDs returned as invalid. Each citation's span is the
+// sentence it follows. Offsets are in runes of the returned answer.
+func resolveCitations(answer string, chunks []models.Chunk) (string, []models.Citation, []int) {
+	sourceIndex := make(map[int]int, len(chunks))
+	for i, chunk := range chunks {
+		sourceIndex[chunk.ID] = i
+	}
+
+	var out []rune
+	citations := []models.Citation{}
+	invalid := []int{}
+	seenInvalid := make(map[int]bool)
+
+	last := 0
+	for _, match := range citationPattern.FindAllStringSubmatchIndex(answer, -1) {
+		out = append(out, []rune(answer[last:match[0]])...)
+		last = match[1]
+
+		id, _ := strconv.Atoi(answer[match[2]:match[3]])
+		i, ok := sourceIndex[id]
+		if !ok {
+			if !seenInvalid[id] {
+				seenInvalid[id] = true
+				invalid = append(invalid, id)
+			}
+			// Don't leave a dangling space before punctuation
+			if len(out) > 0 && out[len(out)-1] == ' ' && (last == len(answer) || strings.ContainsRune(" .,;:!?)\n", rune(answer[last]))) {
+				out = out[:len(out)-1]
+			}
+			continue
+		}
+
+		marker := []rune(fmt.Sprintf("[%d]", i+1))
+		chunk := chunks[i]
+		citations = append(citations, models.Citation{
+			ChunkID:     chunk.ID,
+			TextbookID:  chunk.TextbookID,
+			SourceIndex: i,
+			PageNumber:  chunk.PageNumber,
+			PageEnd:     chunk.PageEnd,
+			MarkerStart: len(out),
+			MarkerEnd:   len(out) + len(marker),
+		})
+		out = append(out, marker...)
+	}
+	out = append(out, []rune(answer[last:])...)
+
+	for i := range citations {
+		citations[i].Start, citations[i].End = citedSpan(out, citations, citations[i].MarkerStart)
+	}
+
+	return string(out), citations, invalid
+}
+
+// Find the sentence a marker at markerStart refers to: the text before it,
+// back to the previous sentence end or line break, ignoring other markers
+func citedSpan(text []rune, citations []models.Citation, markerStart int) (int, int) {
+	// Markers directly after a sentence's full stop still cite that sentence
+	end := markerStart
+	for end > 0 {
+		if unicode.IsSpace(text[end-1]) {
+			end--
+		} else if m := markerEndingAt(citations, end); m >= 0 {
+			end = m
+		} else {
+			break
+		}
+	}
+	scan := end
+	if scan > 0 && isSentenceEnd(text[scan-1]) {
+		scan--
+	}
+
+	start := 0
+	for i := scan - 1; i >= 0; i-- {
+		if m := markerEndingAt(citations, i+1); m >= 0 {
+			i = m
+			continue
+		}
+		if text[i] == '\n' || (isSentenceEnd(text[i]) && i+1 < len(text) && unicode.IsSpace(text[i+1])) {
+			start = i + 1
+			break
+		}
+	}
+
+	// Skip leading whitespace and markers of the previous sentence
+	for start < end {
+		if unicode.IsSpace(text[start]) {
+			start++
+		} else if m := markerStartingAt(citations, start); m >= 0 {
+			start = m
+		} else {
+			break
+		}
+	}
+
+	return start, end
+}
+
+func markerEndingAt(citations []models.Citation, pos int) int {
+	for _, c := range citations {
+		if c.MarkerEnd == pos {
+			return c.MarkerStart
+		}
+	}
+	return -1
+}
+
+func markerStartingAt(citations []models.Citation, pos int) int {
+	for _, c := range citations {
+		if c.MarkerStart == pos {
+			return c.MarkerEnd
+		}
+	}
+	return -1
+}
+
+func isSentenceEnd(r rune) bool {
+	return r == '.' || r == '!' || r == '?'
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+)
+
+func TestResolveCitations(t *testing.T) {
+	chunks := []models.Chunk{
+		{ID: 7, TextbookID: 1, PageNumber: 3, PageEnd: 3},
+		{ID: 9, TextbookID: 2, PageNumber: 10, PageEnd: 11},
+	}
+
+	tests := []struct {
+		name      string
+		answer    string
+		answerOut string
+		citations []models.Citation
+		invalid   []int
+	}{
+		{
+			name:      "no markers",
+			answer:    "Cells divide.",
+			answerOut: "Cells divide.",
+			citations: []models.Citation{},
+			invalid:   []int{},
+		},
+		{
+			name:      "marker before full stop",
+			answer:    "Mitosis splits cells [chunk:7].",
+			answerOut: "Mitosis splits cells [1].",
+			citations: []models.Citation{
+				{ChunkID: 7, TextbookID: 1, SourceIndex: 0, PageNumber: 3, PageEnd: 3, Start: 0, End: 20, MarkerStart: 21, MarkerEnd: 24},
+			},
+			invalid: []int{},
+		},
+		{
+			name:      "marker after full stop cites that sentence",
+			answer:    "Cells divide. [chunk:9]",
+			answerOut: "Cells divide. [2]",
+			citations: []models.Citation{
+				{ChunkID: 9, TextbookID: 2, SourceIndex: 1, PageNumber: 10, PageEnd: 11, Start: 0, End: 13, MarkerStart: 14, MarkerEnd: 17},
+			},
+			invalid: []int{},
+		},
+		{
+			name:      "span starts after the previous sentence",
+			answer:    "First fact. Second fact [chunk:9]",
+			answerOut: "First fact. Second fact [2]",
+			citations: []models.Citation{
+				{ChunkID: 9, TextbookID: 2, SourceIndex: 1, PageNumber: 10, PageEnd: 11, Start: 12, End: 23, MarkerStart: 24, MarkerEnd: 27},
+			},
+			invalid: []int{},
+		},
+		{
+			name:      "adjacent markers cite the same sentence",
+			answer:    "Fact [chunk:7][ chunk : 9 ].",
+			answerOut: "Fact [1][2].",
+			citations: []models.Citation{
+				{ChunkID: 7, TextbookID: 1, SourceIndex: 0, PageNumber: 3, PageEnd: 3, Start: 0, End: 4, MarkerStart: 5, MarkerEnd: 8},
+				{ChunkID: 9, TextbookID: 2, SourceIndex: 1, PageNumber: 10, PageEnd: 11, Start: 0, End: 4, MarkerStart: 8, MarkerEnd: 11},
+			},
+			invalid: []int{},
+		},
+		{
+			name:      "unknown chunks are stripped and reported once",
+			answer:    "A [chunk:5]. B [chunk:5]. C [chunk:6]",
+			answerOut: "A. B. C",
+			citations: []models.Citation{},
+			invalid:   []int{5, 6},
+		},
+		{
+			name:      "offsets are in runes",
+			answer:    "Café é bom [chunk:7].",
+			answerOut: "Café é bom [1].",
+			citations: []models.Citation{
+				{ChunkID: 7, TextbookID: 1, SourceIndex: 0, PageNumber: 3, PageEnd: 3, Start: 0, End: 10, MarkerStart: 11, MarkerEnd: 14},
+			},
+			invalid: []int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answer, citations, invalid := resolveCitations(tt.answer, chunks)
+			if answer != tt.answerOut {
+				t.Errorf("answer = %q, want %q", answer, tt.answerOut)
+			}
+			if !reflect.DeepEqual(citations, tt.citations) {
+				t.Errorf("citations = %+v, want %+v", citations, tt.citations)
+			}
+			if !reflect.DeepEqual(invalid, tt.invalid) {
+				t.Errorf("invalid = %v, want %v", invalid, tt.invalid)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/config"
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+)
+
+const (
+	// Don't bother including a truncated chunk with less room than this
+	minPartialChunkTokens = config.MinContextTokens
+	contextSeparator      = "---\n\n"
+)
+
+// ContextBuilder packs retrieved chunks into the prompt within a token budget
+type ContextBuilder struct {
+	tokenizer *Tokenizer
+	budget    int
+}
+
+// PackedContext is the prompt context plus what went into it
+type PackedContext struct {
+	Text    string
+	Chunks  []models.Chunk // Chunks included, in rank order (adjacent chunks merged)
+	Tokens  int
+	Budget  int
+	Dropped int // Chunks left out (or cut short) because of the budget
+}
+
+// Create a context builder for a chat model that packs up to budget tokens
+// (see config.ChatConfig.ContextBudget)
+func NewContextBuilder(model string, budget int) *ContextBuilder {
+	return &ContextBuilder{
+		tokenizer: NewTokenizer(model),
+		budget:    budget,
+	}
+}
+
+// Pack chunks (best first) into the budget. Adjacent chunks from the same
+// page are merged, and the lowest-ranked content is trimmed first.
+func (b *ContextBuilder) Build(chunks []models.Chunk) PackedContext {
+	merged := mergeAdjacentChunks(chunks)
+
+	packed := PackedContext{Budget: b.budget}
+	var builder strings.Builder
+
+	for i, chunk := range merged {
+		header := citationHeader(chunk) + "\n"
+		separator := ""
+		if len(packed.Chunks) > 0 {
+			separator = contextSeparator
+		}
+
+		overhead := b.tokenizer.Count(separator + header + "\n\n")
+		contentTokens := b.tokenizer.Count(chunk.Content)
+		remaining := b.budget - packed.Tokens - overhead
+
+		// Cut the chunk short if there's meaningful room left, otherwise stop
+		truncated := false
+		if contentTokens > remaining {
+			if remaining < minPartialChunkTokens {
+				packed.Dropped += len(merged) - i
+				break
+			}
+			chunk.Content = b.tokenizer.Truncate(chunk.Content, remaining-1) + "..."
+			contentTokens = b.tokenizer.Count(chunk.Content)
+			truncated = true
+		}
+
+		builder.WriteString(separator)
+		builder.WriteString(header)
+		builder.WriteString(chunk.Content)
+		builder.WriteString("\n\n")
+
+		packed.Tokens += overhead + contentTokens
+		packed.Chunks = append(packed.Chunks, chunk)
+
+		if truncated {
+			packed.Dropped += len(merged) - i
+			break
+		}
+	}
+
+	packed.Text = builder.String()
+	return packed
+}
+
+// Merge chunks that are consecutive in the document and on the same page,
+// keeping the position of the best-ranked member. Overlapping text between
+// consecutive chunks is only included once.
+func mergeAdjacentChunks(chunks []models.Chunk) []models.Chunk {
+	var groups [][]models.Chunk
+
+	for _, chunk := range chunks {
+		placed := false
+		for g, group := range groups {
+			if adjacentToGroup(group, chunk) {
+				groups[g] = append(group, chunk)
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			groups = append(groups, []models.Chunk{chunk})
+		}
+	}
+
+	merged := make([]models.Chunk, 0, len(groups))
+	for _, group := range groups {
+		merged = append(merged, mergeGroup(group))
+	}
+	return merged
+}
+
+func adjacentToGroup(group []models.Chunk, chunk models.Chunk) bool {
+	for _, member := range group {
+		if member.TextbookID != chunk.TextbookID {
+			continue
+		}
+		consecutive := member.ChunkIndex == chunk.ChunkIndex+1 || member.ChunkIndex == chunk.ChunkIndex-1
+		samePage := member.PageEnd == chunk.PageNumber || member.PageNumber == chunk.PageEnd
+		if consecutive && samePage {
+			return true
+		}
+	}
+	return false
+}
+
+func mergeGroup(group []models.Chunk) models.Chunk {
+	if len(group) == 1 {
+		return group[0]
+	}
+
+	// The best-ranked member (first in the group) keeps its scores and distance
+	merged := group[0]
+
+	ordered := append([]models.Chunk(nil), group...)
+	sort.Slice(ordered, func(a, b int) bool {
+		return ordered[a].ChunkIndex < ordered[b].ChunkIndex
+	})
+
+	content := ordered[0].Content
+	for _, chunk := range ordered[1:] {
+		content = joinWithoutOverlap(content, chunk.Content)
+	}
+
+	merged.Content = content
+	merged.ChunkIndex = ordered[0].ChunkIndex
+	merged.PageNumber = ordered[0].PageNumber
+	merged.PageEnd = ordered[len(ordered)-1].PageEnd
+	if ordered[0].Location != ordered[len(ordered)-1].Location {
+		merged.Location = ""
+	}
+
+	return merged
+}
+
+// Append b to a, skipping the longest word overlap between a's tail and b's head
+func joinWithoutOverlap(a, b string) string {
+	aWords := strings.Fields(a)
+	bWords := strings.Fields(b)
+
+	maxOverlap := min(len(aWords), len(bWords), 200)
+	for n := maxOverlap; n > 0; n-- {
+		if strings.Join(aWords[len(aWords)-n:], " ") == strings.Join(bWords[:n], " ") {
+			return a + " " + strings.Join(bWords[n:], " ")
+		}
+	}
+
+	return a + "\n\n" + b
+}
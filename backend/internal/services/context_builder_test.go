@@ -0,0 +1,154 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+)
+
+func TestContextBuilderBuild(t *testing.T) {
+	tokenizer := NewTokenizer("gpt-4")
+	// About n tokens of text
+	text := func(n int) string {
+		return strings.TrimSpace(strings.Repeat(" word", n))
+	}
+	chunk := func(id, page int, content string) models.Chunk {
+		return models.Chunk{ID: id, TextbookID: 1, PageNumber: page, PageEnd: page, ChunkIndex: id * 10, Content: content}
+	}
+
+	tests := []struct {
+		name      string
+		budget    int
+		chunks    []models.Chunk
+		ids       []int
+		dropped   int
+		truncated bool // Last included chunk was cut short
+	}{
+		{
+			name:   "everything fits",
+			budget: 1000,
+			chunks: []models.Chunk{chunk(1, 1, text(50)), chunk(2, 5, text(50)), chunk(3, 9, text(50))},
+			ids:    []int{1, 2, 3},
+		},
+		{
+			name:    "too little room left for another chunk",
+			budget:  350,
+			chunks:  []models.Chunk{chunk(1, 1, text(300)), chunk(2, 5, text(300)), chunk(3, 9, text(300))},
+			ids:     []int{1},
+			dropped: 2,
+		},
+		{
+			name:      "last chunk cut short",
+			budget:    500,
+			chunks:    []models.Chunk{chunk(1, 1, text(300)), chunk(2, 5, text(300)), chunk(3, 9, text(300))},
+			ids:       []int{1, 2},
+			dropped:   2,
+			truncated: true,
+		},
+		{
+			name:    "first chunk alone is too big",
+			budget:  50,
+			chunks:  []models.Chunk{chunk(1, 1, text(300))},
+			dropped: 1,
+		},
+		{
+			name:   "no chunks",
+			budget: 100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &ContextBuilder{tokenizer: tokenizer, budget: tt.budget}
+			packed := b.Build(tt.chunks)
+
+			var ids []int
+			for _, c := range packed.Chunks {
+				ids = append(ids, c.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.ids) {
+				t.Errorf("ids = %v, want %v", ids, tt.ids)
+			}
+			if packed.Dropped != tt.dropped {
+				t.Errorf("dropped = %d, want %d", packed.Dropped, tt.dropped)
+			}
+			if packed.Budget != tt.budget {
+				t.Errorf("budget = %d, want %d", packed.Budget, tt.budget)
+			}
+			if packed.Tokens > tt.budget {
+				t.Errorf("tokens = %d, over the budget of %d", packed.Tokens, tt.budget)
+			}
+			if len(packed.Chunks) > 0 {
+				last := packed.Chunks[len(packed.Chunks)-1]
+				if got := strings.HasSuffix(last.Content, "..."); got != tt.truncated {
+					t.Errorf("last chunk truncated = %v, want %v", got, tt.truncated)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeAdjacentChunks(t *testing.T) {
+	tests := []struct {
+		name     string
+		chunks   []models.Chunk
+		ids      []int // ID of each merged chunk (its best-ranked member)
+		contents []string
+	}{
+		{
+			name: "consecutive chunks on the same page merge in document order",
+			chunks: []models.Chunk{
+				{ID: 2, TextbookID: 1, ChunkIndex: 5, PageNumber: 3, PageEnd: 3, Content: "gamma delta epsilon"},
+				{ID: 1, TextbookID: 1, ChunkIndex: 4, PageNumber: 3, PageEnd: 3, Content: "alpha beta gamma delta"},
+			},
+			ids:      []int{2},
+			contents: []string{"alpha beta gamma delta epsilon"},
+		},
+		{
+			name: "no overlap keeps both texts",
+			chunks: []models.Chunk{
+				{ID: 1, TextbookID: 1, ChunkIndex: 4, PageNumber: 3, PageEnd: 3, Content: "first part"},
+				{ID: 2, TextbookID: 1, ChunkIndex: 5, PageNumber: 3, PageEnd: 4, Content: "second part"},
+			},
+			ids:      []int{1},
+			contents: []string{"first part\n\nsecond part"},
+		},
+		{
+			name: "chunks far apart stay separate",
+			chunks: []models.Chunk{
+				{ID: 1, TextbookID: 1, ChunkIndex: 4, PageNumber: 3, PageEnd: 3, Content: "a"},
+				{ID: 2, TextbookID: 1, ChunkIndex: 9, PageNumber: 3, PageEnd: 3, Content: "b"},
+			},
+			ids:      []int{1, 2},
+			contents: []string{"a", "b"},
+		},
+		{
+			name: "other textbooks stay separate",
+			chunks: []models.Chunk{
+				{ID: 1, TextbookID: 1, ChunkIndex: 4, PageNumber: 3, PageEnd: 3, Content: "a"},
+				{ID: 2, TextbookID: 2, ChunkIndex: 5, PageNumber: 3, PageEnd: 3, Content: "b"},
+			},
+			ids:      []int{1, 2},
+			contents: []string{"a", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []int
+			var contents []string
+			for _, c := range mergeAdjacentChunks(tt.chunks) {
+				ids = append(ids, c.ID)
+				contents = append(contents, c.Content)
+			}
+			if !reflect.DeepEqual(ids, tt.ids) {
+				t.Errorf("ids = %v, want %v", ids, tt.ids)
+			}
+			if !reflect.DeepEqual(contents, tt.contents) {
+				t.Errorf("contents = %q, want %q", contents, tt.contents)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEmbeddingLRU(t *testing.T) {
+	type op struct {
+		add  string  // Key to add, or empty to look up
+		get  string  // Key to look up
+		want float32 // Expected first element, 0 for a miss
+	}
+
+	tests := []struct {
+		name     string
+		capacity int
+		ops      []op
+	}{
+		{
+			name:     "hit and miss",
+			capacity: 2,
+			ops: []op{
+				{add: "a"},
+				{get: "a", want: 1},
+				{get: "b"},
+			},
+		},
+		{
+			name:     "evicts the least recently added",
+			capacity: 2,
+			ops: []op{
+				{add: "a"}, {add: "b"}, {add: "c"},
+				{get: "a"},
+				{get: "b", want: 2},
+				{get: "c", want: 3},
+			},
+		},
+		{
+			name:     "a lookup refreshes an entry",
+			capacity: 2,
+			ops: []op{
+				{add: "a"}, {add: "b"},
+				{get: "a", want: 1},
+				{add: "c"},
+				{get: "b"},
+				{get: "a", want: 1},
+			},
+		},
+		{
+			name:     "re-adding replaces the value without growing",
+			capacity: 2,
+			ops: []op{
+				{add: "a"}, {add: "b"}, {add: "a"},
+				{add: "c"},
+				{get: "a", want: 3},
+				{get: "b"},
+			},
+		},
+		{
+			name:     "zero capacity disables the cache",
+			capacity: 0,
+			ops: []op{
+				{add: "a"},
+				{get: "a"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newEmbeddingLRU(tt.capacity)
+			var added float32
+			for _, o := range tt.ops {
+				if o.add != "" {
+					added++
+					cache.add(o.add, []float32{added})
+					continue
+				}
+
+				got, ok := cache.get(o.get)
+				if o.want == 0 {
+					if ok {
+						t.Errorf("get(%q) = %v, want a miss", o.get, got)
+					}
+					continue
+				}
+				if !ok || !reflect.DeepEqual(got, []float32{o.want}) {
+					t.Errorf("get(%q) = %v, %v, want [%v]", o.get, got, ok, o.want)
+				}
+			}
+			if cache.order.Len() > max(tt.capacity, 0) || cache.order.Len() != len(cache.entries) {
+				t.Errorf("cache holds %d entries (%d indexed), capacity %d", cache.order.Len(), len(cache.entries), tt.capacity)
+			}
+		})
+	}
+}
+
+func TestTextHash(t *testing.T) {
+	if textHash("cell") != textHash("cell") {
+		t.Error("textHash is not deterministic")
+	}
+	if textHash("cell") == textHash("cells") {
+		t.Error("different texts share a hash")
+	}
+	if got := len(textHash("")); got != 64 {
+		t.Errorf("hash length = %d, want 64", got)
+	}
+}
@@ -2,41 +2,347 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/sashabaranov/go-openai"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/config"
+	"github.com/jonkermoo/rag-textbook/backend/internal/database"
+)
+
+// OpenAI limits per embeddings request and per input
+const (
+	maxEmbeddingBatchInputs = 2048
+	maxEmbeddingBatchTokens = 300000
+	maxEmbeddingInputTokens = 8191
 )
 
 type EmbeddingService struct {
 	client *openai.Client
+	db     *database.DB // Persistent cache; nil disables it
+	cache  *embeddingLRU
+
+	// Model new embedding generations are built with
+	model      string
+	dimensions int
+
+	batchSize  int           // Max inputs per request
+	maxRetries int           // Retries on rate limits and server errors
+	slots      chan struct{} // Limits concurrent requests to the provider
+
+	tokenizersMu sync.Mutex
+	tokenizers   map[string]*Tokenizer
 }
 
-// Create a new embedding service
-func NewEmbeddingService() *EmbeddingService {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	client := openai.NewClient(apiKey)
+// Create a new embedding service. cfg.BaseURL points it at any
+// OpenAI-compatible server, e.g. a locally hosted embedding model. Embeddings
+// are cached in memory and, when db is set, in Postgres.
+func NewEmbeddingService(db *database.DB, cfg config.EmbeddingConfig) *EmbeddingService {
+	clientConfig := openai.DefaultConfig(cfg.APIKey)
+	if cfg.BaseURL != "" {
+		clientConfig.BaseURL = cfg.BaseURL
+	}
 
 	return &EmbeddingService{
-		client: client,
+		client:     openai.NewClientWithConfig(clientConfig),
+		db:         db,
+		cache:      newEmbeddingLRU(cfg.CacheSize),
+		model:      cfg.Model,
+		dimensions: cfg.Dimensions,
+		batchSize:  min(cfg.BatchSize, maxEmbeddingBatchInputs),
+		maxRetries: cfg.MaxRetries,
+		slots:      make(chan struct{}, max(cfg.Concurrency, 1)),
+		tokenizers: make(map[string]*Tokenizer),
 	}
 }
 
-// Converts text to a vector embedding
-func (s *EmbeddingService) GenerateEmbedding(text string) ([]float32, error) {
-	req := openai.EmbeddingRequest{
-		Input: []string{text},
-		Model: openai.SmallEmbedding3,
+// Model and dimension used for new embedding generations
+func (s *EmbeddingService) DefaultModel() (string, int) {
+	return s.model, s.dimensions
+}
+
+// Converts text to a vector embedding with the default model
+func (s *EmbeddingService) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return s.Embed(ctx, s.model, s.dimensions, text)
+}
+
+// Converts texts to vector embeddings with the default model
+func (s *EmbeddingService) GenerateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	return s.EmbedBatch(ctx, s.model, s.dimensions, texts)
+}
+
+// Converts text to a vector embedding with a specific model, so queries are
+// embedded the same way as the textbook they search
+func (s *EmbeddingService) Embed(ctx context.Context, model string, dimensions int, text string) ([]float32, error) {
+	embeddings, err := s.EmbedBatch(ctx, model, dimensions, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+// Converts texts to vector embeddings with a specific model, in input order.
+// Cached texts are served from memory or Postgres; the rest are sent in
+// batches that respect the provider's input and token limits.
+func (s *EmbeddingService) EmbedBatch(ctx context.Context, model string, dimensions int, texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	if len(texts) == 0 {
+		return embeddings, nil
+	}
+
+	// Positions of each distinct text that isn't in memory
+	missing := make(map[string][]int)
+	var hashes []string
+	for i, text := range texts {
+		hash := textHash(text)
+		if embedding, ok := s.cache.get(cacheKey(model, dimensions, hash)); ok {
+			embeddings[i] = embedding
+			continue
+		}
+		if _, ok := missing[hash]; !ok {
+			hashes = append(hashes, hash)
+		}
+		missing[hash] = append(missing[hash], i)
+	}
+	if len(hashes) == 0 {
+		return embeddings, nil
+	}
+
+	fill := func(hash string, embedding []float32) {
+		for _, i := range missing[hash] {
+			embeddings[i] = embedding
+		}
+		delete(missing, hash)
+		s.cache.add(cacheKey(model, dimensions, hash), embedding)
+	}
+
+	// A broken cache shouldn't break embedding, so errors only cost a lookup
+	if s.db != nil {
+		cached, err := s.db.GetCachedEmbeddings(ctx, model, dimensions, hashes)
+		if err != nil {
+			log.Printf("Embedding cache lookup failed: %v", err)
+		}
+		for hash, embedding := range cached {
+			fill(hash, embedding)
+		}
+	}
+	if len(missing) == 0 {
+		return embeddings, nil
 	}
 
-	resp, err := s.client.CreateEmbeddings(context.Background(), req)
+	uncached := make([]string, 0, len(missing))
+	uncachedHashes := make([]string, 0, len(missing))
+	for _, hash := range hashes {
+		if positions, ok := missing[hash]; ok {
+			uncached = append(uncached, texts[positions[0]])
+			uncachedHashes = append(uncachedHashes, hash)
+		}
+	}
+
+	created, err := s.createEmbeddings(ctx, model, dimensions, uncached)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create embedding: %w", err)
+		return nil, err
+	}
+	for i, hash := range uncachedHashes {
+		fill(hash, created[i])
+	}
+
+	// The embeddings were paid for, so cache them even if the caller has gone
+	if s.db != nil {
+		if err := s.db.SaveCachedEmbeddings(context.WithoutCancel(ctx), model, dimensions, uncachedHashes, created); err != nil {
+			log.Printf("Embedding cache write failed: %v", err)
+		}
+	}
+
+	return embeddings, nil
+}
+
+// Converts chunk texts to vector embeddings with a specific model, bypassing
+// both caches. Each chunk is embedded once per generation, so caching it
+// would only evict query embeddings and grow the embedding_cache table.
+func (s *EmbeddingService) EmbedDocuments(ctx context.Context, model string, dimensions int, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return [][]float32{}, nil
+	}
+	// createEmbeddings truncates over-long inputs in place
+	return s.createEmbeddings(ctx, model, dimensions, append([]string(nil), texts...))
+}
+
+// Embed texts with the provider, splitting them into batches that run
+// concurrently (bounded by EMBEDDING_CONCURRENCY across all callers)
+func (s *EmbeddingService) createEmbeddings(ctx context.Context, model string, dimensions int, texts []string) ([][]float32, error) {
+	tokenizer := s.tokenizer(model)
+
+	// Inputs over the per-input limit are truncated rather than rejected
+	counts := make([]int, len(texts))
+	for i := range texts {
+		counts[i] = tokenizer.Count(texts[i])
+		if counts[i] > maxEmbeddingInputTokens {
+			texts[i] = tokenizer.Truncate(texts[i], maxEmbeddingInputTokens)
+			counts[i] = maxEmbeddingInputTokens
+		}
+	}
+	batches := embeddingBatches(counts, s.batchSize)
+
+	// The first failed batch cancels the rest
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	embeddings := make([][]float32, len(texts))
+	errs := make([]error, len(batches))
+	var wg sync.WaitGroup
+	for i, b := range batches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := s.createBatch(ctx, model, dimensions, texts[b.start:b.end])
+			if err != nil {
+				errs[i] = err
+				cancel()
+				return
+			}
+			copy(embeddings[b.start:b.end], result)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		// Report the failure, not the cancellations it caused
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return embeddings, nil
+}
+
+type embeddingBatch struct{ start, end int }
+
+// Split inputs with the given token counts into consecutive batches of at
+// most batchSize inputs and maxEmbeddingBatchTokens tokens
+func embeddingBatches(counts []int, batchSize int) []embeddingBatch {
+	var batches []embeddingBatch
+	start, tokens := 0, 0
+	for i, count := range counts {
+		if i > start && (i-start >= batchSize || tokens+count > maxEmbeddingBatchTokens) {
+			batches = append(batches, embeddingBatch{start, i})
+			start, tokens = i, 0
+		}
+		tokens += count
+	}
+	return append(batches, embeddingBatch{start, len(counts)})
+}
+
+// One embeddings request, retried with exponential backoff on rate limits,
+// server errors and network failures
+func (s *EmbeddingService) createBatch(ctx context.Context, model string, dimensions int, texts []string) ([][]float32, error) {
+	req := openai.EmbeddingRequest{
+		Input: texts,
+		Model: openai.EmbeddingModel(model),
+	}
+	// Only the text-embedding-3 models can shorten their output
+	if strings.HasPrefix(model, "text-embedding-3") {
+		req.Dimensions = dimensions
+	}
+
+	for attempt := 0; ; attempt++ {
+		select {
+		case s.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		resp, err := s.client.CreateEmbeddings(ctx, req)
+		<-s.slots
+
+		if err == nil {
+			return embeddingsFromResponse(resp, model, dimensions, len(texts))
+		}
+		if attempt >= s.maxRetries || !retryableEmbeddingError(ctx, err) {
+			return nil, fmt.Errorf("failed to create embedding: %w", upstreamError("embedding", err))
+		}
+
+		delay := embeddingBackoff(attempt)
+		log.Printf("Embedding request failed (attempt %d), retrying in %s: %v", attempt+1, delay.Round(time.Millisecond), err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Order the returned vectors by input index and check their size
+func embeddingsFromResponse(resp openai.EmbeddingResponse, model string, dimensions, count int) ([][]float32, error) {
+	if len(resp.Data) != count {
+		return nil, fmt.Errorf("got %d embeddings for %d inputs", len(resp.Data), count)
 	}
 
-	if len(resp.Data) == 0 {
-		return nil, fmt.Errorf("no embedding returned")
+	embeddings := make([][]float32, count)
+	for _, item := range resp.Data {
+		if item.Index < 0 || item.Index >= count || embeddings[item.Index] != nil {
+			return nil, fmt.Errorf("invalid embedding index %d", item.Index)
+		}
+		if dimensions > 0 && len(item.Embedding) != dimensions {
+			return nil, fmt.Errorf("model %s returned %d dimensions, expected %d", model, len(item.Embedding), dimensions)
+		}
+		embeddings[item.Index] = item.Embedding
 	}
 
-	return resp.Data[0].Embedding, nil
+	return embeddings, nil
+}
+
+// Rate limits (429), server errors (5xx) and network errors are worth retrying
+func retryableEmbeddingError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == http.StatusTooManyRequests || apiErr.HTTPStatusCode >= 500
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode == http.StatusTooManyRequests || reqErr.HTTPStatusCode >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// 0.5s, 1s, 2s, ... up to 8s, with up to 50% jitter so concurrent callers
+// don't retry in lockstep
+func embeddingBackoff(attempt int) time.Duration {
+	delay := min(500*time.Millisecond<<attempt, 8*time.Second)
+	return delay + rand.N(delay/2)
+}
+
+// Tokenizer for a model, shared between calls
+func (s *EmbeddingService) tokenizer(model string) *Tokenizer {
+	s.tokenizersMu.Lock()
+	defer s.tokenizersMu.Unlock()
+
+	tokenizer, ok := s.tokenizers[model]
+	if !ok {
+		tokenizer = NewTokenizer(model)
+		s.tokenizers[model] = tokenizer
+	}
+	return tokenizer
+}
+
+func cacheKey(model string, dimensions int, hash string) string {
+	return model + "/" + strconv.Itoa(dimensions) + "/" + hash
 }
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestEmbeddingBatches(t *testing.T) {
+	tests := []struct {
+		name      string
+		counts    []int
+		batchSize int
+		want      []embeddingBatch
+	}{
+		{
+			name:      "single batch",
+			counts:    []int{10, 20, 30},
+			batchSize: 10,
+			want:      []embeddingBatch{{0, 3}},
+		},
+		{
+			name:      "split by input count",
+			counts:    []int{1, 1, 1, 1, 1},
+			batchSize: 2,
+			want:      []embeddingBatch{{0, 2}, {2, 4}, {4, 5}},
+		},
+		{
+			name:      "split by tokens",
+			counts:    []int{maxEmbeddingBatchTokens / 2, maxEmbeddingBatchTokens / 2, 1, maxEmbeddingBatchTokens},
+			batchSize: 100,
+			want:      []embeddingBatch{{0, 2}, {2, 3}, {3, 4}},
+		},
+		{
+			name:      "exactly at the token limit",
+			counts:    []int{maxEmbeddingBatchTokens - 1, 1},
+			batchSize: 100,
+			want:      []embeddingBatch{{0, 2}},
+		},
+		{
+			name:      "oversized input gets its own batch",
+			counts:    []int{1, maxEmbeddingBatchTokens + 1, 1},
+			batchSize: 100,
+			want:      []embeddingBatch{{0, 1}, {1, 2}, {2, 3}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := embeddingBatches(tt.counts, tt.batchSize); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("embeddingBatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Fake embeddings endpoint: each input is embedded as [len(input)] and every
+// request's inputs are recorded
+func newEmbeddingServer(t *testing.T, status int) (*httptest.Server, func() [][]string) {
+	var mu sync.Mutex
+	var requests [][]string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		mu.Lock()
+		requests = append(requests, req.Input)
+		mu.Unlock()
+
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error": {"message": "bad request"}}`))
+			return
+		}
+
+		resp := openai.EmbeddingResponse{}
+		// Reverse order, callers must sort by index
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			resp.Data = append(resp.Data, openai.Embedding{Index: i, Embedding: []float32{float32(len(req.Input[i]))}})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() [][]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func newTestEmbeddingService(url string, batchSize int) *EmbeddingService {
+	config := openai.DefaultConfig("key")
+	config.BaseURL = url
+	return &EmbeddingService{
+		client:     openai.NewClientWithConfig(config),
+		cache:      newEmbeddingLRU(100),
+		model:      "test-model",
+		batchSize:  batchSize,
+		slots:      make(chan struct{}, 2),
+		tokenizers: make(map[string]*Tokenizer),
+	}
+}
+
+func TestEmbedBatch(t *testing.T) {
+	server, requests := newEmbeddingServer(t, http.StatusOK)
+	s := newTestEmbeddingService(server.URL, 2)
+
+	got, err := s.EmbedBatch(context.Background(), "test-model", 0, []string{"a", "bb", "a", "ccc", "dddd"})
+	if err != nil {
+		t.Fatalf("EmbedBatch() error = %v", err)
+	}
+	want := [][]float32{{1}, {2}, {1}, {3}, {4}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EmbedBatch() = %v, want %v", got, want)
+	}
+
+	// Duplicates are sent once, in batches of two
+	sent := 0
+	for _, req := range requests() {
+		if len(req) > 2 {
+			t.Errorf("request has %d inputs, batch size is 2", len(req))
+		}
+		sent += len(req)
+	}
+	if sent != 4 {
+		t.Errorf("sent %d inputs, want 4", sent)
+	}
+
+	// Repeats come from memory
+	before := len(requests())
+	got, err = s.EmbedBatch(context.Background(), "test-model", 0, []string{"ccc", "a"})
+	if err != nil {
+		t.Fatalf("EmbedBatch() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, [][]float32{{3}, {1}}) {
+		t.Errorf("cached EmbedBatch() = %v", got)
+	}
+	if len(requests()) != before {
+		t.Errorf("cached texts were sent to the provider")
+	}
+
+	// A different model doesn't share cache entries
+	if _, err := s.EmbedBatch(context.Background(), "other-model", 0, []string{"a"}); err != nil {
+		t.Fatalf("EmbedBatch() error = %v", err)
+	}
+	if len(requests()) != before+1 {
+		t.Errorf("other model was served from the cache")
+	}
+}
+
+func TestEmbedDocuments(t *testing.T) {
+	server, requests := newEmbeddingServer(t, http.StatusOK)
+	s := newTestEmbeddingService(server.URL, 10)
+
+	texts := []string{"a", "bb"}
+	for range 2 {
+		got, err := s.EmbedDocuments(context.Background(), "test-model", 0, texts)
+		if err != nil {
+			t.Fatalf("EmbedDocuments() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, [][]float32{{1}, {2}}) {
+			t.Errorf("EmbedDocuments() = %v", got)
+		}
+	}
+
+	// Chunk embeddings are never cached, so both calls reach the provider
+	if n := len(requests()); n != 2 {
+		t.Errorf("sent %d requests, want 2", n)
+	}
+	if s.cache.order.Len() != 0 {
+		t.Errorf("cache holds %d entries, want none", s.cache.order.Len())
+	}
+}
+
+func TestEmbedBatchError(t *testing.T) {
+	server, requests := newEmbeddingServer(t, http.StatusBadRequest)
+	s := newTestEmbeddingService(server.URL, 10)
+	s.maxRetries = 3
+
+	if _, err := s.EmbedBatch(context.Background(), "test-model", 0, []string{"a"}); err == nil {
+		t.Fatal("EmbedBatch() error = nil, want an error")
+	}
+	// Client errors aren't retried
+	if n := len(requests()); n != 1 {
+		t.Errorf("sent %d requests, want 1", n)
+	}
+	if _, ok := s.cache.get(cacheKey("test-model", 0, textHash("a"))); ok {
+		t.Error("failed embedding was cached")
+	}
+}
+
+func TestEmbeddingsFromResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []openai.Embedding
+		want    [][]float32
+		wantErr bool
+	}{
+		{
+			name: "ordered by index",
+			data: []openai.Embedding{{Index: 1, Embedding: []float32{2, 2}}, {Index: 0, Embedding: []float32{1, 1}}},
+			want: [][]float32{{1, 1}, {2, 2}},
+		},
+		{
+			name:    "too few",
+			data:    []openai.Embedding{{Index: 0, Embedding: []float32{1, 1}}},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate index",
+			data:    []openai.Embedding{{Index: 0, Embedding: []float32{1, 1}}, {Index: 0, Embedding: []float32{2, 2}}},
+			wantErr: true,
+		},
+		{
+			name:    "index out of range",
+			data:    []openai.Embedding{{Index: 0, Embedding: []float32{1, 1}}, {Index: 2, Embedding: []float32{2, 2}}},
+			wantErr: true,
+		},
+		{
+			name:    "wrong dimensions",
+			data:    []openai.Embedding{{Index: 0, Embedding: []float32{1}}, {Index: 1, Embedding: []float32{2, 2}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := embeddingsFromResponse(openai.EmbeddingResponse{Data: tt.data}, "test-model", 2, 2)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("embeddingsFromResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("embeddingsFromResponse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
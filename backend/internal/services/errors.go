@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/apperr"
+)
+
+// Kinds of errors returned by the services, checked with errors.Is. Errors
+// with a user-facing message are *apperr.Error values of one of the kinds.
+var (
+	ErrNotFound            = apperr.ErrNotFound
+	ErrForbidden           = apperr.ErrForbidden
+	ErrConflict            = apperr.ErrConflict
+	ErrNotReady            = apperr.ErrNotReady
+	ErrInvalidInput        = apperr.ErrInvalidInput
+	ErrUnauthorized        = apperr.ErrUnauthorized
+	ErrRateLimited         = apperr.ErrRateLimited
+	ErrUpstreamUnavailable = apperr.ErrUpstreamUnavailable
+)
+
+// Classify a failed request to a model provider: rate limits become
+// ErrRateLimited, server and network errors ErrUpstreamUnavailable. Other
+// errors are returned unchanged.
+func upstreamError(provider string, err error) error {
+	// Deadlines are reported as timeouts by the stage that set them
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	status := 0
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		status = reqErr.HTTPStatusCode
+	}
+
+	var netErr net.Error
+	switch {
+	case status == http.StatusTooManyRequests:
+		return &apperr.Error{Kind: ErrRateLimited, Message: "The " + provider + " provider is rate limiting requests, try again shortly", Err: err}
+	case status >= 500, status == 0 && errors.As(err, &netErr):
+		return &apperr.Error{Kind: ErrUpstreamUnavailable, Message: "The " + provider + " provider is unavailable, try again later", Err: err}
+	}
+	return err
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Grounding labels for answer sentences
+const (
+	LabelSupported     = "supported"      // Backed by the retrieved chunks
+	LabelUnsupported   = "unsupported"    // Not backed by the chunks (general knowledge or hallucination)
+	LabelNotApplicable = "not_applicable" // No factual claim (greetings, transitions, "the textbook doesn't cover ...")
+)
+
+// FaithfulnessChecker grades whether each answer sentence is supported by
+// the retrieved context
+type FaithfulnessChecker struct {
+	client *openai.Client
+	model  string
+}
+
+// Create a faithfulness checker on the chat provider's client
+func NewFaithfulnessChecker(client *openai.Client, model string) *FaithfulnessChecker {
+	return &FaithfulnessChecker{
+		client: client,
+		model:  model,
+	}
+}
+
+// Label every sentence of the answer against the chunks it was generated from
+func (f *FaithfulnessChecker) Check(ctx context.Context, answer string, chunks []models.Chunk) (*models.Faithfulness, error) {
+	sentences := splitSentences(answer)
+	if len(sentences) == 0 {
+		return nil, fmt.Errorf("answer has no sentences to check")
+	}
+
+	var excerpts strings.Builder
+	for _, chunk := range chunks {
+		excerpts.WriteString(fmt.Sprintf("[chunk:%d]\n%s\n\n", chunk.ID, truncateContent(chunk.Content, 3000)))
+	}
+
+	var numbered strings.Builder
+	for i, sentence := range sentences {
+		numbered.WriteString(fmt.Sprintf("%d. %s\n", i, sentence.Text))
+	}
+
+	prompt := fmt.Sprintf(`Check whether each sentence of an answer is supported by the textbook excerpts.
+
+Excerpts:
+%s
+Answer sentences:
+%s
+For each sentence choose one label:
+- "supported": every factual claim in it is stated in or directly implied by the excerpts
+- "unsupported": it makes a claim the excerpts don't back up
+- "not_applicable": it makes no factual claim (e.g. a greeting, or saying the textbook doesn't cover something)
+
+Respond with JSON only: {"sentences": [{"index": 0, "label": "...", "chunk_ids": [<supporting chunk ids>]}, ...]} covering all %d sentences.`, excerpts.String(), numbered.String(), len(sentences))
+
+	resp, err := f.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: f.model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: "You are a strict fact checker. You only output JSON.",
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: prompt,
+			},
+		},
+		Temperature: 0,
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("faithfulness check failed: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response from faithfulness check")
+	}
+
+	var parsed struct {
+		Sentences []struct {
+			Index    int    `json:"index"`
+			Label    string `json:"label"`
+			ChunkIDs []int  `json:"chunk_ids"`
+		} `json:"sentences"`
+	}
+	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse faithfulness labels: %w", err)
+	}
+
+	// Sentences the grader skipped count as unsupported
+	for i := range sentences {
+		sentences[i].Label = LabelUnsupported
+	}
+
+	known := make(map[int]bool, len(chunks))
+	for _, chunk := range chunks {
+		known[chunk.ID] = true
+	}
+
+	for _, label := range parsed.Sentences {
+		if label.Index < 0 || label.Index >= len(sentences) {
+			continue
+		}
+		switch label.Label {
+		case LabelSupported, LabelUnsupported, LabelNotApplicable:
+			sentences[label.Index].Label = label.Label
+		}
+		var ids []int
+		for _, id := range label.ChunkIDs {
+			if known[id] {
+				ids = append(ids, id)
+			}
+		}
+		sentences[label.Index].ChunkIDs = ids
+	}
+
+	return scoreFaithfulness(sentences, f.model), nil
+}
+
+// Score is the share of factual sentences that are supported; an answer with
+// no factual sentences scores 1
+func scoreFaithfulness(sentences []models.SentenceLabel, model string) *models.Faithfulness {
+	result := &models.Faithfulness{
+		Score:     1,
+		Sentences: sentences,
+		Model:     model,
+	}
+
+	for _, sentence := range sentences {
+		switch sentence.Label {
+		case LabelSupported:
+			result.Supported++
+		case LabelUnsupported:
+			result.Unsupported++
+		}
+	}
+	if total := result.Supported + result.Unsupported; total > 0 {
+		result.Score = float64(result.Supported) / float64(total)
+	}
+
+	return result
+}
+
+// Split text into sentences, keeping rune offsets. Citation markers stay with
+// the sentence they follow, and line breaks (lists, headings) end a sentence.
+func splitSentences(text string) []models.SentenceLabel {
+	runes := []rune(text)
+	var sentences []models.SentenceLabel
+
+	start := 0
+	flush := func(end int) {
+		s, e := start, end
+		for s < e && unicode.IsSpace(runes[s]) {
+			s++
+		}
+		for e > s && unicode.IsSpace(runes[e-1]) {
+			e--
+		}
+		if s < e {
+			sentences = append(sentences, models.SentenceLabel{
+				Text:  string(runes[s:e]),
+				Start: s,
+				End:   e,
+			})
+		}
+		start = end
+	}
+
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\n':
+			flush(i + 1)
+		case isSentenceEnd(runes[i]) && (i+1 == len(runes) || unicode.IsSpace(runes[i+1]) || runes[i+1] == '['):
+			// Include trailing citation markers like " [2][3]"
+			end := i + 1
+			for {
+				k := end
+				for k < len(runes) && runes[k] == ' ' {
+					k++
+				}
+				n := markerLength(runes[k:])
+				if n == 0 {
+					break
+				}
+				end = k + n
+			}
+			flush(end)
+			i = end - 1
+		}
+	}
+	flush(len(runes))
+
+	return sentences
+}
+
+// Length of a "[n]" citation marker at the start of runes, or 0
+func markerLength(runes []rune) int {
+	if len(runes) < 3 || runes[0] != '[' {
+		return 0
+	}
+	for i := 1; i < len(runes); i++ {
+		if runes[i] == ']' && i > 1 {
+			return i + 1
+		}
+		if !unicode.IsDigit(runes[i]) {
+			return 0
+		}
+	}
+	return 0
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+)
+
+func TestSplitSentences(t *testing.T) {
+	sentence := func(text string, start, end int) models.SentenceLabel {
+		return models.SentenceLabel{Text: text, Start: start, End: end}
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want []models.SentenceLabel
+	}{
+		{
+			name: "empty",
+			text: "  \n ",
+			want: nil,
+		},
+		{
+			name: "sentence ends",
+			text: "One. Two! Three?",
+			want: []models.SentenceLabel{sentence("One.", 0, 4), sentence("Two!", 5, 9), sentence("Three?", 10, 16)},
+		},
+		{
+			name: "no final punctuation",
+			text: "One. And then",
+			want: []models.SentenceLabel{sentence("One.", 0, 4), sentence("And then", 5, 13)},
+		},
+		{
+			name: "decimals don't end a sentence",
+			text: "Pi is about 3.14 here.",
+			want: []models.SentenceLabel{sentence("Pi is about 3.14 here.", 0, 22)},
+		},
+		{
+			name: "markers stay with the sentence they follow",
+			text: "Cells divide.[1][2] Then grow. [3] Done.",
+			want: []models.SentenceLabel{
+				sentence("Cells divide.[1][2]", 0, 19),
+				sentence("Then grow. [3]", 20, 34),
+				sentence("Done.", 35, 40),
+			},
+		},
+		{
+			name: "line breaks end a sentence",
+			text: "Steps:\n- mix\n- bake",
+			want: []models.SentenceLabel{sentence("Steps:", 0, 6), sentence("- mix", 7, 12), sentence("- bake", 13, 19)},
+		},
+		{
+			name: "offsets are in runes",
+			text: "Él dijo. Sí.",
+			want: []models.SentenceLabel{sentence("Él dijo.", 0, 8), sentence("Sí.", 9, 12)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitSentences(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitSentences(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScoreFaithfulness(t *testing.T) {
+	labels := func(labels ...string) []models.SentenceLabel {
+		sentences := make([]models.SentenceLabel, len(labels))
+		for i, label := range labels {
+			sentences[i].Label = label
+		}
+		return sentences
+	}
+
+	tests := []struct {
+		name        string
+		sentences   []models.SentenceLabel
+		score       float64
+		supported   int
+		unsupported int
+	}{
+		{"all supported", labels(LabelSupported, LabelSupported), 1, 2, 0},
+		{"mixed", labels(LabelSupported, LabelUnsupported, LabelSupported, LabelUnsupported), 0.5, 2, 2},
+		{"not applicable sentences don't count", labels(LabelNotApplicable, LabelSupported, LabelUnsupported, LabelUnsupported), 1.0 / 3, 1, 2},
+		{"nothing factual", labels(LabelNotApplicable), 1, 0, 0},
+		{"all unsupported", labels(LabelUnsupported), 0, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scoreFaithfulness(tt.sentences, "grader")
+			if got.Score != tt.score || got.Supported != tt.supported || got.Unsupported != tt.unsupported {
+				t.Errorf("score = %v (%d supported, %d unsupported), want %v (%d, %d)",
+					got.Score, got.Supported, got.Unsupported, tt.score, tt.supported, tt.unsupported)
+			}
+			if got.Model != "grader" || len(got.Sentences) != len(tt.sentences) {
+				t.Errorf("model = %q with %d sentences", got.Model, len(got.Sentences))
+			}
+		})
+	}
+}
+
+func TestMarkerLength(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"[1] rest", 3},
+		{"[12]", 4},
+		{"[]", 0},
+		{"[a]", 0},
+		{"[1", 0},
+		{"text", 0},
+	}
+
+	for _, tt := range tests {
+		if got := markerLength([]rune(tt.text)); got != tt.want {
+			t.Errorf("markerLength(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
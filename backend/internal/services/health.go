@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jonkermoo/rag-textbook/backend/internal/config"
+	"github.com/jonkermoo/rag-textbook/backend/internal/database"
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+)
+
+// Health statuses
+const (
+	HealthOK          = "ok"
+	HealthFail        = "fail"
+	HealthUnavailable = "unavailable"
+)
+
+// How long a single dependency check may take
+const healthCheckTimeout = 3 * time.Second
+
+// HealthService checks the dependencies the API needs to serve requests
+type HealthService struct {
+	db       *database.DB
+	s3Client *s3.S3
+	s3Bucket string
+	cfg      *config.Config
+}
+
+// Create a new health service
+func NewHealthService(db *database.DB, s3Client *s3.S3, cfg *config.Config) *HealthService {
+	return &HealthService{
+		db:       db,
+		s3Client: s3Client,
+		s3Bucket: cfg.Storage.S3Bucket,
+		cfg:      cfg,
+	}
+}
+
+// A dependency check; returns a detail worth logging, if any
+type healthCheck func(ctx context.Context) (string, error)
+
+// Run every check concurrently. The status is "ok" only if all of them pass.
+// The response is public, so failures are only detailed in the log.
+func (s *HealthService) Check(ctx context.Context) *models.HealthResponse {
+	checks := map[string]healthCheck{
+		"database": s.checkDatabase,
+		"pgvector": s.db.CheckVectorExtension,
+		"schema":   s.checkSchema,
+		"storage":  s.checkStorage,
+		"llm":      s.checkLLM,
+	}
+
+	response := &models.HealthResponse{
+		Status: HealthOK,
+		Checks: make(map[string]models.HealthCheck, len(checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, detail, err := runHealthCheck(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			response.Checks[name] = result
+			if err != nil {
+				response.Status = HealthUnavailable
+				if detail != "" {
+					log.Printf("Health check %s failed (%s): %v", name, detail, err)
+				} else {
+					log.Printf("Health check %s failed: %v", name, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return response
+}
+
+// Run a check with a timeout. Returns the public result, and the detail and
+// error for the log.
+func runHealthCheck(ctx context.Context, check healthCheck) (models.HealthCheck, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	detail, err := check(ctx)
+	result := models.HealthCheck{
+		Status:    HealthOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+
+	if err != nil {
+		result.Status = HealthFail
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s: %w", healthCheckTimeout, err)
+		}
+	}
+
+	return result, detail, err
+}
+
+func (s *HealthService) checkDatabase(ctx context.Context) (string, error) {
+	return "", s.db.Ping(ctx)
+}
+
+func (s *HealthService) checkSchema(ctx context.Context) (string, error) {
+	version, err := s.db.SchemaVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	detail := fmt.Sprintf("version %d", version)
+	if version < database.RequiredSchemaVersion {
+		return detail, fmt.Errorf("schema version %d is older than the required %d; apply database/migrations", version, database.RequiredSchemaVersion)
+	}
+	return detail, nil
+}
+
+// The bucket exists and the credentials may access it
+func (s *HealthService) checkStorage(ctx context.Context) (string, error) {
+	_, err := s.s3Client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s.s3Bucket),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to access bucket %s: %w", s.s3Bucket, err)
+	}
+	return s.s3Bucket, nil
+}
+
+// Every model provider in use has credentials or a self-hosted endpoint.
+// Providers aren't called, so the check costs nothing.
+func (s *HealthService) checkLLM(ctx context.Context) (string, error) {
+	var missing []string
+	// Query expansion and faithfulness checks share the chat provider
+	if s.cfg.Chat.APIKey == "" && s.cfg.Chat.BaseURL == "" {
+		missing = append(missing, "chat (answers, query expansion, faithfulness)")
+	}
+	if s.cfg.Embedding.APIKey == "" && s.cfg.Embedding.BaseURL == "" {
+		missing = append(missing, "embedding")
+	}
+	if s.cfg.Reranker.Kind == config.RerankerLLM && s.cfg.Reranker.APIKey == "" && s.cfg.Reranker.BaseURL == "" {
+		missing = append(missing, "reranker")
+	}
+
+	detail := fmt.Sprintf("chat %s, embedding %s", s.cfg.Chat.Model, s.cfg.Embedding.Model)
+	if len(missing) > 0 {
+		return detail, fmt.Errorf("no API key or base URL for: %s", strings.Join(missing, ", "))
+	}
+	return detail, nil
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jonkermoo/rag-textbook/backend/internal/config"
+	"github.com/jonkermoo/rag-textbook/backend/internal/database"
+)
+
+const ingestionScript = "./ingestion/src/process_existing.py"
+
+const (
+	// How long recording a run's outcome may take once its context is cancelled
+	ingestionStatusTimeout = 10 * time.Second
+	// How often a running ingestion reports it's alive, and how often servers
+	// look for runs to take over
+	ingestionHeartbeatInterval = 30 * time.Second
+	// Running ingestions with no heartbeat for this long are taken over
+	ingestionStaleAfter = 4 * ingestionHeartbeatInterval
+)
+
+// IngestionService runs the Python ingestion pipeline on uploaded documents
+// in the background. Runs a shutdown interrupts are marked as such, and runs
+// whose server died stop heartbeating; ResumePending starts both over.
+type IngestionService struct {
+	db       *database.DB
+	s3Client *s3.S3
+	s3Bucket string
+	env      []string // Environment of the pipeline
+	workers  *WorkerGroup
+	stop     chan struct{} // Closed by Shutdown to end the ResumePending watch
+}
+
+// Create a new ingestion service
+func NewIngestionService(db *database.DB, s3Client *s3.S3, cfg *config.Config) *IngestionService {
+	return &IngestionService{
+		db:       db,
+		s3Client: s3Client,
+		s3Bucket: cfg.Storage.S3Bucket,
+		// The pipeline reads the same settings, including any from a config file
+		env:     append(os.Environ(), cfg.Environ()...),
+		workers: NewWorkerGroup(),
+		stop:    make(chan struct{}),
+	}
+}
+
+// Start ingesting an uploaded textbook in the background
+func (s *IngestionService) Start(textbookID int, s3Key string) {
+	started := s.workers.Go(func(ctx context.Context) {
+		s.run(ctx, textbookID, s3Key)
+	})
+	if !started {
+		log.Printf("Shutting down; ingestion of textbook %d resumes after a restart", textbookID)
+		s.setStatus(context.Background(), textbookID, database.IngestionInterrupted)
+	}
+}
+
+// Start over the ingestion runs interrupted by a shutdown or left behind by
+// a server that died, discarding whatever they had stored. Keeps checking in
+// the background until Shutdown, since a crashed run is only taken over once
+// its heartbeat is stale.
+func (s *IngestionService) ResumePending(ctx context.Context) error {
+	go s.watchPending()
+	return s.resumePending(ctx)
+}
+
+func (s *IngestionService) watchPending() {
+	ticker := time.NewTicker(ingestionHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.resumePending(context.Background()); err != nil {
+				log.Printf("Error resuming ingestion: %v", err)
+			}
+		}
+	}
+}
+
+func (s *IngestionService) resumePending(ctx context.Context) error {
+	textbooks, err := s.db.ClaimInterruptedIngestions(ctx, ingestionStaleAfter)
+	if err != nil {
+		return err
+	}
+
+	for _, textbook := range textbooks {
+		if err := s.db.ResetIngestion(ctx, textbook.ID); err != nil {
+			log.Printf("Error resetting ingestion of textbook %d: %v", textbook.ID, err)
+			s.setStatus(ctx, textbook.ID, database.IngestionFailed)
+			continue
+		}
+		log.Printf("Resuming ingestion of textbook %d", textbook.ID)
+		s.Start(textbook.ID, textbook.S3Key)
+	}
+
+	return nil
+}
+
+// Wait for running ingestions until ctx is done, then stop them and mark
+// them interrupted. No new ones start afterwards.
+func (s *IngestionService) Shutdown(ctx context.Context) error {
+	close(s.stop)
+	return s.workers.Shutdown(ctx)
+}
+
+func (s *IngestionService) run(ctx context.Context, textbookID int, s3Key string) {
+	log.Printf("Starting background processing for textbook %d", textbookID)
+	s.setStatus(ctx, textbookID, database.IngestionRunning)
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+	go s.heartbeat(heartbeatCtx, textbookID)
+	output, err := s.process(ctx, textbookID, s3Key)
+	stopHeartbeat()
+	switch {
+	case err == nil:
+		log.Printf("Successfully processed textbook %d", textbookID)
+		log.Printf("Python output: %s", output)
+		s.setStatus(ctx, textbookID, database.IngestionComplete)
+
+	case ctx.Err() != nil:
+		log.Printf("Processing of textbook %d interrupted by shutdown; it resumes after a restart", textbookID)
+		s.setStatus(ctx, textbookID, database.IngestionInterrupted)
+
+	default:
+		log.Printf("Error processing textbook %d: %v", textbookID, err)
+		if output != "" {
+			log.Printf("Python output: %s", output)
+		}
+		s.setStatus(ctx, textbookID, database.IngestionFailed)
+	}
+}
+
+// Download the document from S3 and run the pipeline on it. Cancelling ctx
+// kills the pipeline.
+func (s *IngestionService) process(ctx context.Context, textbookID int, s3Key string) (string, error) {
+	// Keep the extension so the ingestion pipeline can pick the right extractor
+	tmpFile := fmt.Sprintf("/tmp/textbook_%d%s", textbookID, strings.ToLower(filepath.Ext(s3Key)))
+	defer os.Remove(tmpFile)
+
+	if err := s.download(ctx, s3Key, tmpFile); err != nil {
+		return "", err
+	}
+
+	cmd := exec.CommandContext(ctx, "python3", ingestionScript, fmt.Sprintf("%d", textbookID), tmpFile)
+	cmd.Env = s.env
+	// Don't wait forever for output pipes held open after the kill
+	cmd.WaitDelay = 5 * time.Second
+
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+func (s *IngestionService) download(ctx context.Context, s3Key, path string) error {
+	result, err := s.s3Client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.s3Bucket),
+		Key:    aws.String(s3Key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to download from S3: %w", err)
+	}
+	defer result.Body.Close()
+
+	outFile, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer outFile.Close()
+
+	if _, err := io.Copy(outFile, result.Body); err != nil {
+		return fmt.Errorf("failed to save temp file: %w", err)
+	}
+	return nil
+}
+
+// Keep a run's heartbeat fresh until ctx is done
+func (s *IngestionService) heartbeat(ctx context.Context, textbookID int) {
+	ticker := time.NewTicker(ingestionHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.db.HeartbeatIngestion(ctx, textbookID); err != nil && ctx.Err() == nil {
+				log.Printf("Error recording heartbeat of textbook %d: %v", textbookID, err)
+			}
+		}
+	}
+}
+
+// Record a run's status. Still recorded after ctx is cancelled, since that's
+// when a run is marked interrupted.
+func (s *IngestionService) setStatus(ctx context.Context, textbookID int, status string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ingestionStatusTimeout)
+	defer cancel()
+
+	if err := s.db.SetIngestionStatus(ctx, textbookID, status); err != nil {
+		log.Printf("Error marking ingestion of textbook %d %s: %v", textbookID, status, err)
+	}
+}
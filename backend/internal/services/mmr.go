@@ -0,0 +1,83 @@
+package services
+
+import (
+	"math"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+)
+
+// Maximal marginal relevance: greedily pick k chunks, each time taking the
+// one that maximizes
+//
+//	(1 - diversity) * relevance - diversity * max similarity to already picked chunks
+//
+// Relevance is the rerank score when available, otherwise vector similarity.
+// Chunks without embeddings are treated as dissimilar to everything.
+func selectMMR(chunks []models.Chunk, k int, diversity float64) []models.Chunk {
+	if k >= len(chunks) {
+		k = len(chunks)
+	}
+
+	relevance := make([]float64, len(chunks))
+	for i, chunk := range chunks {
+		relevance[i] = 1.0 - chunk.Distance
+		if chunk.Scores != nil && chunk.Scores.RerankScore != nil {
+			relevance[i] = *chunk.Scores.RerankScore
+		}
+	}
+
+	// maxSim[i] = highest similarity between candidate i and any selected chunk
+	maxSim := make([]float64, len(chunks))
+	used := make([]bool, len(chunks))
+	selected := make([]models.Chunk, 0, k)
+
+	for len(selected) < k {
+		best := -1
+		bestScore := math.Inf(-1)
+
+		for i := range chunks {
+			if used[i] {
+				continue
+			}
+			score := (1-diversity)*relevance[i] - diversity*maxSim[i]
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		used[best] = true
+		chunk := chunks[best]
+		if chunk.Scores != nil {
+			mmrScore := bestScore
+			chunk.Scores.MMRScore = &mmrScore
+		}
+		selected = append(selected, chunk)
+
+		for i := range chunks {
+			if !used[i] {
+				maxSim[i] = math.Max(maxSim[i], cosineSimilarity(chunks[i].Embedding, chunk.Embedding))
+			}
+		}
+	}
+
+	return selected
+}
+
+// Cosine similarity of two embeddings (0 if either is missing)
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+)
+
+func TestSelectMMR(t *testing.T) {
+	score := func(v float64) *models.StageScores {
+		return &models.StageScores{RerankScore: &v}
+	}
+
+	tests := []struct {
+		name      string
+		chunks    []models.Chunk
+		k         int
+		diversity float64
+		ids       []int
+	}{
+		{
+			name: "no diversity ranks by similarity",
+			chunks: []models.Chunk{
+				{ID: 1, Distance: 0.1},
+				{ID: 2, Distance: 0.3},
+				{ID: 3, Distance: 0.2},
+			},
+			k:   2,
+			ids: []int{1, 3},
+		},
+		{
+			name: "rerank score overrides similarity",
+			chunks: []models.Chunk{
+				{ID: 1, Distance: 0.1, Scores: score(0.2)},
+				{ID: 2, Distance: 0.3, Scores: score(0.9)},
+			},
+			k:   2,
+			ids: []int{2, 1},
+		},
+		{
+			name: "diversity skips near duplicates",
+			chunks: []models.Chunk{
+				{ID: 1, Distance: 0.1, Embedding: []float32{1, 0}},
+				{ID: 2, Distance: 0.15, Embedding: []float32{1, 0}},
+				{ID: 3, Distance: 0.3, Embedding: []float32{0, 1}},
+			},
+			k:         2,
+			diversity: 0.5,
+			ids:       []int{1, 3},
+		},
+		{
+			name: "chunks without embeddings count as dissimilar",
+			chunks: []models.Chunk{
+				{ID: 1, Distance: 0.1, Embedding: []float32{1, 0}},
+				{ID: 2, Distance: 0.15},
+				{ID: 3, Distance: 0.3, Embedding: []float32{0, 1}},
+			},
+			k:         2,
+			diversity: 0.5,
+			ids:       []int{1, 2},
+		},
+		{
+			name: "k larger than the candidates",
+			chunks: []models.Chunk{
+				{ID: 1, Distance: 0.2},
+				{ID: 2, Distance: 0.1},
+			},
+			k:   5,
+			ids: []int{2, 1},
+		},
+		{
+			name:   "no candidates",
+			chunks: nil,
+			k:      3,
+			ids:    []int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := []int{}
+			for _, chunk := range selectMMR(tt.chunks, tt.k, tt.diversity) {
+				ids = append(ids, chunk.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.ids) {
+				t.Errorf("ids = %v, want %v", ids, tt.ids)
+			}
+		})
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float32
+		want float64
+	}{
+		{"identical", []float32{1, 2}, []float32{1, 2}, 1},
+		{"scaled", []float32{1, 0}, []float32{3, 0}, 1},
+		{"orthogonal", []float32{1, 0}, []float32{0, 1}, 0},
+		{"opposite", []float32{1, 0}, []float32{-1, 0}, -1},
+		{"missing", nil, []float32{1, 0}, 0},
+		{"different lengths", []float32{1}, []float32{1, 0}, 0},
+		{"zero vector", []float32{0, 0}, []float32{1, 0}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cosineSimilarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("cosineSimilarity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
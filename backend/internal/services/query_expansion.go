@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Pre-retrieval strategies selectable per request
+const (
+	StrategyNone       = ""
+	StrategyRewrite    = "rewrite"     // LLM rewrites the question into a search query
+	StrategyMultiQuery = "multi_query" // LLM writes several queries, results are fused
+	StrategyHyDE       = "hyde"        // Embed a hypothetical textbook passage instead of the question
+)
+
+// Check whether a strategy name is supported
+func IsValidStrategy(strategy string) bool {
+	switch strategy {
+	case StrategyNone, StrategyRewrite, StrategyMultiQuery, StrategyHyDE:
+		return true
+	}
+	return false
+}
+
+// Reciprocal rank fusion constant (standard value from the RRF paper)
+const rrfK = 60
+
+// QueryExpander generates alternative search queries with a chat model
+type QueryExpander struct {
+	client *openai.Client
+	model  string
+}
+
+// Create a query expander on the chat provider's client
+func NewQueryExpander(client *openai.Client, model string) *QueryExpander {
+	return &QueryExpander{
+		client: client,
+		model:  model,
+	}
+}
+
+// Rewrite a vague or conversational question into a standalone search query
+func (e *QueryExpander) Rewrite(ctx context.Context, question, textbookTitle string) (string, error) {
+	prompt := fmt.Sprintf(`Rewrite the student's question about the textbook "%s" into a precise search query for finding the relevant passage. Expand abbreviations and informal wording into the textbook's terminology. Reply with the query only.
+
+Question: %s`, textbookTitle, question)
+
+	return e.complete(ctx, prompt, 0, 200)
+}
+
+// Generate n differently-worded queries covering the question
+func (e *QueryExpander) Expand(ctx context.Context, question, textbookTitle string, n int) ([]string, error) {
+	prompt := fmt.Sprintf(`Write %d different search queries that would find passages in the textbook "%s" answering the student's question. Vary the wording and cover different aspects or likely terminology.
+
+Question: %s
+
+Respond with JSON only: {"queries": ["...", "..."]}`, n, textbookTitle, question)
+
+	resp, err := e.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: e.model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: prompt},
+		},
+		Temperature: 0.5,
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query expansion failed: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response from query expansion")
+	}
+
+	var parsed struct {
+		Queries []string `json:"queries"`
+	}
+	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse expanded queries: %w", err)
+	}
+
+	var queries []string
+	for _, q := range parsed.Queries {
+		if q = strings.TrimSpace(q); q != "" {
+			queries = append(queries, q)
+		}
+	}
+	if len(queries) > n {
+		queries = queries[:n]
+	}
+
+	return queries, nil
+}
+
+// Write a short hypothetical textbook passage that would answer the question (HyDE)
+func (e *QueryExpander) HypotheticalDocument(ctx context.Context, question, textbookTitle string) (string, error) {
+	prompt := fmt.Sprintf(`Write a short passage (about 120 words) as it might appear in the textbook "%s" that answers the question below. Use the style and terminology of a textbook. Do not mention the question.
+
+Question: %s`, textbookTitle, question)
+
+	return e.complete(ctx, prompt, 0.3, 300)
+}
+
+func (e *QueryExpander) complete(ctx context.Context, prompt string, temperature float32, maxTokens int) (string, error) {
+	resp, err := e.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: e.model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: prompt},
+		},
+		Temperature: temperature,
+		MaxTokens:   maxTokens,
+	})
+	if err != nil {
+		return "", fmt.Errorf("query expansion failed: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no response from query expansion")
+	}
+
+	text := strings.TrimSpace(resp.Choices[0].Message.Content)
+	if text == "" {
+		return "", fmt.Errorf("empty response from query expansion")
+	}
+	return text, nil
+}
+
+// Merge several ranked result lists with reciprocal rank fusion. A chunk's
+// fused score is the sum of 1/(rrfK + rank) over the lists it appears in
+// (rank is 1-based), so chunks found by several queries rise. Results are
+// ordered by that score, ties by best distance, and each gets its
+// FusionScore and 1-based FusionRank. A chunk's distance is its best
+// distance across the lists.
+func fuseResults(lists [][]models.Chunk) []models.Chunk {
+	scores := make(map[int]float64)
+	byID := make(map[int]models.Chunk)
+
+	for _, list := range lists {
+		for rank, chunk := range list {
+			scores[chunk.ID] += 1.0 / float64(rrfK+rank+1)
+			if existing, ok := byID[chunk.ID]; !ok || chunk.Distance < existing.Distance {
+				byID[chunk.ID] = chunk
+			}
+		}
+	}
+
+	fused := make([]models.Chunk, 0, len(byID))
+	for _, chunk := range byID {
+		fused = append(fused, chunk)
+	}
+	sort.Slice(fused, func(a, b int) bool {
+		if scores[fused[a].ID] != scores[fused[b].ID] {
+			return scores[fused[a].ID] > scores[fused[b].ID]
+		}
+		return fused[a].Distance < fused[b].Distance
+	})
+
+	for i := range fused {
+		score := scores[fused[i].ID]
+		fused[i].Scores = &models.StageScores{FusionScore: &score, FusionRank: i + 1}
+	}
+
+	return fused
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+)
+
+func TestIsValidStrategy(t *testing.T) {
+	tests := []struct {
+		strategy string
+		want     bool
+	}{
+		{StrategyNone, true},
+		{StrategyRewrite, true},
+		{StrategyMultiQuery, true},
+		{StrategyHyDE, true},
+		{"HyDE", false},
+		{"multi-query", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsValidStrategy(tt.strategy); got != tt.want {
+			t.Errorf("IsValidStrategy(%q) = %v, want %v", tt.strategy, got, tt.want)
+		}
+	}
+}
+
+func TestFuseResults(t *testing.T) {
+	chunk := func(id int, distance float64) models.Chunk {
+		return models.Chunk{ID: id, Distance: distance}
+	}
+
+	tests := []struct {
+		name      string
+		lists     [][]models.Chunk
+		ids       []int
+		distances []float64
+	}{
+		{
+			name:  "no lists",
+			lists: nil,
+		},
+		{
+			name:      "single list keeps its order",
+			lists:     [][]models.Chunk{{chunk(3, 0.1), chunk(1, 0.2), chunk(2, 0.3)}},
+			ids:       []int{3, 1, 2},
+			distances: []float64{0.1, 0.2, 0.3},
+		},
+		{
+			name: "chunks in several lists rank higher",
+			lists: [][]models.Chunk{
+				{chunk(1, 0.2), chunk(2, 0.3), chunk(3, 0.4)},
+				{chunk(3, 0.1), chunk(1, 0.5)},
+			},
+			ids: []int{1, 3, 2},
+			// Best distance across the lists
+			distances: []float64{0.2, 0.1, 0.3},
+		},
+		{
+			name: "equal scores fall back to distance",
+			lists: [][]models.Chunk{
+				{chunk(1, 0.3)},
+				{chunk(2, 0.2)},
+			},
+			ids:       []int{2, 1},
+			distances: []float64{0.2, 0.3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fused := fuseResults(tt.lists)
+
+			var ids []int
+			var distances []float64
+			for i, chunk := range fused {
+				ids = append(ids, chunk.ID)
+				distances = append(distances, chunk.Distance)
+				if chunk.Scores == nil || chunk.Scores.FusionScore == nil || chunk.Scores.FusionRank != i+1 {
+					t.Errorf("chunk %d: scores = %+v, want fusion score and rank %d", chunk.ID, chunk.Scores, i+1)
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.ids) {
+				t.Errorf("ids = %v, want %v", ids, tt.ids)
+			}
+			if !reflect.DeepEqual(distances, tt.distances) {
+				t.Errorf("distances = %v, want %v", distances, tt.distances)
+			}
+		})
+	}
+}
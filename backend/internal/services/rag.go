@@ -3,123 +3,540 @@ package services
 import (
 	"context"
 	"fmt"
-	"os"
+	"log"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/jonkermoo/rag-textbook/backend/internal/apperr"
+	"github.com/jonkermoo/rag-textbook/backend/internal/config"
 	"github.com/jonkermoo/rag-textbook/backend/internal/database"
 	"github.com/jonkermoo/rag-textbook/backend/internal/models"
 	"github.com/sashabaranov/go-openai"
 )
 
+// Chunks returned per query when the request doesn't set top_k, and the most
+// it may ask for
+const (
+	DefaultTopK = 5
+	MaxTopK     = 20
+)
+
+// MMR picks from this many candidates per returned chunk
+const mmrPoolFactor = 4
+
+// Number of extra queries generated by the multi-query strategy
+const multiQueryCount = 3
+
+// How the answer was produced
+const (
+	AnswerModeTextbook   = "textbook"    // Answered from retrieved textbook context
+	AnswerModeNotCovered = "not_covered" // Nothing relevant was retrieved; no model answer generated
+)
+
+// How well the retrieved chunks cover the question
+const (
+	CoverageNone    = "none"    // No chunk clears the relevance threshold
+	CoveragePartial = "partial" // Some chunks clear it
+	CoverageFull    = "full"    // At least half of the retrieved chunks clear it
+)
+
 type RAGService struct {
-	db               *database.DB
-	embeddingService *EmbeddingService
-	openaiClient     *openai.Client
+	db                      *database.DB
+	embeddingService        *EmbeddingService
+	openaiClient            *openai.Client
+	reranker                Reranker // nil when reranking is disabled
+	rerankCandidates        int
+	diversity               float64 // default MMR diversity, 0 disables MMR
+	chatModel               string
+	maxAnswerTokens         int
+	temperature             float32
+	contextBuilder          *ContextBuilder
+	queryExpander           *QueryExpander
+	threshold               float64 // server default max cosine distance for a relevant chunk
+	faithfulness            *FaithfulnessChecker
+	alwaysCheckFaithfulness bool
+	answerCache             *AnswerCache // nil when disabled
+	timeouts                config.TimeoutConfig
 }
 
 // Create a new RAG service
-func NewRAGService(db *database.DB, embeddingService *EmbeddingService) *RAGService {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	client := openai.NewClient(apiKey)
+func NewRAGService(db *database.DB, embeddingService *EmbeddingService, reranker Reranker, cfg *config.Config) *RAGService {
+	// Answers can come from any OpenAI-compatible provider (cfg.Chat.BaseURL).
+	// Query expansion and faithfulness checks use the same provider.
+	clientConfig := openai.DefaultConfig(cfg.Chat.APIKey)
+	if cfg.Chat.BaseURL != "" {
+		clientConfig.BaseURL = cfg.Chat.BaseURL
+	}
+	client := openai.NewClientWithConfig(clientConfig)
 
 	return &RAGService{
-		db:               db,
-		embeddingService: embeddingService,
-		openaiClient:     client,
+		db:                      db,
+		embeddingService:        embeddingService,
+		openaiClient:            client,
+		reranker:                reranker,
+		rerankCandidates:        cfg.Retrieval.RerankCandidates,
+		diversity:               cfg.Retrieval.MMRDiversity,
+		chatModel:               cfg.Chat.Model,
+		maxAnswerTokens:         cfg.Chat.MaxAnswerTokens,
+		temperature:             float32(cfg.Chat.Temperature),
+		contextBuilder:          NewContextBuilder(cfg.Chat.Model, cfg.Chat.ContextBudget()),
+		queryExpander:           NewQueryExpander(client, cfg.Retrieval.QueryExpansionModel),
+		threshold:               cfg.Retrieval.RelevanceThreshold,
+		faithfulness:            NewFaithfulnessChecker(client, cfg.Faithfulness.Model),
+		alwaysCheckFaithfulness: cfg.Faithfulness.Always,
+		answerCache:             NewAnswerCache(db, embeddingService, cfg.AnswerCache),
+		timeouts:                cfg.Timeouts,
 	}
 }
 
-// perform the complete RAG pipeline
-func (s *RAGService) Query(req models.QueryRequest, userID int) (*models.QueryResponse, error) {
+// Server-wide default relevance threshold
+func (s *RAGService) DefaultRelevanceThreshold() float64 {
+	return s.threshold
+}
+
+// perform the complete RAG pipeline. Stops when ctx is cancelled; a stage
+// that runs past its deadline fails the query with a *TimeoutError.
+func (s *RAGService) Query(ctx context.Context, req models.QueryRequest, userID int) (*models.QueryResponse, error) {
 	startTime := time.Now()
 
+	ctx, cancel := context.WithTimeout(ctx, s.timeouts.Query)
+	defer cancel()
+
 	// Validate textbook exists
-	textbook, err := s.db.GetTextbook(req.TextbookID)
+	textbook, err := s.db.GetTextbook(ctx, req.TextbookID)
 	if err != nil {
-		return nil, fmt.Errorf("textbook not found: %w", err)
+		return nil, err
 	}
 
 	// Check if user owns this textbook
 	if textbook.UserID != userID {
-		return nil, fmt.Errorf("permission denied: you don't own this textbook")
+		return nil, apperr.New(ErrForbidden, "You don't own this textbook")
 	}
 
 	if !textbook.Processed {
-		return nil, fmt.Errorf("textbook not yet processed")
+		return nil, apperr.New(ErrNotReady, "Textbook not yet processed")
 	}
 
 	// Set default topK if not provided
 	if req.TopK == 0 {
-		req.TopK = 5
+		req.TopK = DefaultTopK
+	}
+
+	// Over-fetch candidates when they will be reranked or diversified
+	rerank := req.Rerank && s.reranker != nil
+	diversity := s.diversity
+	if req.Diversity != nil {
+		diversity = min(max(*req.Diversity, 0), 1)
 	}
 
-	// Convert question to embedding
-	queryEmbedding, err := s.embeddingService.GenerateEmbedding(req.Question)
+	fetchK := req.TopK
+	if rerank {
+		fetchK = max(fetchK, s.rerankCandidates)
+	}
+	if diversity > 0 {
+		fetchK = max(fetchK, req.TopK*mmrPoolFactor)
+	}
+
+	// Queries must be embedded with the model the textbook is indexed with
+	generation, err := s.db.GetActiveEmbeddingGeneration(ctx, textbook.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+		return nil, err
+	}
+
+	threshold := s.relevanceThreshold(ctx, textbook, userID)
+
+	// Serve near-duplicate questions from the answer cache
+	var cacheEntry *answerCacheEntry
+	if s.answerCache != nil && !req.NoCache {
+		key := database.AnswerCacheKey{
+			TextbookID:    textbook.ID,
+			GenerationID:  generation.ID,
+			Dimensions:    generation.Dimensions,
+			ChatModel:     s.chatModel,
+			PromptVersion: promptVersion,
+			OptionsHash: answerOptions{
+				TopK:        req.TopK,
+				Filters:     req.Filters,
+				Rerank:      rerank,
+				Diversity:   diversity,
+				Strategy:    req.Strategy,
+				Threshold:   threshold,
+				Temperature: s.temperature,
+			}.hash(),
+		}
+
+		lookupCtx, cancelLookup := context.WithTimeout(ctx, s.timeouts.Embedding)
+		cached, entry, err := s.answerCache.Lookup(lookupCtx, key, generation, req.Question)
+		cancelLookup()
+		if err != nil {
+			log.Printf("Answer cache lookup failed: %v", err)
+		}
+		// A cached answer without a grounding check can't serve a request for one
+		if cached != nil && (cached.Faithfulness != nil || !(req.CheckFaithfulness || s.alwaysCheckFaithfulness)) {
+			cached.Cached = true
+			cached.Question = req.Question
+			cached.TimeTaken = float64(time.Since(startTime).Milliseconds())
+			return cached, nil
+		}
+		cacheEntry = entry
 	}
 
+	retrieval := &models.RetrievalInfo{EmbeddingModel: generation.Model}
+
 	// Retrieve similar chunks from database
-	chunks, err := s.db.SearchSimilarChunks(req.TextbookID, queryEmbedding, req.TopK)
+	chunks, err := s.retrieve(ctx, req, textbook.Title, generation, fetchK, diversity > 0, retrieval)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search chunks: %w", err)
+		return nil, err
 	}
+	retrieval.Candidates = len(chunks)
 
-	// Note: We allow processing even if no chunks found - GPT can still provide general guidance
-	// or let the user know the topic isn't covered in the textbook
+	if rerank || diversity > 0 || req.Strategy == StrategyMultiQuery {
+		initStageScores(chunks)
+	}
 
-	// Build context from chunk
-	contextStr := buildContext(chunks)
+	// Rescore candidates with the reranker
+	if rerank {
+		s.rerankChunks(ctx, req.Question, chunks, retrieval)
+	}
+
+	// Pick a diverse subset, or simply keep the best TopK
+	if diversity > 0 {
+		chunks = selectMMR(chunks, req.TopK, diversity)
+		retrieval.Diversity = diversity
+	} else if len(chunks) > req.TopK {
+		chunks = chunks[:req.TopK]
+	}
+
+	for i := range chunks {
+		if chunks[i].Scores != nil {
+			chunks[i].Scores.FinalRank = i + 1
+		}
+	}
+	retrieval.Returned = len(chunks)
+
+	// Only chunks within the relevance threshold are used to answer
+	var relevant []models.Chunk
+	retrieval.Ranked = make([]models.RankedChunk, 0, len(chunks))
+	for _, chunk := range chunks {
+		if chunk.Distance < threshold {
+			relevant = append(relevant, chunk)
+		}
+		retrieval.Ranked = append(retrieval.Ranked, models.RankedChunk{
+			ChunkID:    chunk.ID,
+			PageNumber: chunk.PageNumber,
+			PageEnd:    chunk.PageEnd,
+			Distance:   chunk.Distance,
+			Relevant:   chunk.Distance < threshold,
+		})
+	}
+	coverage := assessCoverage(len(relevant), len(chunks))
+
+	// Tell the student the topic isn't covered instead of generating an answer
+	// the textbook can't support
+	notCovered := func() *models.QueryResponse {
+		return &models.QueryResponse{
+			Answer:     notCoveredAnswer(textbook.Title, chunks),
+			AnswerMode: AnswerModeNotCovered,
+			Coverage:   CoverageNone,
+			Threshold:  threshold,
+			Sources:    []models.ChunkSource{},
+			Citations:  []models.Citation{},
+			Question:   req.Question,
+			Filters:    req.Filters,
+			Retrieval:  retrieval,
+			TimeTaken:  float64(time.Since(startTime).Milliseconds()),
+		}
+	}
+	if coverage == CoverageNone {
+		return notCovered(), nil
+	}
+
+	// Pack chunks into the prompt within the model's token budget
+	packed := s.contextBuilder.Build(relevant)
+	retrieval.ContextTokens = packed.Tokens
+	retrieval.ContextBudget = packed.Budget
+	retrieval.Dropped = packed.Dropped
+
+	// Nothing fit, so there is nothing to answer from
+	if len(packed.Chunks) == 0 {
+		return notCovered(), nil
+	}
+	chunks = packed.Chunks
+	retrieval.Returned = len(chunks)
 
 	// Generate answer using GPT-4
-	answer, err := s.generateAnswer(req.Question, contextStr, textbook.Title)
+	answer, err := runStage(ctx, "answer generation", s.timeouts.Generation, func(ctx context.Context) (string, error) {
+		return s.generateAnswer(ctx, req.Question, packed.Text, textbook.Title, coverage)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate answer: %w", err)
 	}
 
-	// Build response with sources - only include chunks with distance < 0.5 (relevant matches)
-	// Lower distance = more similar. We filter out irrelevant chunks.
-	var sources []models.ChunkSource
-	const relevanceThreshold = 0.5
+	// Check the model only cited chunks it was given and map them to sources
+	answer, citations, invalid := resolveCitations(answer, chunks)
+	if len(invalid) > 0 {
+		log.Printf("Stripped %d invalid citations from answer: %v", len(invalid), invalid)
+	}
 
-	for _, chunk := range chunks {
-		if chunk.Distance < relevanceThreshold {
-			sources = append(sources, models.ChunkSource{
-				PageNumber: chunk.PageNumber,
-				Content:    truncateContent(chunk.Content, 200),
-				Similarity: 1.0 - chunk.Distance, // Convert distance to similarity score
-			})
+	// Optionally grade how well the answer is grounded in the chunks. A failed
+	// check doesn't fail the query.
+	var faithfulness *models.Faithfulness
+	if req.CheckFaithfulness || s.alwaysCheckFaithfulness {
+		faithfulness, err = runStage(ctx, "faithfulness check", s.timeouts.Faithfulness, func(ctx context.Context) (*models.Faithfulness, error) {
+			return s.faithfulness.Check(ctx, answer, chunks)
+		})
+		if err != nil {
+			log.Printf("Faithfulness check failed: %v", err)
+		} else if err := s.db.SaveAnswerEvaluation(ctx, userID, textbook.ID, req.Question, answer, faithfulness); err != nil {
+			log.Printf("Failed to store answer evaluation: %v", err)
 		}
 	}
 
+	// Build response with sources (all packed chunks cleared the threshold)
+	var sources []models.ChunkSource
+	for _, chunk := range chunks {
+		sources = append(sources, models.ChunkSource{
+			ChunkID:       chunk.ID,
+			TextbookID:    chunk.TextbookID,
+			PageNumber:    chunk.PageNumber,
+			PageEnd:       chunk.PageEnd,
+			Location:      chunk.Location,
+			SectionPath:   chunk.SectionPath,
+			Content:       truncateContent(chunk.Content, 200),
+			Similarity:    1.0 - chunk.Distance, // Convert distance to similarity score
+			OCRConfidence: chunk.OCRConfidence,
+			Scores:        chunk.Scores,
+		})
+	}
+
 	timeTaken := time.Since(startTime).Milliseconds()
 
-	return &models.QueryResponse{
-		Answer:    answer,
-		Sources:   sources,
-		Question:  req.Question,
-		TimeTaken: float64(timeTaken),
-	}, nil
+	response := &models.QueryResponse{
+		Answer:       answer,
+		AnswerMode:   AnswerModeTextbook,
+		Coverage:     coverage,
+		Threshold:    threshold,
+		Sources:      sources,
+		Citations:    citations,
+		Invalid:      invalid,
+		Faithfulness: faithfulness,
+		Question:     req.Question,
+		Filters:      req.Filters,
+		Retrieval:    retrieval,
+		TimeTaken:    float64(timeTaken),
+	}
+
+	// The answer was paid for, so cache it even if the client has gone
+	if cacheEntry != nil {
+		if err := s.answerCache.Store(context.WithoutCancel(ctx), cacheEntry, response); err != nil {
+			log.Printf("Failed to cache answer: %v", err)
+		}
+	}
+
+	return response, nil
 }
 
+// Resolve the relevance threshold: textbook setting, then user setting, then server default
+func (s *RAGService) relevanceThreshold(ctx context.Context, textbook *models.Textbook, userID int) float64 {
+	if textbook.RelevanceThreshold != nil {
+		return *textbook.RelevanceThreshold
+	}
+
+	userThreshold, err := s.db.GetUserRelevanceThreshold(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to get user relevance threshold: %v", err)
+	} else if userThreshold != nil {
+		return *userThreshold
+	}
+
+	return s.threshold
+}
+
+// Classify coverage from how many retrieved chunks cleared the threshold
+func assessCoverage(relevant, retrieved int) string {
+	switch {
+	case relevant == 0:
+		return CoverageNone
+	case relevant*2 >= retrieved:
+		return CoverageFull
+	default:
+		return CoveragePartial
+	}
+}
+
+// Answer for questions the textbook doesn't cover, pointing at the closest material found
+func notCoveredAnswer(textbookTitle string, chunks []models.Chunk) string {
+	answer := fmt.Sprintf("This topic doesn't appear to be covered in \"%s\", so I can't answer it from the textbook.", textbookTitle)
+
+	var nearest []string
+	for i := 0; i < len(chunks) && i < 3; i++ {
+		nearest = append(nearest, chunkLabel(chunks[i]))
+	}
+	if len(nearest) > 0 {
+		answer += fmt.Sprintf(" The closest material I found (%s) doesn't address the question directly.", strings.Join(nearest, "; "))
+	}
+
+	return answer + " Try rephrasing the question with the textbook's terminology, or check the table of contents."
+}
+
+// Embed the question (or queries derived from it) and search for candidates.
+// If query generation fails we fall back to the original question. Each
+// candidate's Distance is from the original question, whatever was searched,
+// so the relevance threshold means the same for every strategy.
+func (s *RAGService) retrieve(ctx context.Context, req models.QueryRequest, textbookTitle string, generation *models.EmbeddingGeneration, fetchK int, withEmbeddings bool, retrieval *models.RetrievalInfo) ([]models.Chunk, error) {
+	queries := []string{req.Question} // Searched
+
+	switch req.Strategy {
+	case StrategyRewrite:
+		rewritten, err := runStage(ctx, "query rewrite", s.timeouts.QueryExpansion, func(ctx context.Context) (string, error) {
+			return s.queryExpander.Rewrite(ctx, req.Question, textbookTitle)
+		})
+		if err != nil {
+			log.Printf("Query rewrite failed, using original question: %v", err)
+			break
+		}
+		queries = []string{rewritten}
+		retrieval.Strategy = req.Strategy
+		retrieval.Queries = queries
+
+	case StrategyMultiQuery:
+		expanded, err := runStage(ctx, "query expansion", s.timeouts.QueryExpansion, func(ctx context.Context) ([]string, error) {
+			return s.queryExpander.Expand(ctx, req.Question, textbookTitle, multiQueryCount)
+		})
+		if err != nil {
+			log.Printf("Query expansion failed, using original question: %v", err)
+			break
+		}
+		queries = append(queries, expanded...)
+		retrieval.Strategy = req.Strategy
+		retrieval.Queries = expanded
+
+	case StrategyHyDE:
+		passage, err := runStage(ctx, "HyDE generation", s.timeouts.QueryExpansion, func(ctx context.Context) (string, error) {
+			return s.queryExpander.HypotheticalDocument(ctx, req.Question, textbookTitle)
+		})
+		if err != nil {
+			log.Printf("HyDE generation failed, using original question: %v", err)
+			break
+		}
+		queries = []string{passage}
+		retrieval.Strategy = req.Strategy
+		retrieval.Queries = queries
+	}
+
+	// Convert the question and queries to embeddings in one request. The
+	// question comes first, and is embedded even when it isn't searched.
+	texts := queries
+	if queries[0] != req.Question {
+		texts = append([]string{req.Question}, queries...)
+	}
+	embeddings, err := runStage(ctx, "embedding", s.timeouts.Embedding, func(ctx context.Context) ([][]float32, error) {
+		return s.embeddingService.EmbedBatch(ctx, generation.Model, generation.Dimensions, texts)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+	}
+	questionEmbedding := embeddings[0]
+	queryEmbeddings := embeddings[len(texts)-len(queries):]
+
+	// Distances from the question are computed from the chunk vectors when
+	// other text was searched
+	rescore := len(texts) > 1
+	withEmbeddings = withEmbeddings || rescore
+
+	lists := make([][]models.Chunk, 0, len(queries))
+	for _, queryEmbedding := range queryEmbeddings {
+		chunks, err := runStage(ctx, "vector search", s.timeouts.VectorSearch, func(ctx context.Context) ([]models.Chunk, error) {
+			return s.db.SearchSimilarChunks(ctx, generation, queryEmbedding, fetchK, req.Filters, withEmbeddings)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to search chunks: %w", err)
+		}
+		lists = append(lists, chunks)
+	}
+
+	chunks := lists[0]
+	if len(lists) > 1 {
+		chunks = fuseResults(lists)
+	}
+
+	if rescore {
+		for i := range chunks {
+			chunks[i].Distance = 1.0 - cosineSimilarity(questionEmbedding, chunks[i].Embedding)
+		}
+	}
+	return chunks, nil
+}
+
+// Record each candidate's similarity to the question, and its rank by that
+// similarity, before later stages reorder them. After multi-query fusion the
+// candidates are in fused order (see FusionRank), not this one.
+func initStageScores(chunks []models.Chunk) {
+	order := make([]int, len(chunks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return chunks[order[a]].Distance < chunks[order[b]].Distance
+	})
+
+	for rank, i := range order {
+		if chunks[i].Scores == nil {
+			chunks[i].Scores = &models.StageScores{}
+		}
+		chunks[i].Scores.VectorRank = rank + 1
+		chunks[i].Scores.VectorSimilarity = 1.0 - chunks[i].Distance
+	}
+}
+
+// Rescore chunks with the reranker and sort them by the new score. If the
+// reranker fails, keep vector order rather than failing the query.
+func (s *RAGService) rerankChunks(ctx context.Context, question string, chunks []models.Chunk, retrieval *models.RetrievalInfo) {
+	scores, err := runStage(ctx, "rerank", s.timeouts.Rerank, func(ctx context.Context) ([]float64, error) {
+		return s.reranker.Rerank(ctx, question, chunks)
+	})
+	if err != nil {
+		log.Printf("Rerank failed, using vector order: %v", err)
+		return
+	}
+	if len(scores) != len(chunks) {
+		log.Printf("Warning: %s returned %d scores for %d chunks, using vector order", s.reranker.Name(), len(scores), len(chunks))
+		return
+	}
+
+	retrieval.Reranker = s.reranker.Name()
+	for i := range chunks {
+		score := scores[i]
+		chunks[i].Scores.RerankScore = &score
+	}
+	sort.SliceStable(chunks, func(a, b int) bool {
+		return *chunks[a].Scores.RerankScore > *chunks[b].Scores.RerankScore
+	})
+}
+
+// Version of the answer prompt below. Bump it when the prompt changes so
+// cached answers from the old prompt stop being served.
+const promptVersion = 1
+
 // Call GPT-4 to generate an answer
-func (s *RAGService) generateAnswer(question, contextStr, textbookTitle string) (string, error) {
+func (s *RAGService) generateAnswer(ctx context.Context, question, contextStr, textbookTitle, coverage string) (string, error) {
 	systemPrompt := fmt.Sprintf(`You are a knowledgeable tutor with expertise in the subject matter covered in "%s".
 
 Your task is to answer the student's question using the provided textbook context.
 
-CRITICAL GUIDELINES:
-1. You MUST answer the question using ANY relevant information from the provided context
-2. If you find even a brief mention, reference, or related concept in the context - USE IT to construct your answer
-3. ALWAYS include page number citations when you reference information (e.g., "According to page 42..." or "On page 15...")
-4. If the exact topic isn't fully explained but is mentioned or related to other content, explain what IS available and cite those pages
-5. Draw connections between related concepts to provide the most comprehensive answer possible
-6. Be confident and authoritative - present information as facts from the textbook, not uncertainties
-7. Use clear, student-friendly language
-8. NEVER say you "cannot find" information or that it "isn't mentioned" if there is ANY reference to it in the context - instead, share what IS there
-
-Only if there is absolutely ZERO mention, reference, or relation to the topic anywhere in the provided context should you indicate the topic isn't covered.`, textbookTitle)
+GUIDELINES:
+1. Answer using the information in the provided context, including brief mentions and related concepts
+2. ALWAYS cite the excerpt that supports each statement by putting its marker right after the sentence, exactly as shown above the excerpt (e.g., "Eigenvalues are roots of the characteristic polynomial [chunk:123].")
+3. Only use markers that appear in the context, one marker per bracket; do not cite page numbers in prose
+4. Draw connections between related concepts in the context to give a complete answer
+5. If the context does not cover the question, or part of it, say so plainly (e.g., "The textbook excerpts don't cover ...") instead of filling the gap from general knowledge
+6. Use clear, student-friendly language`, textbookTitle)
+
+	coverageNote := ""
+	if coverage == CoveragePartial {
+		coverageNote = "\nNote: only part of the retrieved context closely matches this question. Make clear which parts of your answer the textbook supports and which it does not cover.\n"
+	}
 
 	userPrompt := fmt.Sprintf(`Context from textbook:
 ---
@@ -127,13 +544,13 @@ Only if there is absolutely ZERO mention, reference, or relation to the topic an
 ---
 
 Student question: %s
-
-Please provide a helpful answer based on the context above.`, contextStr, question)
+%s
+Please provide a helpful answer based on the context above.`, contextStr, question, coverageNote)
 
 	resp, err := s.openaiClient.CreateChatCompletion(
-		context.Background(),
+		ctx,
 		openai.ChatCompletionRequest{
-			Model: openai.GPT4,
+			Model: s.chatModel,
 			Messages: []openai.ChatCompletionMessage{
 				{
 					Role:    openai.ChatMessageRoleSystem,
@@ -144,13 +561,13 @@ Please provide a helpful answer based on the context above.`, contextStr, questi
 					Content: userPrompt,
 				},
 			},
-			Temperature: 0.7,
-			MaxTokens:   1500,
+			Temperature: s.temperature,
+			MaxTokens:   s.maxAnswerTokens,
 		},
 	)
 
 	if err != nil {
-		return "", fmt.Errorf("openai api error: %w", err)
+		return "", fmt.Errorf("openai api error: %w", upstreamError("language model", err))
 	}
 
 	if len(resp.Choices) == 0 {
@@ -160,18 +577,22 @@ Please provide a helpful answer based on the context above.`, contextStr, questi
 	return resp.Choices[0].Message.Content, nil
 }
 
-// Concatenate chunk content for the prompt
-func buildContext(chunks []models.Chunk) string {
-	var builder strings.Builder
-
-	for i, chunk := range chunks {
-		builder.WriteString(fmt.Sprintf("[Page %d]\n%s\n\n", chunk.PageNumber, chunk.Content))
-		if i < len(chunks)-1 {
-			builder.WriteString("---\n\n")
+// Citation label for a chunk; slide decks and sectioned documents carry
+// their own location, PDFs fall back to the page range. The section path is
+// appended when it adds information beyond the location.
+func chunkLabel(chunk models.Chunk) string {
+	label := chunk.Location
+	if label == "" {
+		if chunk.PageEnd > chunk.PageNumber {
+			label = fmt.Sprintf("Pages %d-%d", chunk.PageNumber, chunk.PageEnd)
+		} else {
+			label = fmt.Sprintf("Page %d", chunk.PageNumber)
 		}
 	}
-
-	return builder.String()
+	if chunk.SectionPath != "" && chunk.SectionPath != chunk.Location {
+		label += " | " + chunk.SectionPath
+	}
+	return label
 }
 
 // Limit content length for source display
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/database"
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+)
+
+// Chunks embedded and stored per round trip
+const reembedBatchSize = 50
+
+// ReembedService builds new embedding generations in the background. The
+// textbook keeps being searched with its active generation until the new
+// one is complete. Generations a shutdown interrupts stay building and are
+// picked up again by ResumePending.
+type ReembedService struct {
+	db               *database.DB
+	embeddingService *EmbeddingService
+	workers          *WorkerGroup
+}
+
+// Create a new re-embed service
+func NewReembedService(db *database.DB, embeddingService *EmbeddingService) *ReembedService {
+	return &ReembedService{
+		db:               db,
+		embeddingService: embeddingService,
+		workers:          NewWorkerGroup(),
+	}
+}
+
+// Start re-embedding a textbook's chunks with a model. Returns the new
+// generation while it's still building.
+func (s *ReembedService) Start(ctx context.Context, textbookID int, model string, dimensions int) (*models.EmbeddingGeneration, error) {
+	generation, err := s.db.CreateEmbeddingGeneration(ctx, textbookID, model, dimensions)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Re-embedding textbook %d with %s (%d dimensions), generation %d", textbookID, model, dimensions, generation.ID)
+	s.start(generation)
+
+	return generation, nil
+}
+
+// Continue generations that were still building when the server stopped.
+// Chunks embedded before the restart are skipped.
+func (s *ReembedService) ResumePending(ctx context.Context) error {
+	generations, err := s.db.ListBuildingEmbeddingGenerations(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range generations {
+		generation := &generations[i]
+		log.Printf("Resuming re-embed of textbook %d with %s, generation %d (%d/%d chunks)",
+			generation.TextbookID, generation.Model, generation.ID, generation.EmbeddedCount, generation.ChunkCount)
+		s.start(generation)
+	}
+
+	return nil
+}
+
+// Wait for running re-embeds until ctx is done, then stop them where they
+// are. No new ones start afterwards.
+func (s *ReembedService) Shutdown(ctx context.Context) error {
+	return s.workers.Shutdown(ctx)
+}
+
+// Build a generation in the background, detached from the request that
+// started it
+func (s *ReembedService) start(generation *models.EmbeddingGeneration) {
+	started := s.workers.Go(func(ctx context.Context) {
+		s.run(ctx, generation)
+	})
+	if !started {
+		log.Printf("Shutting down; re-embed of textbook %d (generation %d) resumes after a restart", generation.TextbookID, generation.ID)
+	}
+}
+
+func (s *ReembedService) run(ctx context.Context, generation *models.EmbeddingGeneration) {
+	if err := s.build(ctx, generation); err != nil {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			// Chunks embedded so far are kept; the rest are embedded on resume
+			log.Printf("Re-embed of textbook %d interrupted by shutdown (generation %d)", generation.TextbookID, generation.ID)
+			return
+		}
+		log.Printf("Re-embed of textbook %d failed (generation %d): %v", generation.TextbookID, generation.ID, err)
+		if err := s.db.FailEmbeddingGeneration(ctx, generation.ID, err.Error()); err != nil {
+			log.Printf("Error marking generation %d failed: %v", generation.ID, err)
+		}
+		return
+	}
+
+	log.Printf("Textbook %d is now searched with %s (generation %d)", generation.TextbookID, generation.Model, generation.ID)
+}
+
+// Embed every chunk missing from the generation, make sure its dimension has
+// a vector index, then switch the textbook over to it
+func (s *ReembedService) build(ctx context.Context, generation *models.EmbeddingGeneration) error {
+	for {
+		chunks, err := s.db.ListChunksToEmbed(ctx, generation, reembedBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(chunks) == 0 {
+			break
+		}
+
+		chunkIDs := make([]int, len(chunks))
+		contents := make([]string, len(chunks))
+		for i, chunk := range chunks {
+			chunkIDs[i] = chunk.ID
+			contents[i] = chunk.Content
+		}
+
+		embeddings, err := s.embeddingService.EmbedDocuments(ctx, generation.Model, generation.Dimensions, contents)
+		if err != nil {
+			return fmt.Errorf("failed to embed chunks: %w", err)
+		}
+
+		if err := s.db.InsertChunkEmbeddings(ctx, generation, chunkIDs, embeddings); err != nil {
+			return err
+		}
+	}
+
+	if err := s.db.EnsureVectorIndex(ctx, generation.Dimensions); err != nil {
+		return err
+	}
+
+	return s.db.ActivateEmbeddingGeneration(ctx, generation)
+}
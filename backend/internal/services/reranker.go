@@ -0,0 +1,235 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/config"
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Reranker rescores retrieved chunks against the question. Scores are
+// returned in the same order as the input chunks; higher is more relevant.
+type Reranker interface {
+	Name() string
+	Rerank(ctx context.Context, question string, chunks []models.Chunk) ([]float64, error)
+}
+
+// Create the reranker selected by cfg.Kind ("llm", "cross-encoder"), or nil if reranking is disabled
+func NewReranker(cfg config.RerankerConfig) Reranker {
+	switch cfg.Kind {
+	case config.RerankerLLM:
+		return NewLLMReranker(cfg)
+	case config.RerankerCrossEncoder:
+		return NewCrossEncoderReranker(cfg)
+	default:
+		return nil
+	}
+}
+
+// LLMReranker asks a chat model to grade each passage's relevance.
+// Works with OpenAI or any OpenAI-compatible endpoint (cfg.BaseURL).
+type LLMReranker struct {
+	client    *openai.Client
+	model     string
+	batchSize int
+}
+
+// Create an LLM-based reranker
+func NewLLMReranker(cfg config.RerankerConfig) *LLMReranker {
+	clientConfig := openai.DefaultConfig(cfg.APIKey)
+	if cfg.BaseURL != "" {
+		clientConfig.BaseURL = cfg.BaseURL
+	}
+
+	return &LLMReranker{
+		client:    openai.NewClientWithConfig(clientConfig),
+		model:     cfg.Model,
+		batchSize: 10,
+	}
+}
+
+func (r *LLMReranker) Name() string {
+	return "llm:" + r.model
+}
+
+// Score passages in batches, running the batches concurrently
+func (r *LLMReranker) Rerank(ctx context.Context, question string, chunks []models.Chunk) ([]float64, error) {
+	scores := make([]float64, len(chunks))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+
+	for start := 0; start < len(chunks); start += r.batchSize {
+		end := min(start+r.batchSize, len(chunks))
+
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+
+			batchScores, err := r.scoreBatch(ctx, question, chunks[start:end])
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			copy(scores[start:end], batchScores)
+		}(start, end)
+	}
+
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	return scores, nil
+}
+
+func (r *LLMReranker) scoreBatch(ctx context.Context, question string, chunks []models.Chunk) ([]float64, error) {
+	var passages strings.Builder
+	for i, chunk := range chunks {
+		passages.WriteString(fmt.Sprintf("[%d]\n%s\n\n", i, truncateContent(chunk.Content, 1500)))
+	}
+
+	prompt := fmt.Sprintf(`Rate how useful each passage is for answering the question, from 0 (irrelevant) to 10 (directly answers it).
+
+Question: %s
+
+Passages:
+%s
+Respond with JSON only: {"scores": [<score for passage 0>, <score for passage 1>, ...]} with exactly %d numbers.`, question, passages.String(), len(chunks))
+
+	resp, err := r.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: r.model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: "You are a search relevance grader. You only output JSON.",
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: prompt,
+			},
+		},
+		Temperature: 0,
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("rerank request failed: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response from reranker")
+	}
+
+	var parsed struct {
+		Scores []float64 `json:"scores"`
+	}
+	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse rerank scores: %w", err)
+	}
+	if len(parsed.Scores) != len(chunks) {
+		return nil, fmt.Errorf("reranker returned %d scores for %d passages", len(parsed.Scores), len(chunks))
+	}
+
+	// Normalize to 0..1 so scores are comparable across rerankers
+	for i := range parsed.Scores {
+		parsed.Scores[i] /= 10
+	}
+
+	return parsed.Scores, nil
+}
+
+// CrossEncoderReranker calls a locally hosted cross-encoder through a
+// /rerank endpoint (Hugging Face text-embeddings-inference style):
+// POST {"query": ..., "texts": [...]} -> [{"index": 0, "score": 0.93}, ...]
+type CrossEncoderReranker struct {
+	url        string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// Create a cross-encoder reranker
+func NewCrossEncoderReranker(cfg config.RerankerConfig) *CrossEncoderReranker {
+	return &CrossEncoderReranker{
+		url:        strings.TrimSuffix(cfg.BaseURL, "/") + "/rerank",
+		apiKey:     cfg.APIKey,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (r *CrossEncoderReranker) Name() string {
+	return "cross-encoder"
+}
+
+func (r *CrossEncoderReranker) Rerank(ctx context.Context, question string, chunks []models.Chunk) ([]float64, error) {
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Content
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"query": question,
+		"texts": texts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode rerank request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build rerank request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if r.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+r.apiKey)
+	}
+
+	resp, err := r.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("rerank request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("reranker returned status %d", resp.StatusCode)
+	}
+
+	var results []struct {
+		Index int     `json:"index"`
+		Score float64 `json:"score"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("failed to parse rerank response: %w", err)
+	}
+
+	// Every text must be scored exactly once; a missing score would silently
+	// rank its chunk last
+	scores := make([]float64, len(chunks))
+	scored := make([]bool, len(chunks))
+	for _, result := range results {
+		if result.Index < 0 || result.Index >= len(scores) || scored[result.Index] {
+			return nil, fmt.Errorf("reranker returned invalid index %d for %d texts", result.Index, len(chunks))
+		}
+		scores[result.Index] = result.Score
+		scored[result.Index] = true
+	}
+	if len(results) != len(chunks) {
+		return nil, fmt.Errorf("reranker returned %d scores for %d texts", len(results), len(chunks))
+	}
+
+	return scores, nil
+}
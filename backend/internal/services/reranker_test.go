@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+)
+
+// Reranker returning fixed scores
+type fakeReranker struct {
+	scores []float64
+	err    error
+}
+
+func (r *fakeReranker) Name() string { return "fake" }
+
+func (r *fakeReranker) Rerank(ctx context.Context, question string, chunks []models.Chunk) ([]float64, error) {
+	return r.scores, r.err
+}
+
+func TestRerankChunks(t *testing.T) {
+	tests := []struct {
+		name     string
+		reranker *fakeReranker
+		ids      []int
+		used     string // RetrievalInfo.Reranker
+	}{
+		{
+			name:     "orders by rerank score",
+			reranker: &fakeReranker{scores: []float64{0.2, 0.9, 0.5}},
+			ids:      []int{2, 3, 1},
+			used:     "fake",
+		},
+		{
+			name:     "ties keep vector order",
+			reranker: &fakeReranker{scores: []float64{0.5, 0.5, 0.9}},
+			ids:      []int{3, 1, 2},
+			used:     "fake",
+		},
+		{
+			name:     "too few scores keep vector order",
+			reranker: &fakeReranker{scores: []float64{0.2, 0.9}},
+			ids:      []int{1, 2, 3},
+		},
+		{
+			name:     "too many scores keep vector order",
+			reranker: &fakeReranker{scores: []float64{0.2, 0.9, 0.5, 1}},
+			ids:      []int{1, 2, 3},
+		},
+		{
+			name:     "failure keeps vector order",
+			reranker: &fakeReranker{err: errors.New("unavailable")},
+			ids:      []int{1, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := []models.Chunk{
+				{ID: 1, Scores: &models.StageScores{}},
+				{ID: 2, Scores: &models.StageScores{}},
+				{ID: 3, Scores: &models.StageScores{}},
+			}
+			s := &RAGService{reranker: tt.reranker}
+			retrieval := &models.RetrievalInfo{}
+
+			s.rerankChunks(context.Background(), "question", chunks, retrieval)
+
+			var ids []int
+			for _, chunk := range chunks {
+				ids = append(ids, chunk.ID)
+				if (chunk.Scores.RerankScore != nil) != (tt.used != "") {
+					t.Errorf("chunk %d: rerank score = %v", chunk.ID, chunk.Scores.RerankScore)
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.ids) {
+				t.Errorf("ids = %v, want %v", ids, tt.ids)
+			}
+			if retrieval.Reranker != tt.used {
+				t.Errorf("reranker = %q, want %q", retrieval.Reranker, tt.used)
+			}
+		})
+	}
+}
+
+func TestCrossEncoderRerank(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		want     []float64
+		wantErr  bool
+	}{
+		{
+			name:     "scores mapped back to input order",
+			status:   http.StatusOK,
+			response: `[{"index": 2, "score": 0.9}, {"index": 0, "score": 0.4}, {"index": 1, "score": 0.1}]`,
+			want:     []float64{0.4, 0.1, 0.9},
+		},
+		{
+			name:     "out of range index",
+			status:   http.StatusOK,
+			response: `[{"index": 0, "score": 0.4}, {"index": 1, "score": 0.1}, {"index": 2, "score": 0.3}, {"index": 7, "score": 1}]`,
+			wantErr:  true,
+		},
+		{
+			name:     "missing score",
+			status:   http.StatusOK,
+			response: `[{"index": 0, "score": 0.4}, {"index": 2, "score": 0.3}]`,
+			wantErr:  true,
+		},
+		{
+			name:     "duplicate index",
+			status:   http.StatusOK,
+			response: `[{"index": 0, "score": 0.4}, {"index": 0, "score": 0.1}, {"index": 2, "score": 0.3}]`,
+			wantErr:  true,
+		},
+		{
+			name:    "error status",
+			status:  http.StatusInternalServerError,
+			wantErr: true,
+		},
+		{
+			name:     "malformed response",
+			status:   http.StatusOK,
+			response: `{"scores": []}`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req struct {
+					Query string   `json:"query"`
+					Texts []string `json:"texts"`
+				}
+				if r.URL.Path != "/rerank" || r.Header.Get("Authorization") != "Bearer key" {
+					t.Errorf("request %s with auth %q", r.URL.Path, r.Header.Get("Authorization"))
+				}
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Query != "question" || len(req.Texts) != 3 {
+					t.Errorf("request body = %+v, %v", req, err)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			r := &CrossEncoderReranker{url: server.URL + "/rerank", apiKey: "key", httpClient: &http.Client{Timeout: 5 * time.Second}}
+			chunks := []models.Chunk{{Content: "a"}, {Content: "b"}, {Content: "c"}}
+
+			scores, err := r.Rerank(context.Background(), "question", chunks)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Rerank() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(scores, tt.want) {
+				t.Errorf("Rerank() = %v, want %v", scores, tt.want)
+			}
+		})
+	}
+}
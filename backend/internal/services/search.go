@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/apperr"
+	"github.com/jonkermoo/rag-textbook/backend/internal/config"
+	"github.com/jonkermoo/rag-textbook/backend/internal/database"
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+)
+
+const (
+	DefaultSearchPageSize = 10
+	MaxSearchPageSize     = 50
+	// Snippet length in runes
+	snippetLength = 300
+)
+
+// Common words that shouldn't be highlighted
+var searchStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"does": true, "for": true, "from": true, "how": true, "in": true, "is": true, "it": true, "of": true,
+	"on": true, "or": true, "the": true, "to": true, "what": true, "when": true, "where": true,
+	"which": true, "who": true, "why": true, "with": true,
+}
+
+// SearchService finds where topics are discussed without generating an answer
+type SearchService struct {
+	db               *database.DB
+	embeddingService *EmbeddingService
+	timeouts         config.TimeoutConfig
+}
+
+// Create a new search service
+func NewSearchService(db *database.DB, embeddingService *EmbeddingService, timeouts config.TimeoutConfig) *SearchService {
+	return &SearchService{
+		db:               db,
+		embeddingService: embeddingService,
+		timeouts:         timeouts,
+	}
+}
+
+// Search one textbook (textbookID != 0) or all of the user's textbooks.
+// page is 1-based; hits below minScore are left out.
+func (s *SearchService) Search(ctx context.Context, userID, textbookID int, query string, page, pageSize int, minScore float64) (*models.SearchResponse, error) {
+	startTime := time.Now()
+
+	if textbookID != 0 {
+		textbook, err := s.db.GetTextbook(ctx, textbookID)
+		if err != nil {
+			return nil, err
+		}
+		if textbook.UserID != userID {
+			return nil, apperr.New(ErrForbidden, "You don't own this textbook")
+		}
+		if !textbook.Processed {
+			return nil, apperr.New(ErrNotReady, "Textbook not yet processed")
+		}
+	}
+
+	// Each textbook is searched in the vector space of its active embeddings
+	var embeddingModels []database.EmbeddingModel
+	if textbookID != 0 {
+		generation, err := s.db.GetActiveEmbeddingGeneration(ctx, textbookID)
+		if err != nil {
+			return nil, err
+		}
+		embeddingModels = []database.EmbeddingModel{{Model: generation.Model, Dimensions: generation.Dimensions}}
+	} else {
+		var err error
+		embeddingModels, err = s.db.ListActiveEmbeddingModels(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	maxDistance := 0.0
+	if minScore > 0 {
+		maxDistance = 1.0 - minScore
+	}
+
+	// Fetch one extra hit to know whether there is another page. With several
+	// models the result lists are merged by rank, so each has to be fetched
+	// from the top.
+	limit, offset := pageSize+1, (page-1)*pageSize
+	if len(embeddingModels) > 1 {
+		limit, offset = offset+pageSize+1, 0
+	}
+
+	var lists [][]models.SearchHit
+	for _, embeddingModel := range embeddingModels {
+		queryEmbedding, err := runStage(ctx, "embedding", s.timeouts.Embedding, func(ctx context.Context) ([]float32, error) {
+			return s.embeddingService.Embed(ctx, embeddingModel.Model, embeddingModel.Dimensions, query)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+		}
+
+		modelHits, err := runStage(ctx, "vector search", s.timeouts.VectorSearch, func(ctx context.Context) ([]models.SearchHit, error) {
+			return s.db.SearchChunks(ctx, userID, textbookID, embeddingModel, queryEmbedding, limit, offset, maxDistance)
+		})
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, modelHits)
+	}
+
+	hits := []models.SearchHit{}
+	if len(lists) == 1 {
+		hits = lists[0]
+	} else if len(lists) > 1 {
+		hits = fuseSearchHits(lists)
+		start := min((page-1)*pageSize, len(hits))
+		hits = hits[start:min(start+pageSize+1, len(hits))]
+	}
+
+	hasMore := len(hits) > pageSize
+	if hasMore {
+		hits = hits[:pageSize]
+	}
+
+	terms := searchTerms(query)
+	for i := range hits {
+		hits[i].Snippet, hits[i].Highlights = highlightSnippet(hits[i].Content, terms)
+	}
+
+	return &models.SearchResponse{
+		Query:      query,
+		TextbookID: textbookID,
+		Page:       page,
+		PageSize:   pageSize,
+		HasMore:    hasMore,
+		Hits:       hits,
+		TimeTaken:  float64(time.Since(startTime).Milliseconds()),
+	}, nil
+}
+
+// Merge the hits of several embedding models with reciprocal rank fusion.
+// Similarities from different models aren't on the same scale, so only the
+// ranks are compared; the score breaks ties. A textbook has one active
+// generation, so no chunk is in more than one list.
+func fuseSearchHits(lists [][]models.SearchHit) []models.SearchHit {
+	type fusedHit struct {
+		hit   models.SearchHit
+		score float64
+	}
+
+	var fused []fusedHit
+	for _, list := range lists {
+		for rank, hit := range list {
+			fused = append(fused, fusedHit{hit: hit, score: 1.0 / float64(rrfK+rank+1)})
+		}
+	}
+	sort.SliceStable(fused, func(a, b int) bool {
+		if fused[a].score != fused[b].score {
+			return fused[a].score > fused[b].score
+		}
+		return fused[a].hit.Score > fused[b].hit.Score
+	})
+
+	hits := make([]models.SearchHit, len(fused))
+	for i, f := range fused {
+		hits[i] = f.hit
+	}
+	return hits
+}
+
+// Lowercased query words worth highlighting
+func searchTerms(query string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) < 3 || searchStopWords[word] || seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+	}
+
+	return terms
+}
+
+// Cut a snippet around the densest cluster of query terms and return the
+// positions of the terms within it. Semantic hits may contain none of the
+// query's words, in which case the snippet is the start of the chunk.
+func highlightSnippet(content string, terms []string) (string, []models.Highlight) {
+	runes := []rune(strings.Join(strings.Fields(content), " "))
+	matches := findTerms(runes, terms)
+
+	start := 0
+	if len(runes) > snippetLength && len(matches) > 0 {
+		// Window that contains the most matches
+		best := 0
+		for i := range matches {
+			count := 0
+			for _, m := range matches[i:] {
+				if m.End-matches[i].Start > snippetLength {
+					break
+				}
+				count++
+			}
+			if count > best {
+				best = count
+				start = matches[i].Start
+			}
+		}
+		// Give the first match some leading context, starting on a word boundary
+		start = max(start-snippetLength/5, 0)
+		for start > 0 && runes[start-1] != ' ' {
+			start--
+		}
+		start = min(start, len(runes)-snippetLength)
+	}
+
+	end := min(start+snippetLength, len(runes))
+	for end < len(runes) && end > start && runes[end-1] != ' ' {
+		end--
+	}
+	if end == start {
+		end = min(start+snippetLength, len(runes))
+	}
+
+	prefix, suffix := "", ""
+	if start > 0 {
+		prefix = "..."
+	}
+	if end < len(runes) {
+		suffix = "..."
+	}
+	snippet := prefix + strings.TrimSpace(string(runes[start:end])) + suffix
+
+	// Recompute offsets against the final snippet text
+	return snippet, findTerms([]rune(snippet), terms)
+}
+
+// Find whole-word, case-insensitive occurrences of terms (and words that
+// start with them, so "cell" highlights "cells")
+func findTerms(runes []rune, terms []string) []models.Highlight {
+	highlights := []models.Highlight{}
+	if len(terms) == 0 {
+		return highlights
+	}
+
+	lower := []rune(strings.ToLower(string(runes)))
+	if len(lower) != len(runes) {
+		// Lowercasing changed the length; offsets would be wrong
+		return highlights
+	}
+
+	isWord := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+	for i := 0; i < len(lower); {
+		if !isWord(lower[i]) || (i > 0 && isWord(lower[i-1])) {
+			i++
+			continue
+		}
+		end := i
+		for end < len(lower) && isWord(lower[end]) {
+			end++
+		}
+		word := string(lower[i:end])
+		for _, term := range terms {
+			if strings.HasPrefix(word, term) {
+				highlights = append(highlights, models.Highlight{Start: i, End: end})
+				break
+			}
+		}
+		i = end
+	}
+
+	return highlights
+}
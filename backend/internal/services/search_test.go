@@ -0,0 +1,198 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jonkermoo/rag-textbook/backend/internal/models"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"What is the mitochondria?", []string{"mitochondria"}},
+		{"Cell cell CELL division", []string{"cell", "division"}},
+		{"ATP-synthase in 2 steps", []string{"atp", "synthase", "steps"}},
+		{"is it a DNA", []string{"dna"}},
+		{"how to", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := searchTerms(tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("searchTerms(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindTerms(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		terms []string
+		want  []models.Highlight
+	}{
+		{
+			name:  "whole words, case-insensitive",
+			text:  "Cells divide. A cell grows.",
+			terms: []string{"cell"},
+			want:  []models.Highlight{{Start: 0, End: 5}, {Start: 16, End: 20}},
+		},
+		{
+			name:  "no match inside a word",
+			text:  "Excellent results",
+			terms: []string{"cell"},
+			want:  []models.Highlight{},
+		},
+		{
+			name:  "several terms",
+			text:  "ATP powers the cell",
+			terms: []string{"cell", "atp"},
+			want:  []models.Highlight{{Start: 0, End: 3}, {Start: 15, End: 19}},
+		},
+		{
+			name:  "rune offsets",
+			text:  "Über die Zelle",
+			terms: []string{"zelle"},
+			want:  []models.Highlight{{Start: 9, End: 14}},
+		},
+		{
+			name: "no terms",
+			text: "anything",
+			want: []models.Highlight{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findTerms([]rune(tt.text), tt.terms); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findTerms() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	filler := strings.Repeat("lorem ipsum dolor sit amet ", 30)
+
+	tests := []struct {
+		name       string
+		content    string
+		terms      []string
+		wantPrefix bool
+		wantSuffix bool
+		contains   string
+		highlights int
+	}{
+		{
+			name:       "short content is returned whole",
+			content:    "The   cell\nmembrane is thin.",
+			terms:      []string{"membrane"},
+			contains:   "The cell membrane is thin.",
+			highlights: 1,
+		},
+		{
+			name:       "long content without matches starts at the beginning",
+			content:    filler,
+			terms:      []string{"mitochondria"},
+			wantSuffix: true,
+			contains:   "lorem ipsum",
+		},
+		{
+			name:       "window moves to the matches",
+			content:    filler + "the mitochondria make ATP for the mitochondria " + filler,
+			terms:      []string{"mitochondria"},
+			wantPrefix: true,
+			wantSuffix: true,
+			contains:   "mitochondria make ATP",
+			highlights: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snippet, highlights := highlightSnippet(tt.content, tt.terms)
+
+			if !strings.Contains(snippet, tt.contains) {
+				t.Errorf("snippet %q does not contain %q", snippet, tt.contains)
+			}
+			if got := strings.HasPrefix(snippet, "..."); got != tt.wantPrefix {
+				t.Errorf("leading ellipsis = %v, want %v", got, tt.wantPrefix)
+			}
+			if got := strings.HasSuffix(snippet, "..."); got != tt.wantSuffix {
+				t.Errorf("trailing ellipsis = %v, want %v", got, tt.wantSuffix)
+			}
+			if body := strings.Trim(snippet, "."); len([]rune(body)) > snippetLength {
+				t.Errorf("snippet is %d runes, want at most %d", len([]rune(body)), snippetLength)
+			}
+
+			if len(highlights) != tt.highlights {
+				t.Errorf("got %d highlights, want %d", len(highlights), tt.highlights)
+			}
+
+			// Offsets must point at the terms in the returned snippet
+			runes := []rune(snippet)
+			for _, h := range highlights {
+				word := strings.ToLower(string(runes[h.Start:h.End]))
+				if !strings.HasPrefix(word, tt.terms[0]) {
+					t.Errorf("highlight %v covers %q", h, word)
+				}
+			}
+		})
+	}
+}
+
+func TestFuseSearchHits(t *testing.T) {
+	hit := func(id int, score float64) models.SearchHit {
+		return models.SearchHit{ChunkID: id, Score: score}
+	}
+
+	tests := []struct {
+		name  string
+		lists [][]models.SearchHit
+		want  []int
+	}{
+		{
+			name:  "single list keeps its order",
+			lists: [][]models.SearchHit{{hit(1, 0.9), hit(2, 0.5), hit(3, 0.4)}},
+			want:  []int{1, 2, 3},
+		},
+		{
+			name: "ranks interleave regardless of score scale",
+			lists: [][]models.SearchHit{
+				{hit(1, 0.9), hit(2, 0.8), hit(3, 0.7)},
+				{hit(4, 0.3), hit(5, 0.2)},
+			},
+			want: []int{1, 4, 2, 5, 3},
+		},
+		{
+			name: "equal ranks are ordered by score",
+			lists: [][]models.SearchHit{
+				{hit(1, 0.4)},
+				{hit(2, 0.6)},
+			},
+			want: []int{2, 1},
+		},
+		{
+			name:  "empty lists",
+			lists: [][]models.SearchHit{{}, nil},
+			want:  []int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := []int{}
+			for _, h := range fuseSearchHits(tt.lists) {
+				ids = append(ids, h.ChunkID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("fuseSearchHits() order = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package services
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jonkermoo/rag-textbook/backend/internal/config"
+)
+
+// Create an S3 client for the configured region. The server creates one and
+// shares it between uploads, ingestion and health checks.
+func NewS3Client(cfg config.StorageConfig) *s3.S3 {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region: aws.String(cfg.AWSRegion),
+	}))
+	return s3.New(sess)
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// TimeoutError reports which stage ran out of time
+type TimeoutError struct {
+	Stage string
+}
+
+func (e *TimeoutError) Error() string {
+	return e.Stage + " timed out"
+}
+
+// Lets errors.Is(err, context.DeadlineExceeded) see through it
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// Run one stage with its own deadline. A stage that runs out of time returns
+// a *TimeoutError naming it.
+func runStage[T any](ctx context.Context, stage string, timeout time.Duration, fn func(ctx context.Context) (T, error)) (T, error) {
+	stageCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result, err := fn(stageCtx)
+	if err != nil && errors.Is(stageCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		var zero T
+		return zero, &TimeoutError{Stage: stage}
+	}
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		var zero T
+		return zero, &TimeoutError{Stage: "query"}
+	}
+	return result, err
+}
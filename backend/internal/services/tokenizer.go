@@ -0,0 +1,73 @@
+package services
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// Use the BPE files bundled with the loader instead of downloading them at runtime
+func init() {
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// Tokenizer counts and truncates text in model tokens
+type Tokenizer struct {
+	model    string
+	once     sync.Once
+	encoding *tiktoken.Tiktoken
+}
+
+// Create a tokenizer for a chat or embedding model
+func NewTokenizer(model string) *Tokenizer {
+	return &Tokenizer{model: model}
+}
+
+// Load the encoding on first use; unknown models fall back to cl100k_base,
+// and if that fails too we approximate with 4 characters per token
+func (t *Tokenizer) load() {
+	t.once.Do(func() {
+		enc, err := tiktoken.EncodingForModel(t.model)
+		if err != nil {
+			enc, err = tiktoken.GetEncoding(tiktoken.MODEL_CL100K_BASE)
+		}
+		if err != nil {
+			log.Printf("Tokenizer unavailable for %s, approximating: %v", t.model, err)
+			return
+		}
+		t.encoding = enc
+	})
+}
+
+// Count the tokens in text
+func (t *Tokenizer) Count(text string) int {
+	t.load()
+	if t.encoding == nil {
+		return (len(text) + 3) / 4
+	}
+	return len(t.encoding.EncodeOrdinary(text))
+}
+
+// Truncate text to at most maxTokens tokens
+func (t *Tokenizer) Truncate(text string, maxTokens int) string {
+	if maxTokens <= 0 {
+		return ""
+	}
+
+	t.load()
+	if t.encoding == nil {
+		if len(text) <= maxTokens*4 {
+			return text
+		}
+		return strings.ToValidUTF8(text[:maxTokens*4], "")
+	}
+
+	tokens := t.encoding.EncodeOrdinary(text)
+	if len(tokens) <= maxTokens {
+		return text
+	}
+	return t.encoding.Decode(tokens[:maxTokens])
+}
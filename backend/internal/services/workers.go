@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"sync"
+)
+
+// WorkerGroup tracks background jobs so a shutdown can wait for them. Jobs
+// get a context that is cancelled when the shutdown deadline passes.
+type WorkerGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// Create a new worker group
+func NewWorkerGroup() *WorkerGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &WorkerGroup{ctx: ctx, cancel: cancel}
+}
+
+// Run a job in the background. Returns false, without running it, once the
+// group is shutting down.
+func (g *WorkerGroup) Go(job func(ctx context.Context)) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return false
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		job(g.ctx)
+	}()
+	return true
+}
+
+// Stop accepting jobs and wait for the running ones. When ctx is done first,
+// the jobs are cancelled and their context error is returned once they have
+// all returned.
+func (g *WorkerGroup) Shutdown(ctx context.Context) error {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		g.cancel()
+		return nil
+	case <-ctx.Done():
+		g.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
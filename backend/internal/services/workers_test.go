@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerGroupShutdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		job      func(ctx context.Context)
+		deadline time.Duration
+		wantErr  error
+	}{
+		{
+			name:     "waits for running jobs",
+			job:      func(ctx context.Context) { time.Sleep(20 * time.Millisecond) },
+			deadline: time.Second,
+		},
+		{
+			name:     "cancels jobs at the deadline",
+			job:      func(ctx context.Context) { <-ctx.Done() },
+			deadline: 20 * time.Millisecond,
+			wantErr:  context.DeadlineExceeded,
+		},
+		{
+			name: "no jobs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWorkerGroup()
+			var finished atomic.Int32
+			if tt.job != nil {
+				for range 3 {
+					g.Go(func(ctx context.Context) {
+						tt.job(ctx)
+						finished.Add(1)
+					})
+				}
+			}
+
+			ctx := context.Background()
+			if tt.deadline > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.deadline)
+				defer cancel()
+			}
+
+			if err := g.Shutdown(ctx); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Shutdown() error = %v, want %v", err, tt.wantErr)
+			}
+			// Shutdown returns only after every job has
+			if tt.job != nil && finished.Load() != 3 {
+				t.Errorf("%d jobs finished before Shutdown returned, want 3", finished.Load())
+			}
+		})
+	}
+}
+
+func TestWorkerGroupGoAfterShutdown(t *testing.T) {
+	g := NewWorkerGroup()
+	if err := g.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	ran := make(chan struct{}, 1)
+	if g.Go(func(ctx context.Context) { ran <- struct{}{} }) {
+		t.Error("Go() = true after shutdown, want false")
+	}
+	select {
+	case <-ran:
+		t.Error("job ran after shutdown")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestWorkerGroupContextCancelledAfterShutdown(t *testing.T) {
+	g := NewWorkerGroup()
+	jobCtx := make(chan context.Context, 1)
+	g.Go(func(ctx context.Context) { jobCtx <- ctx })
+
+	if err := g.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if err := (<-jobCtx).Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("job context error = %v, want context.Canceled", err)
+	}
+}
@@ -32,8 +32,10 @@ CREATE TABLE chunks (
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
--- Create index for fast vector similarity search
-CREATE INDEX ON chunks USING ivfflat (embedding vector_cosine_ops) WITH (lists = 100);
+-- Create index for fast vector similarity search. HNSW doesn't need training
+-- data, so unlike ivfflat it can be built on the empty table. Rebuild with
+-- other parameters using: go run ./cmd/vectorindex rebuild
+CREATE INDEX idx_chunks_embedding_hnsw ON chunks USING hnsw (embedding vector_cosine_ops) WITH (m = 16, ef_construction = 64);
 
 -- Create index for faster lookups
 CREATE INDEX idx_chunks_textbook_id ON chunks(textbook_id);
@@ -0,0 +1,4 @@
+-- Location-aware citations for non-PDF documents
+-- page_number holds the page, slide or section ordinal; location holds the
+-- human readable label ("Page 12", "Slide 4: Recursion", "Chapter 2 > Trees")
+ALTER TABLE chunks ADD COLUMN IF NOT EXISTS location VARCHAR(1000);
@@ -0,0 +1,9 @@
+-- OCR fallback for scanned pages
+-- ocr_confidence is the mean Tesseract word confidence (0..1) for chunks
+-- whose text came from OCR, NULL for chunks from a native text layer
+ALTER TABLE chunks ADD COLUMN IF NOT EXISTS ocr_confidence REAL;
+
+-- Per-textbook extraction stats reported by the status endpoint
+ALTER TABLE textbooks ADD COLUMN IF NOT EXISTS page_count INTEGER;
+ALTER TABLE textbooks ADD COLUMN IF NOT EXISTS ocr_page_count INTEGER DEFAULT 0;
+ALTER TABLE textbooks ADD COLUMN IF NOT EXISTS dropped_page_count INTEGER DEFAULT 0;
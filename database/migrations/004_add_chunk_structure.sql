@@ -0,0 +1,7 @@
+-- Structure-aware chunking
+-- Chunks may now span pages (page_number .. page_end) and carry the heading
+-- path of the section they belong to
+ALTER TABLE chunks ADD COLUMN IF NOT EXISTS page_end INTEGER;
+ALTER TABLE chunks ADD COLUMN IF NOT EXISTS section_path TEXT;
+
+UPDATE chunks SET page_end = page_number WHERE page_end IS NULL;
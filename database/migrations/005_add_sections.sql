@@ -0,0 +1,16 @@
+-- Table of contents extracted at ingest (PDF bookmarks, font-size
+-- heuristics, or document headings). Page ranges are inclusive and use the
+-- same numbering as chunks.page_number.
+CREATE TABLE IF NOT EXISTS sections (
+    id SERIAL PRIMARY KEY,
+    textbook_id INTEGER REFERENCES textbooks(id) ON DELETE CASCADE,
+    parent_id INTEGER REFERENCES sections(id) ON DELETE CASCADE,
+    level INTEGER NOT NULL,
+    title VARCHAR(500) NOT NULL,
+    page_start INTEGER NOT NULL,
+    page_end INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sections_textbook_id ON sections(textbook_id);
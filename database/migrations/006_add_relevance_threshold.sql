@@ -0,0 +1,5 @@
+-- Configurable relevance threshold (maximum cosine distance for a chunk to
+-- count as relevant). NULL falls back to the user's setting, then the
+-- server default.
+ALTER TABLE textbooks ADD COLUMN IF NOT EXISTS relevance_threshold DOUBLE PRECISION;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS relevance_threshold DOUBLE PRECISION;
@@ -0,0 +1,18 @@
+-- Faithfulness checks of generated answers, kept for analytics (e.g. how
+-- often answers lean on general knowledge, per textbook or over time).
+CREATE TABLE IF NOT EXISTS answer_evaluations (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    textbook_id INTEGER REFERENCES textbooks(id) ON DELETE CASCADE,
+    question TEXT NOT NULL,
+    answer TEXT NOT NULL,
+    faithfulness_score REAL NOT NULL,
+    supported_count INTEGER NOT NULL,
+    unsupported_count INTEGER NOT NULL,
+    sentence_labels JSONB NOT NULL,
+    model VARCHAR(100),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_answer_evaluations_textbook_id ON answer_evaluations(textbook_id);
+CREATE INDEX IF NOT EXISTS idx_answer_evaluations_created_at ON answer_evaluations(created_at);
@@ -0,0 +1,21 @@
+-- Replace the ivfflat index with HNSW. ivfflat was created with lists = 100
+-- on an empty table, so its centroids were never trained on real data and
+-- recall was poor; HNSW needs no training and keeps recall high as the table
+-- grows. Build parameters can be changed later with cmd/vectorindex.
+--
+-- Every search filters on textbook_id. We considered partitioning chunks by
+-- textbook (or partial indexes per textbook) so each search only touches one
+-- book's vectors, but both need DDL per upload and don't help the
+-- library-wide search. Instead:
+--   * small textbooks are served exactly by idx_chunks_textbook_id plus a
+--     sort (the planner picks this when the filter is selective), and
+--   * for HNSW scans the API enables hnsw.iterative_scan (pgvector >= 0.8) so
+--     the filter can't starve the result set.
+-- Revisit hash partitioning on textbook_id if chunks passes ~10M rows.
+DROP INDEX IF EXISTS chunks_embedding_idx;
+
+CREATE INDEX IF NOT EXISTS idx_chunks_embedding_hnsw
+    ON chunks USING hnsw (embedding vector_cosine_ops)
+    WITH (m = 16, ef_construction = 64);
+
+ANALYZE chunks;
@@ -0,0 +1,59 @@
+-- Embedding generations: each textbook's chunks can be embedded by several
+-- models side by side. Exactly one generation per textbook is active and
+-- used for search; a re-embed builds a new generation in the background and
+-- switches to it atomically when complete.
+CREATE TABLE IF NOT EXISTS embedding_generations (
+    id SERIAL PRIMARY KEY,
+    textbook_id INTEGER REFERENCES textbooks(id) ON DELETE CASCADE,
+    model VARCHAR(200) NOT NULL,
+    dimensions INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'building', -- building | active | retired | failed
+    chunk_count INTEGER NOT NULL DEFAULT 0,
+    embedded_count INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    activated_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_embedding_generations_textbook_id ON embedding_generations(textbook_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_embedding_generations_active
+    ON embedding_generations(textbook_id) WHERE status = 'active';
+
+-- Vectors per (generation, chunk). The column has no fixed dimension so
+-- models of different sizes can coexist; HNSW indexes need one, so there is a
+-- partial expression index per dimension (cmd/vectorindex creates more).
+CREATE TABLE IF NOT EXISTS chunk_embeddings (
+    generation_id INTEGER REFERENCES embedding_generations(id) ON DELETE CASCADE,
+    chunk_id INTEGER REFERENCES chunks(id) ON DELETE CASCADE,
+    dimensions INTEGER NOT NULL,
+    embedding vector NOT NULL,
+    PRIMARY KEY (generation_id, chunk_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_chunk_embeddings_chunk_id ON chunk_embeddings(chunk_id);
+
+-- Existing embeddings become each textbook's first (active) generation
+INSERT INTO embedding_generations (textbook_id, model, dimensions, status, chunk_count, embedded_count, activated_at)
+SELECT c.textbook_id, 'text-embedding-3-small', 1536, 'active', COUNT(*), COUNT(c.embedding), CURRENT_TIMESTAMP
+FROM chunks c
+WHERE NOT EXISTS (SELECT 1 FROM embedding_generations g WHERE g.textbook_id = c.textbook_id)
+GROUP BY c.textbook_id;
+
+INSERT INTO chunk_embeddings (generation_id, chunk_id, dimensions, embedding)
+SELECT g.id, c.id, 1536, c.embedding
+FROM chunks c
+JOIN embedding_generations g ON g.textbook_id = c.textbook_id AND g.status = 'active'
+WHERE c.embedding IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+CREATE INDEX IF NOT EXISTS idx_chunk_embeddings_hnsw_1536
+    ON chunk_embeddings USING hnsw ((embedding::vector(1536)) vector_cosine_ops)
+    WITH (m = 16, ef_construction = 64)
+    WHERE dimensions = 1536;
+
+-- chunks.embedding is no longer written or read. It is kept (nullable) until
+-- the backfill has been verified; drop it with:
+--   ALTER TABLE chunks DROP COLUMN embedding;
+DROP INDEX IF EXISTS idx_chunks_embedding_hnsw;
+
+ANALYZE chunk_embeddings;
@@ -0,0 +1,12 @@
+-- Shared cache of embeddings keyed by model and a SHA-256 of the input text,
+-- so repeated questions aren't sent to the embedding API again. Rows can be
+-- deleted at any time; they are recomputed on the next miss, e.g.:
+--   DELETE FROM embedding_cache WHERE created_at < NOW() - INTERVAL '90 days';
+CREATE TABLE IF NOT EXISTS embedding_cache (
+    model VARCHAR(200) NOT NULL,
+    dimensions INTEGER NOT NULL,
+    text_hash CHAR(64) NOT NULL,
+    embedding vector NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (model, dimensions, text_hash)
+);
@@ -0,0 +1,20 @@
+-- Generated answers, reused for near-duplicate questions about the same
+-- textbook. Entries are tied to the embedding generation they were retrieved
+-- from, and are deleted when the textbook is re-ingested or re-embedded.
+CREATE TABLE IF NOT EXISTS answer_cache (
+    id SERIAL PRIMARY KEY,
+    textbook_id INTEGER REFERENCES textbooks(id) ON DELETE CASCADE,
+    generation_id INTEGER REFERENCES embedding_generations(id) ON DELETE CASCADE,
+    chat_model VARCHAR(200) NOT NULL,
+    prompt_version INTEGER NOT NULL,
+    options_hash CHAR(64) NOT NULL, -- retrieval options that change the answer (top_k, filters, ...)
+    question TEXT NOT NULL,
+    question_embedding vector NOT NULL, -- of the normalized question
+    response JSONB NOT NULL,
+    hit_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_hit_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_answer_cache_lookup
+    ON answer_cache(textbook_id, generation_id, chat_model, prompt_version, options_hash);
@@ -0,0 +1,8 @@
+-- Progress of a textbook's ingestion run, so runs interrupted by a shutdown
+-- are restarted when the server comes back:
+-- pending | running | interrupted | complete | failed
+-- Unprocessed textbooks from before this migration count as failed rather
+-- than being re-ingested.
+ALTER TABLE textbooks ADD COLUMN IF NOT EXISTS ingestion_status VARCHAR(20) NOT NULL DEFAULT 'failed';
+UPDATE textbooks SET ingestion_status = 'complete' WHERE processed = true;
+ALTER TABLE textbooks ALTER COLUMN ingestion_status SET DEFAULT 'pending';
@@ -0,0 +1,9 @@
+-- Migrations applied to this database. Every later migration ends by
+-- inserting its number; the API's readiness check (/api/health/ready)
+-- compares the highest with the version the server needs.
+CREATE TABLE IF NOT EXISTS schema_version (
+    version INTEGER PRIMARY KEY,
+    applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO schema_version (version) VALUES (13) ON CONFLICT DO NOTHING;
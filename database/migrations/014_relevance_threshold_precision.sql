@@ -0,0 +1,9 @@
+-- Relevance thresholds were REAL, which stores 0.3 as 0.30000001192...
+-- That value showed up in the settings API and the answer cache options
+-- hash. Rounding to 6 digits recovers what users entered.
+ALTER TABLE textbooks ALTER COLUMN relevance_threshold TYPE DOUBLE PRECISION
+    USING round(relevance_threshold::numeric, 6)::double precision;
+ALTER TABLE users ALTER COLUMN relevance_threshold TYPE DOUBLE PRECISION
+    USING round(relevance_threshold::numeric, 6)::double precision;
+
+INSERT INTO schema_version (version) VALUES (14) ON CONFLICT DO NOTHING;
@@ -0,0 +1,6 @@
+-- When a running ingestion last reported progress. Runs whose server stopped
+-- without marking them interrupted (a crash or kill) stop heartbeating, and
+-- any server takes them over once the heartbeat is stale.
+ALTER TABLE textbooks ADD COLUMN IF NOT EXISTS ingestion_heartbeat_at TIMESTAMP;
+
+INSERT INTO schema_version (version) VALUES (15) ON CONFLICT DO NOTHING;
@@ -0,0 +1,17 @@
+-- At most one generation per textbook may be building, so two re-embeds
+-- started at the same moment can't both be created. Older duplicates left
+-- by that race are marked failed first so the index can be built.
+UPDATE embedding_generations g
+SET status = 'failed', error = 'Superseded by a newer re-embed'
+WHERE status = 'building'
+  AND EXISTS (
+    SELECT 1 FROM embedding_generations newer
+    WHERE newer.textbook_id = g.textbook_id
+      AND newer.status = 'building'
+      AND newer.id > g.id
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_embedding_generations_building
+    ON embedding_generations(textbook_id) WHERE status = 'building';
+
+INSERT INTO schema_version (version) VALUES (16) ON CONFLICT DO NOTHING;
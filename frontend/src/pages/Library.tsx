@@ -1,6 +1,6 @@
 import { useState, useEffect, useRef } from "react";
 import { useNavigate } from "react-router-dom";
-import { textbookAPI, queryAPI } from "../services/api";
+import { textbookAPI, queryAPI, errorMessage } from "../services/api";
 import type { Textbook, QueryResponse } from "../types";
 
 export default function Library() {
@@ -65,7 +65,7 @@ export default function Library() {
       setUploadTitle("");
       setShowUploadModal(false);
     } catch (err: any) {
-      setError(err.response?.data || "Upload failed");
+      setError(errorMessage(err, "Upload failed"));
     } finally {
       setIsUploading(false);
     }
@@ -126,7 +126,7 @@ export default function Library() {
         { question: currentQuestion, answer: response },
       ]);
     } catch (err: any) {
-      setError(err.response?.data || "Failed to get answer");
+      setError(errorMessage(err, "Failed to get answer"));
       // Restore question on error
       setQuestion(currentQuestion);
     } finally {
@@ -484,11 +484,11 @@ export default function Library() {
 
               <div>
                 <label className="block text-sm font-medium text-gray-300 mb-2">
-                  PDF File
+                  Document (PDF, EPUB, DOCX, PPTX, Markdown, HTML)
                 </label>
                 <input
                   type="file"
-                  accept=".pdf"
+                  accept=".pdf,.epub,.docx,.pptx,.md,.markdown,.html,.htm"
                   onChange={(e) => setUploadFile(e.target.files?.[0] || null)}
                   required
                   className="w-full text-gray-300 file:mr-4 file:py-2 file:px-4 file:rounded-lg file:border-0 file:bg-blue-600 file:text-white file:font-semibold hover:file:bg-blue-500 file:cursor-pointer"
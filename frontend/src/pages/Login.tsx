@@ -1,6 +1,6 @@
 import { useState } from "react";
 import { useNavigate } from "react-router-dom";
-import { authAPI } from "../services/api";
+import { authAPI, errorMessage } from "../services/api";
 
 // Helper function to format error messages for display
 const formatErrorMessage = (error: string): string => {
@@ -33,9 +33,8 @@ export default function Login() {
       // Redirect to library
       navigate("/library");
     } catch (err: any) {
-      const errorMessage =
-        err.response?.data || "Login failed. Please try again.";
-      setError(formatErrorMessage(errorMessage));
+      const message = errorMessage(err, "Login failed. Please try again.");
+      setError(formatErrorMessage(message));
     } finally {
       setIsLoading(false);
     }
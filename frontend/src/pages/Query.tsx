@@ -1,6 +1,6 @@
 import { useState, useEffect } from "react";
 import { useNavigate } from "react-router-dom";
-import { textbookAPI, queryAPI } from "../services/api";
+import { textbookAPI, queryAPI, errorMessage } from "../services/api";
 import type { Textbook, QueryResponse } from "../types";
 
 export default function Query() {
@@ -53,7 +53,7 @@ export default function Query() {
       });
       setAnswer(response);
     } catch (err: any) {
-      setError(err.response?.data || "Failed to get answer");
+      setError(errorMessage(err, "Failed to get answer"));
     } finally {
       setIsLoading(false);
     }
@@ -163,7 +163,7 @@ export default function Query() {
                       className="bg-gray-900/50 border border-gray-700 rounded-lg p-4"
                     >
                       <div className="font-medium text-blue-400 mb-2">
-                        Page {source.page_number}
+                        [{index + 1}] Page {source.page_number}
                       </div>
                       <p className="text-sm text-gray-400 line-clamp-3">
                         {source.content}
@@ -1,6 +1,8 @@
 import axios from 'axios';
 import type { LoginRequest, LoginResponse, Textbook, 
-              TextbookStatus, QueryRequest, QueryResponse } from '../types';
+              TextbookStatus, QueryRequest, QueryResponse, Outline,
+              SearchParams, SearchResponse, EmbeddingGeneration,
+              ReembedRequest, ApiError } from '../types';
 
 // Base URL for Go backend
 const API_BASE_URL = import.meta.env.VITE_API_URL || '/api';
@@ -22,6 +24,12 @@ api.interceptors.request.use((config) => {
   return config;
 });
 
+// Message from an API error response, or fallback
+export const errorMessage = (err: any, fallback: string): string => {
+  const data = err?.response?.data as ApiError | undefined;
+  return data?.error?.message || fallback;
+};
+
 // Auth API calls
 export const authAPI = {
   login: async (credentials: LoginRequest): Promise<LoginResponse> => {
@@ -52,6 +60,21 @@ export const textbookAPI = {
     return response.data;
   },
 
+  getOutline: async (id: number): Promise<Outline> => {
+    const response = await api.get<Outline>(`/textbooks/${id}/outline`);
+    return response.data;
+  },
+
+  getEmbeddings: async (id: number): Promise<EmbeddingGeneration[]> => {
+    const response = await api.get<EmbeddingGeneration[]>(`/textbooks/${id}/embeddings`);
+    return response.data;
+  },
+
+  reembed: async (id: number, request: ReembedRequest = {}): Promise<EmbeddingGeneration> => {
+    const response = await api.post<EmbeddingGeneration>(`/textbooks/${id}/reembed`, request);
+    return response.data;
+  },
+
   delete: async (id: number): Promise<void> => {
     await api.delete(`/textbooks/${id}`);
   },
@@ -76,4 +99,16 @@ export const queryAPI = {
     const response = await api.post<QueryResponse>('/query', request);
     return response.data;
   },
-};
\ No newline at end of file
+};
+// Search API calls (retrieval only, no answer generation)
+export const searchAPI = {
+  textbook: async (id: number, params: SearchParams): Promise<SearchResponse> => {
+    const response = await api.get<SearchResponse>(`/textbooks/${id}/search`, { params });
+    return response.data;
+  },
+
+  library: async (params: SearchParams): Promise<SearchResponse> => {
+    const response = await api.get<SearchResponse>('/search', { params });
+    return response.data;
+  },
+};
@@ -18,6 +18,8 @@ export interface LoginResponse {
 }
 
 // Textbook types
+export type IngestionStatus = 'pending' | 'running' | 'interrupted' | 'complete' | 'failed';
+
 export interface Textbook {
   id: number;
   user_id: number;
@@ -25,13 +27,19 @@ export interface Textbook {
   s3_key: string;
   uploaded_at: string;
   processed: boolean;
+  ingestion_status: IngestionStatus;
+  relevance_threshold?: number;
 }
 
 export interface TextbookStatus {
   textbook_id: number;
   title: string;
   processed: boolean;
+  ingestion_status: IngestionStatus;
   chunk_count: number;
+  page_count: number;
+  ocr_page_count: number;
+  dropped_page_count: number;
   uploaded_at: string;
 }
 
@@ -39,14 +47,148 @@ export interface TextbookStatus {
 export interface QueryRequest{
   textbook_id: number;
   question: string;
+  filters?: QueryFilters;
+  rerank?: boolean;
+  diversity?: number;
+  strategy?: 'rewrite' | 'multi_query' | 'hyde';
+  check_faithfulness?: boolean;
+  no_cache?: boolean;
+}
+
+export interface PageRange {
+  start: number;
+  end: number;
+}
+
+export interface QueryFilters {
+  page_start?: number;
+  page_end?: number;
+  section_ids?: number[];
+  exclude_pages?: PageRange[];
+}
+
+// Outline types
+export interface Section {
+  id: number;
+  textbook_id: number;
+  parent_id?: number;
+  level: number;
+  title: string;
+  page_start: number;
+  page_end: number;
+  children?: Section[];
+}
+
+export interface Outline {
+  textbook_id: number;
+  sections: Section[];
 }
 
 export interface QueryResponse {
   answer: string;
+  answer_mode: 'textbook' | 'not_covered';
+  coverage: 'none' | 'partial' | 'full';
+  relevance_threshold: number;
   sources: Source[];
+  citations: Citation[];
+  invalid_citations?: number[];
+  faithfulness?: Faithfulness;
+  filters?: QueryFilters;
+  cached: boolean;
+}
+
+export interface Citation {
+  chunk_id: number;
+  textbook_id: number;
+  source_index: number;
+  page_number: number;
+  page_end: number;
+  start: number;
+  end: number;
+  marker_start: number;
+  marker_end: number;
+}
+
+export interface Faithfulness {
+  score: number;
+  supported: number;
+  unsupported: number;
+  sentences: SentenceLabel[];
+  model: string;
+}
+
+export interface SentenceLabel {
+  text: string;
+  start: number;
+  end: number;
+  label: 'supported' | 'unsupported' | 'not_applicable';
+  chunk_ids?: number[];
 }
 
 export interface Source {
+  chunk_id: number;
+  textbook_id: number;
   page_number: number;
+  location?: string;
   content: string;
-}
\ No newline at end of file
+}
+export interface Settings {
+  relevance_threshold?: number;
+  default_relevance_threshold: number;
+}
+
+export interface SearchParams {
+  q: string;
+  page?: number;
+  page_size?: number;
+  min_score?: number;
+}
+
+export interface SearchResponse {
+  query: string;
+  textbook_id?: number;
+  page: number;
+  page_size: number;
+  has_more: boolean;
+  hits: SearchHit[];
+  time_taken_ms: number;
+}
+
+export interface SearchHit {
+  chunk_id: number;
+  textbook_id: number;
+  textbook_title: string;
+  page_number: number;
+  page_end: number;
+  location?: string;
+  section_path?: string;
+  snippet: string;
+  highlights: { start: number; end: number }[];
+  score: number;
+}
+
+export interface EmbeddingGeneration {
+  id: number;
+  textbook_id: number;
+  model: string;
+  dimensions: number;
+  status: 'building' | 'active' | 'retired' | 'failed';
+  chunk_count: number;
+  embedded_count: number;
+  error?: string;
+  created_at: string;
+  activated_at?: string;
+}
+
+export interface ReembedRequest {
+  model?: string;
+  dimensions?: number;
+}
+
+export interface ApiError {
+  error: {
+    code: string;
+    message: string;
+    request_id?: string;
+  };
+}